@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// eventHealthCheckFailed はバックグラウンドの依存先チェックの失敗を記録するログのイベント名
+const eventHealthCheckFailed = "health.check_failed"
+
+// jitteredInterval は base を ±fraction の範囲でランダムにずらした間隔を返す（rnd は [0, 1) の乱数）
+// レプリカ間でタイマーが同期し、依存先へのチェックが同時に集中すること（thundering herd）を防ぐ
+// fraction が 0.5 を超えても base/2 を下限とし、間隔がほぼ 0 になってチェックが連続実行されることを防ぐ
+func jitteredInterval(base time.Duration, fraction float64, rnd func() float64) time.Duration {
+	if fraction <= 0 {
+		return base
+	}
+	return max(time.Duration(float64(base)*(1+fraction*(2*rnd()-1))), base/2)
+}
+
+// startBackgroundChecks は依存先チェックを一定間隔（ジッター付き）で実行するゴルーチンを開始する
+// 失敗したチェックを構造化ログに出力し、CachedChecker の結果キャッシュを事前に更新する
+// wd（nil 可）には必須の依存先の失敗（unhealthy）が続いているかを通知する
+// ctx がキャンセルされる（シャットダウン）と停止し、返り値のチャネルが閉じられる
+func startBackgroundChecks(ctx context.Context, interval time.Duration, jitter float64, wd *watchdog) <-chan struct{} {
+	done := make(chan struct{})
+	timer := time.NewTimer(jitteredInterval(interval, jitter, rand.Float64))
+	go func() {
+		defer close(done)
+		defer timer.Stop()
+		for {
+			select {
+			case <-timer.C:
+				results, _ := healthChecks.Run(ctx)
+				for _, r := range results {
+					if r.Status != checkStatusPass {
+						logger.Warn(eventHealthCheckFailed,
+							"check", r.Name,
+							"status", r.Status,
+							"error", r.Error,
+							"optional", r.Optional)
+					}
+				}
+				if ctx.Err() == nil {
+					wd.observe(overallStatus(results) != healthStatusUnhealthy)
+				}
+				timer.Reset(jitteredInterval(interval, jitter, rand.Float64))
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return done
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// TestJitteredInterval はバックグラウンドチェックの間隔のジッターのテスト
+// 連続する間隔がばらつき、かつ設定した割合の範囲内に収まることを保証
+func TestJitteredInterval(t *testing.T) {
+	base := 10 * time.Second
+	min, max := 9*time.Second, 11*time.Second
+
+	seen := make(map[time.Duration]bool)
+	prev := time.Duration(-1)
+	varied := false
+	for i := 0; i < 100; i++ {
+		d := jitteredInterval(base, 0.1, rand.Float64)
+		if d < min || d > max {
+			t.Fatalf("Interval %v outside jitter bound [%v, %v]", d, min, max)
+		}
+		if prev >= 0 && d != prev {
+			varied = true
+		}
+		prev = d
+		seen[d] = true
+	}
+	if !varied || len(seen) < 50 {
+		t.Errorf("Expected consecutive intervals to vary, got %d distinct values", len(seen))
+	}
+
+	// 乱数の両端で範囲の上下限になる
+	if d := jitteredInterval(base, 0.1, func() float64 { return 0 }); d != min {
+		t.Errorf("Expected %v at lower bound, got %v", min, d)
+	}
+	if d := jitteredInterval(base, 0, rand.Float64); d != base {
+		t.Errorf("Expected no jitter with fraction 0, got %v", d)
+	}
+
+	// BACKGROUND_CHECK_JITTER=1 でも間隔は base/2 を下回らない（チェックの連続実行を防ぐ）
+	if d := jitteredInterval(base, 1, func() float64 { return 0 }); d != base/2 {
+		t.Errorf("Expected interval floored at %v, got %v", base/2, d)
+	}
+}
+
+// TestBackgroundChecks はバックグラウンドチェックが定期的に実行され、失敗をログ出力することを確認する
+func TestBackgroundChecks(t *testing.T) {
+	logs := captureLogs(t)
+	db := &fakeChecker{name: "database", err: errors.New("connection refused")}
+	withCheckers(t, db)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := startBackgroundChecks(ctx, 10*time.Millisecond, 0.5, nil)
+	deadline := time.Now().Add(2 * time.Second)
+	for len(logs.entries(t)) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("Background checks did not run repeatedly")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	e := logs.entries(t)[0]
+	if e["msg"] != eventHealthCheckFailed || e["check"] != "database" || e["status"] != checkStatusFail {
+		t.Errorf("Unexpected log entry: %v", e)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// errBodyTooLarge は readBodyWithContext で本文が上限を超えた場合のエラー
+var errBodyTooLarge = errors.New("request body too large")
+
+// readBodyWithContext は本文を最大 limit バイトまで読み取る（limit が 0 以下なら無制限）
+// 低速なクライアントの本文読み取りでハンドラーのタイムアウトを超えてブロックしないよう、
+// ctx のキャンセル・期限切れ時は読み取り途中でも即座にエラーを返す
+// （中断後も読み取り中の Read はバックグラウンドで継続し、本文のクローズ時に終了する）
+func readBodyWithContext(ctx context.Context, body io.Reader, limit int64) ([]byte, error) {
+	type result struct {
+		data []byte
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		var buf bytes.Buffer
+		r := body
+		if limit > 0 {
+			// 上限超過を検出するため 1 バイト余分に読む
+			r = io.LimitReader(body, limit+1)
+		}
+		_, err := buf.ReadFrom(r)
+		if err == nil && limit > 0 && int64(buf.Len()) > limit {
+			err = fmt.Errorf("%w: exceeds %d bytes", errBodyTooLarge, limit)
+		}
+		done <- result{buf.Bytes(), err}
+	}()
+
+	select {
+	case res := <-done:
+		if res.err != nil {
+			return nil, res.err
+		}
+		return res.data, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("reading request body: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// slowReader は delay ごとに1バイトずつ、合計 n バイトを返す低速な本文
+type slowReader struct {
+	delay time.Duration
+	n     int
+}
+
+func (s *slowReader) Read(p []byte) (int, error) {
+	if s.n == 0 {
+		return 0, io.EOF
+	}
+	time.Sleep(s.delay)
+	if len(p) == 0 {
+		return 0, nil
+	}
+	p[0] = 'x'
+	s.n--
+	return 1, nil
+}
+
+// TestReadBodyWithContextCanceled は低速な本文の読み取りがコンテキストの期限で即座に中断されることを確認する
+func TestReadBodyWithContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := readBodyWithContext(ctx, &slowReader{delay: 10 * time.Millisecond, n: 100}, 0)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected deadline exceeded error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Read should abort promptly, took %v", elapsed)
+	}
+}
+
+// TestReadBodyWithContextLimit は上限以内の本文は読み取り、超過時は errBodyTooLarge を返すことを確認する
+func TestReadBodyWithContextLimit(t *testing.T) {
+	data, err := readBodyWithContext(context.Background(), strings.NewReader("hello"), 5)
+	if err != nil || string(data) != "hello" {
+		t.Errorf("Expected body within limit, got %q (%v)", data, err)
+	}
+	if _, err := readBodyWithContext(context.Background(), strings.NewReader("hello!"), 5); !errors.Is(err, errBodyTooLarge) {
+		t.Errorf("Expected errBodyTooLarge, got %v", err)
+	}
+	if _, err := readBodyWithContext(context.Background(), io.MultiReader(), 0); err != nil {
+		t.Errorf("Expected empty body to succeed, got %v", err)
+	}
+}
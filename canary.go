@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"net/http"
+)
+
+// canaryKey はカナリア検証用のリクエストであることをコンテキストに格納するためのキー
+type canaryKey struct{}
+
+// isCanary はカナリア検証用のリクエスト（CANARY_HEADER 付き）かを返す
+func isCanary(ctx context.Context) bool {
+	v, _ := ctx.Value(canaryKey{}).(bool)
+	return v
+}
+
+// canaryMiddleware はトラフィック分割の検証用に、CANARY_HEADER 付きのリクエストへ
+// 処理したバージョンを X-Served-By-Version ヘッダーで返すミドルウェア
+// JSON を返すハンドラーは isCanary で判定してレスポンスに "canary": true を含める
+func canaryMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		header := cfg().CanaryHeader
+		if header == "" || r.Header.Get(header) == "" {
+			next(w, r)
+			return
+		}
+		w.Header().Set("X-Served-By-Version", cfg().Version)
+		next(w, r.WithContext(context.WithValue(r.Context(), canaryKey{}, true)))
+	}
+}
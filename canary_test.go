@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestCanaryHeader はカナリア検証用ヘッダーのテスト
+// ヘッダー付きのリクエストにのみ処理したバージョンと canary フィールドを返すことを保証
+func TestCanaryHeader(t *testing.T) {
+	captureLogs(t)
+	withConfig(t, func(c *Config) { c.Version = "2.3.4-canary" })
+	router := newRouter()
+
+	get := func(canary bool) (*httptest.ResponseRecorder, HealthResponse) {
+		req := httptest.NewRequest("GET", "/health", nil)
+		if canary {
+			req.Header.Set("X-Canary", "1")
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		var resp HealthResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Could not unmarshal response: %v", err)
+		}
+		return rr, resp
+	}
+
+	rr, resp := get(true)
+	if v := rr.Header().Get("X-Served-By-Version"); v != "2.3.4-canary" {
+		t.Errorf("Expected X-Served-By-Version 2.3.4-canary, got %q", v)
+	}
+	if !resp.Canary {
+		t.Error("Expected canary: true in JSON response")
+	}
+
+	rr, resp = get(false)
+	if v := rr.Header().Get("X-Served-By-Version"); v != "" {
+		t.Errorf("Expected no X-Served-By-Version without canary header, got %q", v)
+	}
+	if resp.Canary {
+		t.Error("Expected canary field to be omitted without canary header")
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// retryBudget はすべての依存先チェックで共有する再試行予算（トークンバケット）
+// 再試行1回ごとに tokenBucket.allow でトークンを1つ消費する
+// 部分障害時に各チェックが個別に再試行して負荷を増幅させないよう、再試行回数を全体で制限する
+type retryBudget struct {
+	*tokenBucket
+}
+
+// newRetryBudget は満杯の再試行予算を作成する
+func newRetryBudget(max int, refillPerSec float64) *retryBudget {
+	return &retryBudget{tokenBucket: newTokenBucket(max, refillPerSec)}
+}
+
+// checkRetryBudget はアプリケーション全体で共有する依存先チェックの再試行予算
+var checkRetryBudget = newRetryBudget(10, 1)
+
+// HTTPChecker は HTTP エンドポイントの疎通を確認する依存先チェック
+// 2xx/3xx 応答を正常とみなし、失敗時は共有の再試行予算の範囲内で再試行する
+type HTTPChecker struct {
+	name    string
+	url     string
+	client  *http.Client
+	retries int          // 1回のチェックで行う最大再試行回数
+	budget  *retryBudget // 再試行時に消費する共有予算
+
+	optional bool          // 失敗時に degraded 扱いとするか（HTTP_CHECK_OPTIONAL_URLS）
+	cacheTTL time.Duration // 結果のキャッシュ期間（CHECK_CACHE_TTLS）
+}
+
+// NewHTTPChecker は HTTP 依存先チェックを作成する
+func NewHTTPChecker(name, url string, retries int, budget *retryBudget) *HTTPChecker {
+	return &HTTPChecker{
+		name:    name,
+		url:     url,
+		client:  &http.Client{Timeout: 5 * time.Second},
+		retries: retries,
+		budget:  budget,
+	}
+}
+
+// Name はチェック名を返す
+func (c *HTTPChecker) Name() string { return c.name }
+
+// Optional は任意の依存先（失敗時に degraded 扱い）かを返す
+func (c *HTTPChecker) Optional() bool { return c.optional }
+
+// CacheTTL は結果のキャッシュ期間を返す
+func (c *HTTPChecker) CacheTTL() time.Duration { return c.cacheTTL }
+
+// Check は URL へ GET を送信し、失敗時は予算が残っている限り再試行する
+// 予算が尽きている場合は再試行せずに即座に失敗を返す（fail fast）
+func (c *HTTPChecker) Check(ctx context.Context) error {
+	err := c.probe(ctx)
+	for attempt := 1; err != nil && attempt <= c.retries; attempt++ {
+		if ctx.Err() != nil {
+			return err
+		}
+		if !c.budget.allow() {
+			return fmt.Errorf("%w (retry budget exhausted)", err)
+		}
+		err = c.probe(ctx)
+	}
+	return err
+}
+
+// probe は1回分の HTTP リクエストを送信する
+func (c *HTTPChecker) probe(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// tcpCheckTimeout は TCP チェックの接続タイムアウト
+// HEALTH_CHECK_DEADLINE がより短い場合はそちらが優先される
+const tcpCheckTimeout = 3 * time.Second
+
+// TCPChecker は TCP で接続できるかを確認する依存先チェック
+// HTTP を話さない DB・キャッシュなどの疎通確認に使用する（接続確立のみで、プロトコルの応答は確認しない）
+type TCPChecker struct {
+	name    string
+	addr    string // 接続先の host:port
+	timeout time.Duration
+
+	cacheTTL time.Duration // 結果のキャッシュ期間（CHECK_CACHE_TTLS）
+	dns      *dnsCache     // 名前解決のキャッシュ（nil なら接続のたびに名前解決する）
+}
+
+// NewTCPChecker は TCP 依存先チェックを作成する
+func NewTCPChecker(name, addr string) *TCPChecker {
+	return &TCPChecker{name: name, addr: addr, timeout: tcpCheckTimeout}
+}
+
+// Name はチェック名を返す
+func (c *TCPChecker) Name() string { return c.name }
+
+// CacheTTL は結果のキャッシュ期間を返す
+func (c *TCPChecker) CacheTTL() time.Duration { return c.cacheTTL }
+
+// Check は addr への TCP 接続を試み、確立できたらすぐに閉じる
+func (c *TCPChecker) Check(ctx context.Context) error {
+	dialer := &net.Dialer{Timeout: c.timeout}
+	var conn net.Conn
+	var err error
+	if c.dns != nil {
+		conn, err = c.dns.dial(ctx, dialer, "tcp", c.addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", c.addr)
+	}
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// registerCheckers は設定に基づいて依存先チェックを登録する
+// checkDNSCache 設定時（DNS_CACHE_TTL）は接続先の名前解決にキャッシュを使う
+func registerCheckers(c *Config) {
+	newHTTP := func(url string) *HTTPChecker {
+		checker := NewHTTPChecker("http:"+url, url, c.HTTPCheckRetries, checkRetryBudget)
+		checker.cacheTTL = c.CheckCacheTTLs[checker.name]
+		if checkDNSCache != nil {
+			checker.client.Transport = checkDNSCache.transport()
+		}
+		return checker
+	}
+	for _, url := range splitList(c.HTTPCheckURLs) {
+		healthChecks.Register(newHTTP(url))
+	}
+	for _, url := range splitList(c.HTTPCheckOptionalURLs) {
+		checker := newHTTP(url)
+		checker.optional = true
+		healthChecks.Register(checker)
+	}
+	for _, addr := range splitList(c.TCPCheckAddrs) {
+		checker := NewTCPChecker("tcp:"+addr, addr)
+		checker.cacheTTL = c.CheckCacheTTLs[checker.name]
+		checker.dns = checkDNSCache
+		healthChecks.Register(checker)
+	}
+}
+
+// splitList はカンマ区切りの文字列を空白除去済みの要素一覧に分割する（空要素は除外）
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// parseCheckCacheTTLs は "name=duration" のカンマ区切り一覧を依存先チェック名ごとのキャッシュ期間に変換する
+// チェック名（"http:URL" など）には "=" が含まれうるため、最後の "=" で分割する
+func parseCheckCacheTTLs(s string) (map[string]time.Duration, error) {
+	ttls := make(map[string]time.Duration)
+	for _, pair := range splitList(s) {
+		i := strings.LastIndex(pair, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid entry %q: expected name=duration", pair)
+		}
+		ttl, err := time.ParseDuration(strings.TrimSpace(pair[i+1:]))
+		if err != nil || ttl < 0 {
+			return nil, fmt.Errorf("invalid duration in %q", pair)
+		}
+		ttls[strings.TrimSpace(pair[:i])] = ttl
+	}
+	return ttls, nil
+}
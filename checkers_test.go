@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestHTTPCheckerRetryBudget は共有再試行予算のテスト
+// 予算が尽きた後のチェックは再試行せずに即座に失敗することを保証
+func TestHTTPCheckerRetryBudget(t *testing.T) {
+	var hits int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&hits, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	// 補充なし・容量2の予算を2つのチェックで共有
+	now := time.Unix(1700000000, 0)
+	budget := newRetryBudget(2, 0)
+	budget.now = func() time.Time { return now }
+	budget.last = now
+
+	a := NewHTTPChecker("a", srv.URL, 3, budget)
+	b := NewHTTPChecker("b", srv.URL, 3, budget)
+
+	// 1回目：初回 + 予算2回分の再試行
+	if err := a.Check(context.Background()); err == nil {
+		t.Fatal("Expected check against failing dependency to fail")
+	}
+	if got := atomic.LoadInt64(&hits); got != 3 {
+		t.Errorf("Expected 3 requests (1 + 2 retries), got %d", got)
+	}
+
+	// 予算枯渇後は別のチェックでも再試行しない
+	atomic.StoreInt64(&hits, 0)
+	if err := b.Check(context.Background()); err == nil {
+		t.Fatal("Expected check to fail")
+	}
+	if got := atomic.LoadInt64(&hits); got != 1 {
+		t.Errorf("Expected 1 request without retries after budget exhausted, got %d", got)
+	}
+
+	// 時間経過で予算が補充される
+	budget.refillRate = 1
+	now = now.Add(time.Second)
+	if !budget.allow() {
+		t.Error("Expected budget to refill over time")
+	}
+}
+
+// TestHTTPCheckerSuccess は正常な依存先のチェックテスト
+func TestHTTPCheckerSuccess(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	c := NewHTTPChecker("ok", srv.URL, 2, newRetryBudget(10, 1))
+	if err := c.Check(context.Background()); err != nil {
+		t.Errorf("Expected healthy dependency, got %v", err)
+	}
+}
+
+// TestTCPChecker は TCP 依存先チェックのテスト
+// 待ち受け中のポートは成功し、閉じたポートは失敗することを保証
+func TestTCPChecker(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	if err := NewTCPChecker("tcp:db", ln.Addr().String()).Check(context.Background()); err != nil {
+		t.Errorf("Expected listening port to pass, got %v", err)
+	}
+
+	// 一度確保したポートを閉じて、接続を拒否されるアドレスを作る
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := closed.Addr().String()
+	closed.Close()
+	if err := NewTCPChecker("tcp:cache", addr).Check(context.Background()); err == nil {
+		t.Error("Expected closed port to fail")
+	}
+
+	// TCP_CHECK_ADDRS で登録される
+	withCheckers(t)
+	registerCheckers(&Config{TCPCheckAddrs: ln.Addr().String() + ", " + addr})
+	results, healthy := healthChecks.Run(context.Background())
+	if healthy || len(results) != 2 || results[0].Name != "tcp:"+ln.Addr().String() || results[1].Status != checkStatusFail {
+		t.Errorf("Unexpected results: healthy=%v %+v", healthy, results)
+	}
+}
+
+// TestParseCheckCacheTTLs は CHECK_CACHE_TTLS の解析テスト（チェック名に "=" を含む場合を含む）
+func TestParseCheckCacheTTLs(t *testing.T) {
+	ttls, err := parseCheckCacheTTLs("tcp:db:5432=5s, http:http://api/health?x=1=1m")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ttls["tcp:db:5432"] != 5*time.Second || ttls["http:http://api/health?x=1"] != time.Minute {
+		t.Errorf("Unexpected TTLs: %v", ttls)
+	}
+	for _, bad := range []string{"tcp:db:5432", "tcp:db:5432=soon", "=5s"} {
+		if _, err := parseCheckCacheTTLs(bad); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
+
+// TestHTTPCheckerCanceledOnDeadline は依存先チェックの期限のテスト
+// CHECK_TIMEOUT を過ぎると HTTP チェックの送信中リクエストがキャンセルされ、timeout になることを保証
+func TestHTTPCheckerCanceledOnDeadline(t *testing.T) {
+	withConfig(t, func(c *Config) {
+		c.CheckTimeout = 50 * time.Millisecond
+		c.HealthCheckDeadline = 5 * time.Second
+	})
+	canceled := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			close(canceled)
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer srv.Close()
+	withCheckers(t, NewHTTPChecker("slow-api", srv.URL, 0, newRetryBudget(0, 0)))
+
+	start := time.Now()
+	results, healthy := healthChecks.Run(context.Background())
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Check should stop at the per-check timeout, took %v", elapsed)
+	}
+	if healthy || results[0].Status != checkStatusTimeout {
+		t.Errorf("Expected timeout result, got %+v", results[0])
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Error("Outbound request should be canceled when the deadline passes")
+	}
+}
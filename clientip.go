@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// clientIP はリクエスト元クライアントの IP アドレスを解決する
+// 直接の接続元が TRUSTED_PROXIES に含まれる場合のみ X-Forwarded-For を参照し、
+// 右端から辿って最初に現れる信頼できないアドレスをクライアントとみなす（ヘッダー偽装対策）
+func clientIP(r *http.Request) string {
+	remote := remoteIP(r.RemoteAddr)
+	proxies := cfg().TrustedProxies
+	if !ipInNets(remote, proxies) {
+		return remote
+	}
+
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if !ipInNets(hop, proxies) {
+			return hop
+		}
+	}
+	return remote
+}
+
+// remoteIP は "host:port" 形式の RemoteAddr からホスト部分を取り出す
+func remoteIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// ipInNets は IP アドレスがいずれかのネットワークに含まれるかを返す
+func ipInNets(ip string, nets []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCIDRList はカンマ区切りの CIDR（単一 IP も可）一覧を解析する
+func parseCIDRList(s string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		// 単一 IP はホストアドレスの CIDR として扱う
+		if !strings.Contains(part, "/") {
+			if ip := net.ParseIP(part); ip != nil {
+				if ip.To4() != nil {
+					part += "/32"
+				} else {
+					part += "/128"
+				}
+			}
+		}
+		_, n, err := net.ParseCIDR(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", part)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
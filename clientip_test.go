@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+// TestClientIP はクライアント IP 解決のテスト
+// 信頼できるプロキシ経由の場合のみ X-Forwarded-For を参照することを保証
+func TestClientIP(t *testing.T) {
+	proxies, err := parseCIDRList("10.0.0.0/8, 192.168.1.1")
+	if err != nil {
+		t.Fatalf("parseCIDRList failed: %v", err)
+	}
+	withConfig(t, func(c *Config) { c.TrustedProxies = proxies })
+
+	tests := []struct {
+		name   string
+		remote string
+		xff    string
+		want   string
+	}{
+		{"direct", "203.0.113.5:1234", "", "203.0.113.5"},
+		{"untrusted remote ignores XFF", "203.0.113.5:1234", "198.51.100.1", "203.0.113.5"},
+		{"trusted proxy", "10.1.2.3:1234", "198.51.100.1", "198.51.100.1"},
+		{"spoofed leftmost ignored", "10.1.2.3:1234", "1.1.1.1, 198.51.100.1", "198.51.100.1"},
+		{"chained trusted proxies", "10.1.2.3:1234", "198.51.100.1, 192.168.1.1", "198.51.100.1"},
+		{"only proxies", "10.1.2.3:1234", "10.9.9.9", "10.1.2.3"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tt.remote
+		if tt.xff != "" {
+			req.Header.Set("X-Forwarded-For", tt.xff)
+		}
+		if got := clientIP(req); got != tt.want {
+			t.Errorf("%s: got %s want %s", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := parseCIDRList("not-a-cidr"); err == nil {
+		t.Error("Expected error for invalid CIDR")
+	}
+}
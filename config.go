@@ -0,0 +1,548 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Config はアプリケーション設定を保持する構造体
+// 12-Factor App の原則に従い、すべての設定値を環境変数から読み込む
+type Config struct {
+	Port     string // 待ち受けポート番号（Cloud Run では PORT が自動設定される）
+	BasePath string // リバースプロキシのサブパス配下で動作する場合のプレフィックス（例: "/app"）
+
+	// リスナーごとのアイドル接続タイムアウト（管理用はダッシュボードの常時接続に合わせて長くする）
+	IdleTimeout      time.Duration // 公開リスナーのアイドル接続タイムアウト
+	AdminPort        string        // 管理用リスナーのポート番号（空なら管理用リスナーなし）
+	AdminIdleTimeout time.Duration // 管理用リスナーのアイドル接続タイムアウト
+
+	Version           string // アプリケーションバージョン
+	ExpectedVersion   string // ローリングデプロイ時に期待するバージョン（空なら比較しない）
+	HealthMessage     string // ヘルスチェックレスポンスに含める任意のメッセージ（空なら省略）
+	HealthFormat      string // /health のレスポンス形式（"json" または "text"）
+	RolloutGeneration string // ロールアウト世代（ROLLOUT_GENERATION、未設定なら Cloud Run の K_REVISION）
+	CacheControl      string // 監視系エンドポイントに付与する Cache-Control ヘッダー値（空なら付与しない）
+	JSONOmitEmpty     bool   // ヘルス・メトリクスの JSON でゼロ値のフィールドを省略するか
+	MetricsNamespace  string // Prometheus 形式のメトリクス名に付与する名前空間（空なら付与しない）
+	RootCacheControl  string // ルートページに付与する Cache-Control ヘッダー値（空なら付与しない）
+	RootCSP           string // ルートページ（HTML）に付与する Content-Security-Policy（空なら付与しない）
+
+	ErrorPageTemplate *template.Template // HTML クライアント向けエラーページのテンプレート（nil なら組み込みテンプレート）
+
+	StaticDir    string // 静的ファイルを配信するディレクトリ（空なら配信しない）
+	StaticPrefix string // 静的ファイルを配信するパスのプレフィックス（"/" で始まり "/" で終わる）
+
+	HTTPCheckURLs     string  // 深いヘルスチェックで疎通確認する HTTP エンドポイント（カンマ区切り）
+	TCPCheckAddrs     string  // 深いヘルスチェックで接続確認する TCP の host:port（カンマ区切り）
+	HTTPCheckRetries  int     // HTTP チェック1回あたりの最大再試行回数
+	RetryBudget       int     // 全チェック共有の再試行予算（トークンバケット容量）
+	RetryBudgetRefill float64 // 再試行予算の補充速度（トークン/秒）
+
+	HTTPCheckOptionalURLs string // 失敗時に degraded 扱いとする任意の HTTP 依存先（カンマ区切り）
+	DegradedStatusCode    int    // degraded 時の HTTP ステータス（200 または 503。0 なら liveness 200・readiness 503）
+
+	CheckCacheTTLs map[string]time.Duration // 依存先チェック名ごとの結果キャッシュ期間（未指定ならキャッシュしない）
+	DNSCacheTTL    time.Duration            // 依存先のホスト名の名前解決結果をバックグラウンドで更新する間隔（0 なら無効）
+
+	BackgroundCheckInterval time.Duration // 依存先チェックをバックグラウンドで実行する間隔（0 なら無効）
+	BackgroundCheckJitter   float64       // バックグラウンドチェックの間隔をずらす割合（0〜1、0.1 なら ±10%）
+	WatchdogFailures        int           // バックグラウンドチェックが連続して unhealthy となったらプロセスを停止する回数（0 なら無効）
+
+	TrustedProxies   []*net.IPNet // X-Forwarded-For を信頼するプロキシのネットワーク
+	MaxInflightPerIP int          // クライアント IP ごとの同時処理数の上限（0 以下なら無制限）
+	MaxConnections   int          // 同時に保持する TCP コネクション数の上限（0 以下なら無制限）
+	DualStack        bool         // IPv4 と IPv6 のリスナーを個別に作成するか（ホスト未指定のアドレスのみ）
+
+	MaxConcurrentRequests int           // サーバー全体の同時処理数の上限（0 以下なら無制限）
+	QueueTimeout          time.Duration // 同時処理数の上限到達時に処理枠の空きを待つ最大時間
+
+	RateLimit          int           // RATE_LIMIT_WINDOW あたりに受け付けるリクエスト数の上限（0 以下なら無制限）
+	RateLimitWindow    time.Duration // レート制限のウィンドウ
+	RateLimitAlgorithm string        // レート制限のアルゴリズム（"token_bucket" または "sliding_window"）
+
+	StrictQuery          bool   // 未知のクエリパラメーターを含むリクエストを 400 で拒否するか
+	StrictAccept         bool   // 応答できない Accept のリクエストを 406 で拒否するか
+	MaxBodyBytes         int64  // リクエスト本文の最大サイズ（0 以下なら無制限）
+	ExpectContinuePolicy string // Expect: 100-continue の扱い（"reject" または "accept"）
+
+	HandlerTimeout       time.Duration // ハンドラー処理時間の上限（ルート個別指定がない場合のデフォルト）
+	ReadHeaderTimeout    time.Duration // リクエストヘッダー読み取りの上限（slowloris 対策）
+	HealthCheckDeadline  time.Duration // 深いヘルスチェック全体の期限（0 以下なら期限なし）
+	CheckTimeout         time.Duration // 依存先チェック1件あたりの期限（0 以下なら全体の期限のみ）
+	ShutdownTimeout      time.Duration // グレースフルシャットダウン時に処理中リクエストを待つ最大時間
+	ShutdownDelay        time.Duration // レディネスを落としてからドレインを開始するまでの待機時間（LB の登録解除待ち）
+	AcceptMaxRetries     int           // 一時的な accept エラーを連続して再試行する最大回数
+	RequestIDFormat      string        // リクエストIDの形式（"uuid"、"ulid"、"hex"）
+	AllowedHosts         []string      // 許可する Host ヘッダー（小文字、"*.example.com" 形式のワイルドカード可。空ならすべて許可）
+	Redirects            []redirect    // 旧パスから新パスへのリダイレクトテーブル
+	IdempotencyTTL       time.Duration // Idempotency-Key ごとのレスポンスを保持する期間
+	KeepAliveIdle        time.Duration // プローブ用コネクションのキープアライブアイドル時間（0 なら IdleTimeout のみ）
+	MetricsFlushInterval time.Duration // メトリクスのシャードを全体値へ統合する間隔
+	MemStatsInterval     time.Duration // runtime.ReadMemStats の最小実行間隔（この間はキャッシュ値を返す）
+	HeartbeatInterval    time.Duration // ハートビートログの出力間隔（0 なら無効）
+	EnableWarmup         bool          // 待ち受け開始前にテンプレート描画・キャッシュ生成を行うか
+	WarmupDuration       time.Duration // 待ち受け開始後、ウォームアップ用リクエストのみ受け付ける期間（0 なら無効）
+	WarmupHeader         string        // ウォームアップ用リクエストを識別するヘッダー名（値が "true" のもの）
+	CanaryHeader         string        // カナリア検証用リクエストを識別するヘッダー名（空なら無効）
+
+	SigquitDump bool // SIGQUIT で診断ダンプを出力して処理を継続するか（false なら Go の既定動作: スタックを出力して終了）
+
+	TLSCertFile string // サーバー証明書ファイル（PEM）。TLS_KEY_FILE と併せて設定すると TLS で待ち受ける
+	TLSKeyFile  string // サーバー秘密鍵ファイル（PEM）
+	TLSClientCA string // クライアント証明書を検証する CA（PEM）。設定時は mTLS を必須とする
+	TLSSNICerts string // SNI で選択する追加の証明書（"cert.pem:key.pem" のカンマ区切り）
+
+	TLSReloadInterval time.Duration // 証明書ファイルの更新を確認する間隔（0 以下なら再読み込みしない）
+	TLSCipherSuites   []uint16      // TLS 1.2 以下で許可する暗号スイート（nil なら Go の安全な既定値）
+
+	// Kubernetes Downward API で渡されるポッド情報（構造化ログの共通フィールド）
+	PodName      string
+	PodNamespace string
+	NodeName     string
+
+	LogDest           string // ログ出力先（"stdout" または "stderr"）
+	LogErrorsToStderr bool   // エラーレベルのログのみ stderr へ振り分けるか
+	LogBody           bool   // アクセスログにリクエスト本文を含めるか（デバッグ用）
+	LogBodyMaxBytes   int    // アクセスログに含める本文の最大バイト数（0 以下なら本文を記録しない）
+
+	TraceContext      bool   // アクセスログに W3C traceparent のトレース ID・スパン ID を含めるか
+	CloudTrace        bool   // アクセスログに X-Cloud-Trace-Context のトレース ID を Cloud Logging の形式で含めるか
+	CloudTraceProject string // トレースのリソース名に使用する Google Cloud のプロジェクト ID
+
+	LogExcludePaths []string // アクセスログを出力しないパス（BASE_PATH を除いたパスと完全一致。メトリクスには計上する）
+
+	LogSinkBatchSize     int           // ログシンクへ1回に送るアクセスログの件数
+	LogSinkFlushInterval time.Duration // バッチが埋まらなくてもログシンクへ送信する間隔
+
+	AdminToken      string // 管理用エンドポイントの Bearer トークン（空なら管理用エンドポイント無効）
+	EnableChaos     bool   // 障害注入（カオス）系エンドポイントの有効化
+	EnableSynthetic bool   // SLO 訓練用の合成エンドポイント（/synthetic/）の有効化
+	DebugAllocMaxMB int    // /debug/alloc で保持できるメモリ総量の上限（MB）
+
+	DebugPayloadMaxBytes int64 // /debug/payload で返せる本文の上限（バイト）
+
+	Experiments            []experiment // A/B 実験の一覧（/debug/experiments で割り当てを確認できる）
+	ExperimentClientHeader string       // 実験の割り当てに使うクライアントIDのヘッダー名
+
+	DebugLogSize   int           // /debug/requests で保持する直近リクエストの件数（0 以下なら記録しない）
+	DebugLogMaxAge time.Duration // /debug/requests で保持する記録の最大経過時間（0 以下なら件数のみで破棄）
+}
+
+// currentConfig は現在有効なアプリケーション設定
+// SIGHUP によるリロードとハンドラーからの参照が並行するためアトミックに差し替える
+var currentConfig atomic.Pointer[Config]
+
+// 設定リロードの実績（運用者がリロードの反映を確認するためメトリクスで公開）
+var (
+	configReloadCount    int64 // 成功したリロード回数
+	lastConfigReloadUnix int64 // 最終リロード時刻（UnixNano、0 は未リロード）
+)
+
+func init() {
+	// main での読み込み前（テスト実行時など）でも安全に参照できるようデフォルト値を設定
+	setConfig(defaultConfig())
+}
+
+// cfg は現在有効な設定を返す
+func cfg() *Config {
+	return currentConfig.Load()
+}
+
+// setConfig は有効な設定を差し替える
+func setConfig(c Config) {
+	currentConfig.Store(&c)
+}
+
+// defaultConfig は環境変数未設定時のデフォルト設定を返す
+func defaultConfig() Config {
+	return Config{
+		Port:              "8080", // Golangの一般的なデフォルトポート
+		Version:           "1.0.0",
+		RolloutGeneration: "unknown",
+		HealthFormat:      healthFormatJSON,
+		CacheControl:      "no-store", // スクレイパー・プロキシによる監視データのキャッシュを防止
+		MetricsNamespace:  "sreworkflow",
+		StaticPrefix:      "/static/",
+		// ランディングページはスクリプト・スタイル・画像を使わないため、すべての読み込みを禁止する
+		RootCSP: "default-src 'none'; base-uri 'none'; form-action 'none'; frame-ancestors 'none'",
+
+		IdleTimeout:      60 * time.Second,
+		AdminIdleTimeout: 10 * time.Minute, // ダッシュボードの常時接続を切らないよう長めにする
+
+		HTTPCheckRetries:  2,
+		RetryBudget:       10,
+		RetryBudgetRefill: 1,
+
+		MaxBodyBytes:         1 << 20, // 1MiB
+		ExpectContinuePolicy: expectPolicyReject,
+
+		HandlerTimeout:       10 * time.Second, // WriteTimeout（15秒）より短くしてエラー応答を返せるようにする
+		HealthCheckDeadline:  1500 * time.Millisecond,
+		CheckTimeout:         time.Second, // 1件の遅延で全体の期限を使い切らないよう、全体の期限より短くする
+		ReadHeaderTimeout:    5 * time.Second,
+		ShutdownTimeout:      10 * time.Second, // Cloud Run の SIGTERM 猶予（10秒）に合わせる
+		AcceptMaxRetries:     5,
+		RequestIDFormat:      requestIDFormatUUID,
+		IdempotencyTTL:       time.Minute,
+		MetricsFlushInterval: time.Second,
+		MemStatsInterval:     time.Second,
+		WarmupHeader:         "X-Warmup",
+		CanaryHeader:         "X-Canary",
+
+		SigquitDump: true,
+
+		BackgroundCheckJitter: 0.1,
+		QueueTimeout:          5 * time.Second,
+
+		ExperimentClientHeader: "X-Client-ID",
+
+		RateLimitWindow:    time.Second,
+		RateLimitAlgorithm: rateLimitTokenBucket,
+
+		TLSReloadInterval: 30 * time.Second,
+
+		LogDest:         logDestStdout,
+		LogBodyMaxBytes: 1024,
+
+		LogSinkBatchSize:     100,
+		LogSinkFlushInterval: 5 * time.Second,
+
+		DebugAllocMaxMB: 1024,
+
+		DebugPayloadMaxBytes: 100 << 20, // 100MiB
+
+		DebugLogSize:   100,
+		DebugLogMaxAge: 5 * time.Minute,
+	}
+}
+
+// loadConfig は環境変数から設定を読み込む
+// 未設定の項目はデフォルト値を使用し、不正な値はエラーとして返す
+func loadConfig() (Config, error) {
+	c := defaultConfig()
+	c.Port = getEnv("PORT", c.Port)
+	if err := validatePort("PORT", c.Port); err != nil {
+		return c, err
+	}
+	c.IdleTimeout = getEnvDuration("IDLE_TIMEOUT", c.IdleTimeout)
+	if c.AdminPort = os.Getenv("ADMIN_PORT"); c.AdminPort != "" {
+		if err := validatePort("ADMIN_PORT", c.AdminPort); err != nil {
+			return c, err
+		}
+	}
+	c.AdminIdleTimeout = getEnvDuration("ADMIN_IDLE_TIMEOUT", c.AdminIdleTimeout)
+	c.BasePath = normalizeBasePath(os.Getenv("BASE_PATH"))
+	c.Version = getEnv("APP_VERSION", c.Version)
+	c.ExpectedVersion = os.Getenv("EXPECTED_VERSION")
+	c.HealthMessage = os.Getenv("HEALTH_MESSAGE")
+	c.HealthFormat = getEnv("HEALTH_FORMAT", c.HealthFormat)
+	if f := c.HealthFormat; f != healthFormatJSON && f != healthFormatText {
+		return c, fmt.Errorf("invalid HEALTH_FORMAT %q: must be %q or %q", f, healthFormatJSON, healthFormatText)
+	}
+	// 明示的な世代指定を優先し、なければ Cloud Run が自動設定するリビジョン名を使用
+	c.RolloutGeneration = getEnv("ROLLOUT_GENERATION", getEnv("K_REVISION", c.RolloutGeneration))
+
+	// CACHE_CONTROL は空文字を明示的に許可する（ヘッダー付与を無効化）
+	if v, ok := os.LookupEnv("CACHE_CONTROL"); ok {
+		c.CacheControl = v
+	}
+	c.RootCacheControl = os.Getenv("ROOT_CACHE_CONTROL")
+	c.JSONOmitEmpty = getEnvBool("JSON_OMIT_EMPTY", c.JSONOmitEmpty)
+	// METRICS_NAMESPACE は空文字を明示的に許可する（名前空間なし）
+	if v, ok := os.LookupEnv("METRICS_NAMESPACE"); ok {
+		if !validMetricsNamespace(v) {
+			return c, fmt.Errorf("invalid METRICS_NAMESPACE %q: must match [a-zA-Z_][a-zA-Z0-9_]*", v)
+		}
+		c.MetricsNamespace = v
+	}
+	// CONTENT_SECURITY_POLICY も空文字を明示的に許可する（ヘッダー付与を無効化）
+	if v, ok := os.LookupEnv("CONTENT_SECURITY_POLICY"); ok {
+		c.RootCSP = v
+	}
+	if path := os.Getenv("ERROR_PAGE_TEMPLATE"); path != "" {
+		tmpl, err := template.ParseFiles(path)
+		if err != nil {
+			return c, fmt.Errorf("invalid ERROR_PAGE_TEMPLATE: %w", err)
+		}
+		c.ErrorPageTemplate = tmpl
+	}
+	c.StaticDir = os.Getenv("STATIC_DIR")
+	if v := os.Getenv("STATIC_PREFIX"); v != "" {
+		prefix, err := normalizeStaticPrefix(v)
+		if err != nil {
+			return c, fmt.Errorf("invalid STATIC_PREFIX %q: %w", v, err)
+		}
+		c.StaticPrefix = prefix
+	}
+
+	c.HTTPCheckURLs = os.Getenv("HTTP_CHECK_URLS")
+	c.TCPCheckAddrs = os.Getenv("TCP_CHECK_ADDRS")
+	c.HTTPCheckOptionalURLs = os.Getenv("HTTP_CHECK_OPTIONAL_URLS")
+	if v := os.Getenv("DEGRADED_STATUS_CODE"); v != "" {
+		code, err := strconv.Atoi(v)
+		if err != nil || (code != http.StatusOK && code != http.StatusServiceUnavailable) {
+			return c, fmt.Errorf("invalid DEGRADED_STATUS_CODE %q: must be 200 or 503", v)
+		}
+		c.DegradedStatusCode = code
+	}
+	ttls, err := parseCheckCacheTTLs(os.Getenv("CHECK_CACHE_TTLS"))
+	if err != nil {
+		return c, fmt.Errorf("invalid CHECK_CACHE_TTLS: %w", err)
+	}
+	c.CheckCacheTTLs = ttls
+	c.DNSCacheTTL = getEnvDuration("DNS_CACHE_TTL", c.DNSCacheTTL)
+	c.BackgroundCheckInterval = getEnvDuration("BACKGROUND_CHECK_INTERVAL", c.BackgroundCheckInterval)
+	c.BackgroundCheckJitter = getEnvFloat("BACKGROUND_CHECK_JITTER", c.BackgroundCheckJitter)
+	c.WatchdogFailures = getEnvInt("WATCHDOG_FAILURES", c.WatchdogFailures)
+	if j := c.BackgroundCheckJitter; j < 0 || j > 1 {
+		return c, fmt.Errorf("invalid BACKGROUND_CHECK_JITTER %v: must be between 0 and 1", j)
+	}
+	c.HTTPCheckRetries = getEnvInt("HTTP_CHECK_RETRIES", c.HTTPCheckRetries)
+	c.RetryBudget = getEnvInt("RETRY_BUDGET", c.RetryBudget)
+	c.RetryBudgetRefill = getEnvFloat("RETRY_BUDGET_REFILL", c.RetryBudgetRefill)
+
+	proxies, err := parseCIDRList(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		return c, fmt.Errorf("invalid TRUSTED_PROXIES: %w", err)
+	}
+	c.TrustedProxies = proxies
+	redirects, err := parseRedirects(os.Getenv("REDIRECTS"))
+	if err != nil {
+		return c, fmt.Errorf("invalid REDIRECTS: %w", err)
+	}
+	c.Redirects = redirects
+	for _, h := range splitList(os.Getenv("ALLOWED_HOSTS")) {
+		c.AllowedHosts = append(c.AllowedHosts, strings.ToLower(h))
+	}
+	c.MaxInflightPerIP = getEnvInt("MAX_INFLIGHT_PER_IP", c.MaxInflightPerIP)
+	c.MaxConnections = getEnvInt("MAX_CONNECTIONS", c.MaxConnections)
+	c.DualStack = getEnvBool("DUAL_STACK", c.DualStack)
+	c.MaxConcurrentRequests = getEnvInt("MAX_CONCURRENT_REQUESTS", c.MaxConcurrentRequests)
+	c.QueueTimeout = getEnvDuration("QUEUE_TIMEOUT", c.QueueTimeout)
+	c.RateLimit = getEnvInt("RATE_LIMIT", c.RateLimit)
+	c.RateLimitWindow = getEnvDuration("RATE_LIMIT_WINDOW", c.RateLimitWindow)
+	c.RateLimitAlgorithm = getEnv("RATE_LIMIT_ALGORITHM", c.RateLimitAlgorithm)
+	if a := c.RateLimitAlgorithm; a != rateLimitTokenBucket && a != rateLimitSlidingWindow {
+		return c, fmt.Errorf("invalid RATE_LIMIT_ALGORITHM %q: must be %q or %q", a, rateLimitTokenBucket, rateLimitSlidingWindow)
+	}
+
+	c.StrictQuery = getEnvBool("STRICT_QUERY", c.StrictQuery)
+	c.StrictAccept = getEnvBool("STRICT_ACCEPT", c.StrictAccept)
+	experiments, err := parseExperiments(os.Getenv("EXPERIMENTS"))
+	if err != nil {
+		return c, fmt.Errorf("invalid EXPERIMENTS: %w", err)
+	}
+	c.Experiments = experiments
+	c.ExperimentClientHeader = getEnv("EXPERIMENT_CLIENT_HEADER", c.ExperimentClientHeader)
+	c.MaxBodyBytes = int64(getEnvInt("MAX_BODY_BYTES", int(c.MaxBodyBytes)))
+	c.ExpectContinuePolicy = getEnv("EXPECT_CONTINUE_POLICY", c.ExpectContinuePolicy)
+	if p := c.ExpectContinuePolicy; p != expectPolicyReject && p != expectPolicyAccept {
+		return c, fmt.Errorf("invalid EXPECT_CONTINUE_POLICY %q: must be %q or %q",
+			p, expectPolicyReject, expectPolicyAccept)
+	}
+
+	c.HandlerTimeout = getEnvDuration("HANDLER_TIMEOUT", c.HandlerTimeout)
+	c.ReadHeaderTimeout = getEnvDuration("READ_HEADER_TIMEOUT", c.ReadHeaderTimeout)
+	// HEALTH_CHECK_TIMEOUT は HEALTH_CHECK_DEADLINE の別名（両方設定時は HEALTH_CHECK_DEADLINE を優先）
+	c.HealthCheckDeadline = getEnvDuration("HEALTH_CHECK_DEADLINE", getEnvDuration("HEALTH_CHECK_TIMEOUT", c.HealthCheckDeadline))
+	c.CheckTimeout = getEnvDuration("CHECK_TIMEOUT", c.CheckTimeout)
+	c.ShutdownTimeout = getEnvDuration("SHUTDOWN_TIMEOUT", c.ShutdownTimeout)
+	if v := os.Getenv("SHUTDOWN_DELAY"); v != "" {
+		// LB の登録解除待ちを誤設定するとドレイン中もトラフィックが流れ続けるため、不正値はエラーにする
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return c, fmt.Errorf("invalid SHUTDOWN_DELAY %q: must be a non-negative duration", v)
+		}
+		c.ShutdownDelay = d
+	}
+	c.AcceptMaxRetries = getEnvInt("ACCEPT_MAX_RETRIES", c.AcceptMaxRetries)
+	c.KeepAliveIdle = getEnvDuration("KEEPALIVE_IDLE", c.KeepAliveIdle)
+	c.IdempotencyTTL = getEnvDuration("IDEMPOTENCY_TTL", c.IdempotencyTTL)
+	c.RequestIDFormat = strings.ToLower(getEnv("REQUEST_ID_FORMAT", c.RequestIDFormat))
+	if err := validateRequestIDFormat(c.RequestIDFormat); err != nil {
+		return c, err
+	}
+	c.MetricsFlushInterval = getEnvDuration("METRICS_FLUSH_INTERVAL", c.MetricsFlushInterval)
+	c.MemStatsInterval = getEnvDuration("MEMSTATS_INTERVAL", c.MemStatsInterval)
+	c.HeartbeatInterval = getEnvDuration("HEARTBEAT_INTERVAL", c.HeartbeatInterval)
+	c.SigquitDump = getEnvBool("SIGQUIT_DUMP", c.SigquitDump)
+	c.EnableWarmup = getEnvBool("ENABLE_WARMUP", c.EnableWarmup)
+	c.WarmupDuration = getEnvDuration("WARMUP_DURATION", c.WarmupDuration)
+	c.WarmupHeader = getEnv("WARMUP_HEADER", c.WarmupHeader)
+	// CANARY_HEADER は空文字を明示的に許可する（カナリア応答を無効化）
+	if v, ok := os.LookupEnv("CANARY_HEADER"); ok {
+		c.CanaryHeader = v
+	}
+
+	c.TLSCertFile = os.Getenv("TLS_CERT_FILE")
+	c.TLSKeyFile = os.Getenv("TLS_KEY_FILE")
+	c.TLSClientCA = os.Getenv("TLS_CLIENT_CA")
+	c.TLSSNICerts = os.Getenv("TLS_SNI_CERTS")
+	c.TLSReloadInterval = getEnvDuration("TLS_RELOAD_INTERVAL", c.TLSReloadInterval)
+	suites, err := parseCipherSuites(os.Getenv("TLS_CIPHER_SUITES"))
+	if err != nil {
+		return c, fmt.Errorf("invalid TLS_CIPHER_SUITES: %w", err)
+	}
+	c.TLSCipherSuites = suites
+
+	c.PodName = os.Getenv("POD_NAME")
+	c.PodNamespace = os.Getenv("POD_NAMESPACE")
+	c.NodeName = os.Getenv("NODE_NAME")
+
+	c.LogDest = strings.ToLower(getEnv("LOG_DEST", c.LogDest))
+	if c.LogDest != logDestStdout && c.LogDest != logDestStderr {
+		return c, fmt.Errorf("invalid LOG_DEST %q: must be %q or %q", c.LogDest, logDestStdout, logDestStderr)
+	}
+	c.LogErrorsToStderr = getEnvBool("LOG_ERRORS_TO_STDERR", c.LogErrorsToStderr)
+	c.LogBody = getEnvBool("LOG_BODY", c.LogBody)
+	c.LogBodyMaxBytes = getEnvInt("LOG_BODY_MAX_BYTES", c.LogBodyMaxBytes)
+	c.LogExcludePaths = splitList(os.Getenv("LOG_EXCLUDE_PATHS"))
+	c.TraceContext = getEnvBool("TRACE_CONTEXT", c.TraceContext)
+	c.CloudTrace = getEnvBool("CLOUD_TRACE", c.CloudTrace)
+	c.CloudTraceProject = os.Getenv("GOOGLE_CLOUD_PROJECT")
+	if c.CloudTrace && c.CloudTraceProject == "" {
+		return c, fmt.Errorf("CLOUD_TRACE requires GOOGLE_CLOUD_PROJECT")
+	}
+	c.LogSinkBatchSize = getEnvInt("LOG_SINK_BATCH_SIZE", c.LogSinkBatchSize)
+	c.LogSinkFlushInterval = getEnvDuration("LOG_SINK_FLUSH_INTERVAL", c.LogSinkFlushInterval)
+	if c.LogSinkFlushInterval <= 0 {
+		return c, fmt.Errorf("invalid LOG_SINK_FLUSH_INTERVAL %v: must be a positive duration", c.LogSinkFlushInterval)
+	}
+
+	c.AdminToken = os.Getenv("ADMIN_TOKEN")
+	c.EnableChaos = getEnvBool("ENABLE_CHAOS", c.EnableChaos)
+	c.EnableSynthetic = getEnvBool("ENABLE_SYNTHETIC", c.EnableSynthetic)
+	c.DebugAllocMaxMB = getEnvInt("DEBUG_ALLOC_MAX_MB", c.DebugAllocMaxMB)
+	c.DebugPayloadMaxBytes = int64(getEnvInt("DEBUG_PAYLOAD_MAX_BYTES", int(c.DebugPayloadMaxBytes)))
+	c.DebugLogSize = getEnvInt("DEBUG_LOG_SIZE", c.DebugLogSize)
+	c.DebugLogMaxAge = getEnvDuration("DEBUG_LOG_MAX_AGE", c.DebugLogMaxAge)
+	return c, nil
+}
+
+// validatePort はポート番号が 0〜65535 の整数であることを検証する
+// listen システムコールの分かりにくいエラーではなく、起動時に明確なエラーを出すため
+// 0 は OS による空きポートの自動割り当てとして許可する
+func validatePort(name, port string) error {
+	n, err := strconv.Atoi(port)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: must be an integer", name, port)
+	}
+	if n < 0 || n > 65535 {
+		return fmt.Errorf("invalid %s %q: must be between 0 and 65535", name, port)
+	}
+	return nil
+}
+
+// normalizeBasePath はベースパスを "/prefix" 形式（先頭スラッシュあり・末尾スラッシュなし）に正規化する
+// "/" や空文字はプレフィックスなしとして扱う
+func normalizeBasePath(p string) string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return ""
+	}
+	return "/" + p
+}
+
+// reloadConfig は設定を再読み込みして差し替え、リロード実績を記録する
+// 新しい設定が不正な場合は現在の設定を維持する
+func reloadConfig() {
+	c, err := loadConfig()
+	if err != nil {
+		log.Printf("Configuration reload failed, keeping current config: %v", err)
+		return
+	}
+	setConfig(c)
+	count := atomic.AddInt64(&configReloadCount, 1)
+	atomic.StoreInt64(&lastConfigReloadUnix, time.Now().UnixNano())
+	log.Printf("Configuration reloaded - Count: %d", count)
+}
+
+// watchReloadSignal は SIGHUP 受信時に設定をリロードするゴルーチンを開始する
+// プロセスを再起動せずに設定変更を反映する、デーモンの慣例に従う
+func watchReloadSignal() {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGHUP)
+	go func() {
+		for range sigCh {
+			reloadConfig()
+		}
+	}()
+}
+
+// getEnv は環境変数を取得し、未設定または空の場合はデフォルト値を返す
+func getEnv(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// getEnvBool は真偽値の環境変数を取得する
+// 解釈できない値の場合は警告を出してデフォルト値を返す
+func getEnvBool(key string, def bool) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Printf("Invalid boolean for %s: %q, using default %v", key, v, def)
+		return def
+	}
+	return b
+}
+
+// getEnvInt は整数の環境変数を取得する
+// 解釈できない値の場合は警告を出してデフォルト値を返す
+func getEnvInt(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("Invalid integer for %s: %q, using default %d", key, v, def)
+		return def
+	}
+	return n
+}
+
+// getEnvFloat は浮動小数点数の環境変数を取得する
+// 解釈できない値の場合は警告を出してデフォルト値を返す
+func getEnvFloat(key string, def float64) float64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		log.Printf("Invalid number for %s: %q, using default %v", key, v, def)
+		return def
+	}
+	return f
+}
+
+// getEnvDuration は time.ParseDuration 形式（例: "10s"）の環境変数を取得する
+// 解釈できない値の場合は警告を出してデフォルト値を返す
+func getEnvDuration(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("Invalid duration for %s: %q, using default %v", key, v, def)
+		return def
+	}
+	return d
+}
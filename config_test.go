@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withConfig はテスト中のみ有効な設定を適用し、終了時にデフォルトへ戻す
+func withConfig(t *testing.T, mutate func(c *Config)) {
+	t.Helper()
+	c := defaultConfig()
+	mutate(&c)
+	setConfig(c)
+	t.Cleanup(func() { setConfig(defaultConfig()) })
+}
+
+// mustLoadConfig は環境変数から設定を読み込み、エラー時はテストを失敗させる
+func mustLoadConfig(t *testing.T) Config {
+	t.Helper()
+	c, err := loadConfig()
+	if err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+	return c
+}
+
+// TestLoadConfigPortValidation はポート番号の検証テスト
+// 不正な PORT を listen 時ではなく設定読み込み時に検出することを保証
+func TestLoadConfigPortValidation(t *testing.T) {
+	tests := []struct {
+		port    string
+		wantErr bool
+	}{
+		{"8080", false},
+		{"0", false}, // OS による自動割り当て
+		{"65535", false},
+		{"abc", true},
+		{"-1", true},
+		{"65536", true},
+		{"99999", true},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("PORT", tt.port)
+		_, err := loadConfig()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("PORT=%q: got error %v, wantErr %v", tt.port, err, tt.wantErr)
+		}
+		if err != nil && !strings.Contains(err.Error(), "PORT") {
+			t.Errorf("PORT=%q: error should mention PORT: %v", tt.port, err)
+		}
+	}
+}
+
+// TestReloadConfigInvalidKeepsCurrent は不正な設定でのリロードが無視されることのテスト
+func TestReloadConfigInvalidKeepsCurrent(t *testing.T) {
+	withConfig(t, func(c *Config) { c.CacheControl = "private" })
+	before := configReloadCount
+
+	t.Setenv("PORT", "abc")
+	reloadConfig()
+
+	if cfg().CacheControl != "private" {
+		t.Errorf("Config should be kept on invalid reload, got '%s'", cfg().CacheControl)
+	}
+	if configReloadCount != before {
+		t.Errorf("Reload count should not increment on failure: got %d, before %d",
+			configReloadCount, before)
+	}
+}
+
+// TestConfigReloadMetrics は設定リロード実績がメトリクスに反映されることのテスト
+// 運用者がSIGHUPリロードの反映を確認できることを保証
+func TestConfigReloadMetrics(t *testing.T) {
+	t.Cleanup(func() { setConfig(defaultConfig()) })
+
+	scrape := func() MetricsResponse {
+		rr := httptest.NewRecorder()
+		metricsHandler(rr, httptest.NewRequest("GET", "/metrics", nil))
+		var m MetricsResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &m); err != nil {
+			t.Fatalf("Could not unmarshal response: %v", err)
+		}
+		return m
+	}
+
+	before := scrape()
+
+	// リロードを実行し、回数と時刻が更新されることを確認
+	t.Setenv("CACHE_CONTROL", "no-cache")
+	reloadConfig()
+	first := scrape()
+
+	if first.ConfigReloadCount != before.ConfigReloadCount+1 {
+		t.Errorf("Reload count should increment: got %d, before was %d",
+			first.ConfigReloadCount, before.ConfigReloadCount)
+	}
+	firstTime, err := time.Parse(time.RFC3339Nano, first.LastConfigReloadTime)
+	if err != nil {
+		t.Fatalf("Invalid reload timestamp format: %v", err)
+	}
+
+	// 新しい設定が反映されていることを確認
+	if cfg().CacheControl != "no-cache" {
+		t.Errorf("Reloaded config not applied: got '%s'", cfg().CacheControl)
+	}
+
+	// 2回目のリロードで時刻が進むことを確認
+	time.Sleep(2 * time.Millisecond)
+	reloadConfig()
+	second := scrape()
+
+	secondTime, err := time.Parse(time.RFC3339Nano, second.LastConfigReloadTime)
+	if err != nil {
+		t.Fatalf("Invalid reload timestamp format: %v", err)
+	}
+	if !secondTime.After(firstTime) {
+		t.Errorf("Reload timestamp should advance: first %v, second %v", firstTime, secondTime)
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"sync"
+)
+
+// AllocResponse はメモリ確保デバッグAPIのレスポンス構造体
+type AllocResponse struct {
+	HeldMB int `json:"held_mb"` // 現在保持しているメモリ総量（MB）
+}
+
+// DependenciesResponse は依存先レイテンシ計測APIのレスポンス構造体
+type DependenciesResponse struct {
+	Healthy      bool          `json:"healthy"`      // すべての依存先チェックが成功したか
+	Dependencies []CheckResult `json:"dependencies"` // 依存先ごとの結果とレイテンシ
+}
+
+// debugAlloc は OOM 検証のために意図的に保持しているメモリ
+// 解放エンドポイントが呼ばれるまで GC に回収されないよう参照を保持する
+var debugAlloc struct {
+	mu     sync.Mutex
+	chunks [][]byte
+}
+
+// debugAllocHeldMB は現在保持しているメモリ総量（MB）を返す
+func debugAllocHeldMB() int {
+	debugAlloc.mu.Lock()
+	defer debugAlloc.mu.Unlock()
+	return len(debugAlloc.chunks)
+}
+
+// debugAllocHandler は指定MB数のメモリを確保して保持するエンドポイント
+// OOM アラートやコンテナ再起動挙動の検証に使用（POST /debug/alloc?mb=N）
+func debugAllocHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, r, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	mb, err := strconv.Atoi(r.URL.Query().Get("mb"))
+	if err != nil || mb <= 0 {
+		writeError(w, r, "mb must be a positive integer", http.StatusBadRequest)
+		return
+	}
+
+	debugAlloc.mu.Lock()
+	held := len(debugAlloc.chunks)
+	// held+mb は巨大な mb でオーバーフローするため、残りの上限と比較する
+	if mb > cfg().DebugAllocMaxMB-held {
+		debugAlloc.mu.Unlock()
+		writeError(w, r, "allocation exceeds DEBUG_ALLOC_MAX_MB", http.StatusBadRequest)
+		return
+	}
+	for i := 0; i < mb; i++ {
+		chunk := make([]byte, 1<<20)
+		// ページを実際に確保させるため各ページに書き込む（RSS に反映させる）
+		for j := 0; j < len(chunk); j += 4096 {
+			chunk[j] = 1
+		}
+		debugAlloc.chunks = append(debugAlloc.chunks, chunk)
+	}
+	held = len(debugAlloc.chunks)
+	debugAlloc.mu.Unlock()
+	memStats.invalidate()
+
+	log.Printf("Debug allocation: +%dMB, holding %dMB", mb, held)
+	writeAllocResponse(w, held)
+}
+
+// payloadFiller は /debug/payload の本文として繰り返し書き込む埋め草
+var payloadFiller = bytes.Repeat([]byte("0123456789abcdef"), 2048) // 32KiB
+
+// debugPayloadHandler は指定バイト数の埋め草を返すエンドポイント
+// ネットワーク帯域の負荷試験に使用（GET /debug/payload?bytes=N）
+// 本文全体をメモリに確保せず、固定の埋め草を繰り返し書き込む
+func debugPayloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, r, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	n, err := strconv.ParseInt(r.URL.Query().Get("bytes"), 10, 64)
+	if err != nil || n < 0 {
+		writeError(w, r, "bytes must be a non-negative integer", http.StatusBadRequest)
+		return
+	}
+	if n > cfg().DebugPayloadMaxBytes {
+		writeError(w, r, "payload exceeds DEBUG_PAYLOAD_MAX_BYTES", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(n, 10))
+	w.WriteHeader(http.StatusOK)
+	for remaining := n; remaining > 0; {
+		chunk := payloadFiller
+		if remaining < int64(len(chunk)) {
+			chunk = chunk[:remaining]
+		}
+		written, err := w.Write(chunk)
+		if err != nil {
+			// クライアント切断・ハンドラータイムアウト
+			return
+		}
+		remaining -= int64(written)
+	}
+}
+
+// debugReleaseHandler は /debug/alloc で保持したメモリを解放するエンドポイント
+func debugReleaseHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, r, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	debugAlloc.mu.Lock()
+	released := len(debugAlloc.chunks)
+	debugAlloc.chunks = nil
+	debugAlloc.mu.Unlock()
+	memStats.invalidate()
+
+	log.Printf("Debug allocation released: %dMB", released)
+	writeAllocResponse(w, 0)
+}
+
+// writeAllocResponse はメモリ保持状況をJSONで返す
+func writeAllocResponse(w http.ResponseWriter, held int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(AllocResponse{HeldMB: held}); err != nil {
+		log.Printf("Error encoding alloc response: %v", err)
+	}
+}
+
+// debugDependenciesHandler は登録済みの依存先チェックを実行し、結果とレイテンシを返すエンドポイント
+// 依存先が「遅いが正常」か「停止」かを切り分けるデバッグに使用（GET /debug/dependencies）
+func debugDependenciesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, r, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	results, healthy := healthChecks.Run(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(DependenciesResponse{Healthy: healthy, Dependencies: results}); err != nil {
+		log.Printf("Error encoding dependencies response: %v", err)
+	}
+}
+
+// BuildInfoResponse はビルド情報APIのレスポンス構造体
+// Go がバイナリに埋め込むモジュール情報から取得するため、ldflags の指定がなくても利用できる
+type BuildInfoResponse struct {
+	GoVersion     string `json:"go_version"`             // ビルドに使用した Go のバージョン
+	Path          string `json:"path"`                   // main パッケージのパス
+	ModulePath    string `json:"module_path"`            // メインモジュールのパス
+	ModuleVersion string `json:"module_version"`         // メインモジュールのバージョン（ローカルビルドでは "(devel)"）
+	VCSRevision   string `json:"vcs_revision,omitempty"` // コミットハッシュ（vcs.revision）
+	VCSTime       string `json:"vcs_time,omitempty"`     // コミット時刻（vcs.time）
+	VCSModified   bool   `json:"vcs_modified,omitempty"` // 未コミットの変更を含むか（vcs.modified）
+}
+
+// readBuildInfo はビルド情報の取得関数（テストで差し替え可能）
+var readBuildInfo = debug.ReadBuildInfo
+
+// debugBuildInfoHandler は runtime/debug.ReadBuildInfo の内容を返すエンドポイント（GET /debug/buildinfo）
+func debugBuildInfoHandler(w http.ResponseWriter, r *http.Request) {
+	info, ok := readBuildInfo()
+	if !ok {
+		// モジュールモード以外でビルドされた場合はビルド情報が埋め込まれない
+		writeError(w, r, "build info not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	resp := BuildInfoResponse{
+		GoVersion:     info.GoVersion,
+		Path:          info.Path,
+		ModulePath:    info.Main.Path,
+		ModuleVersion: info.Main.Version,
+	}
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			resp.VCSRevision = s.Value
+		case "vcs.time":
+			resp.VCSTime = s.Value
+		case "vcs.modified":
+			resp.VCSModified = s.Value == "true"
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Error encoding build info response: %v", err)
+	}
+}
+
+// errRlimitUnsupported は getrlimit に対応しないプラットフォームであることを示す
+var errRlimitUnsupported = errors.New("getrlimit is not supported on this platform")
+
+// Rlimit はリソース制限のソフト・ハード上限（-1 は無制限）
+type Rlimit struct {
+	Soft int64 `json:"soft"` // ソフトリミット（実際に適用される上限）
+	Hard int64 `json:"hard"` // ハードリミット（ソフトリミットを引き上げられる上限）
+}
+
+// LimitsResponse はプロセスのリソース制限APIのレスポンス構造体
+type LimitsResponse struct {
+	Limits  map[string]Rlimit `json:"limits"`             // リソース名（"nofile"・"nproc" など）ごとの制限
+	OpenFDs *int64            `json:"open_fds,omitempty"` // オープン中のファイルディスクリプタ数（/proc 非対応環境では省略）
+}
+
+// debugLimitsHandler はプロセスのリソース制限と現在の FD 数を返すエンドポイント（GET /debug/limits）
+// "too many open files" 障害時に、上限と使用量を並べて確認するために使用
+// getrlimit のない非 Unix 環境では 501 を返す
+func debugLimitsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, r, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limits, err := readRlimits()
+	if errors.Is(err, errRlimitUnsupported) {
+		writeError(w, r, "resource limits are not supported on this platform", http.StatusNotImplemented)
+		return
+	}
+	if err != nil {
+		writeError(w, r, "Internal Server Error", http.StatusInternalServerError)
+		log.Printf("Error reading resource limits: %v", err)
+		return
+	}
+	resp := LimitsResponse{Limits: limits}
+	if resp.OpenFDs, err = openFDCount(); err != nil {
+		log.Printf("Error counting open file descriptors: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Error encoding limits response: %v", err)
+	}
+}
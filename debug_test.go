@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"runtime/debug"
+	"testing"
+	"time"
+)
+
+// TestDebugAlloc はメモリ確保・解放エンドポイントのテスト
+// OOM 検証用に確保したメモリがメトリクスに反映されることを保証
+func TestDebugAlloc(t *testing.T) {
+	withConfig(t, func(c *Config) {
+		c.AdminToken = "secret"
+		c.EnableChaos = true
+	})
+	handler := adminOnly(chaosOnly(debugAllocHandler))
+	release := adminOnly(chaosOnly(debugReleaseHandler))
+
+	scrapeMemory := func() int64 {
+		rr := httptest.NewRecorder()
+		metricsHandler(rr, httptest.NewRequest("GET", "/metrics", nil))
+		var m MetricsResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &m); err != nil {
+			t.Fatalf("Could not unmarshal response: %v", err)
+		}
+		return m.MemoryUsageMB
+	}
+
+	// 認証なしのリクエストは拒否される
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest("POST", "/debug/alloc?mb=1", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without token, got %d", rr.Code)
+	}
+
+	// 回収可能なゴミが基準値に含まれると確保後の GC で減って見えるため、先に回収してから測る
+	runtime.GC()
+	memStats.invalidate()
+	before := scrapeMemory()
+
+	req := httptest.NewRequest("POST", "/debug/alloc?mb=16", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rr = httptest.NewRecorder()
+	handler(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var resp AllocResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Could not unmarshal response: %v", err)
+	}
+	if resp.HeldMB != 16 {
+		t.Errorf("Expected 16MB held, got %d", resp.HeldMB)
+	}
+
+	// MB 単位への切り捨てと並行するテストの確保ぶんの揺らぎを許容する
+	const slackMB = 2
+	if after := scrapeMemory(); after < before+16-slackMB {
+		t.Errorf("Memory metric should reflect allocation: before %dMB, after %dMB", before, after)
+	}
+
+	// 保持量と足すとオーバーフローする巨大な mb も上限超過として拒否する
+	req = httptest.NewRequest("POST", "/debug/alloc?mb=9223372036854775807", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rr = httptest.NewRecorder()
+	handler(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an overflowing mb, got %d", rr.Code)
+	}
+	if held := debugAllocHeldMB(); held != 16 {
+		t.Errorf("Rejected allocation should not change held memory, got %dMB", held)
+	}
+
+	// 解放後は保持量が0になる
+	req = httptest.NewRequest("POST", "/debug/alloc/release", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rr = httptest.NewRecorder()
+	release(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200 on release, got %d", rr.Code)
+	}
+	if held := debugAllocHeldMB(); held != 0 {
+		t.Errorf("Expected 0MB held after release, got %d", held)
+	}
+}
+
+// TestDebugAllocChaosDisabled はカオス無効時にエンドポイントが隠蔽されることのテスト
+func TestDebugAllocChaosDisabled(t *testing.T) {
+	withConfig(t, func(c *Config) { c.AdminToken = "secret" })
+
+	req := httptest.NewRequest("POST", "/debug/alloc?mb=1", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rr := httptest.NewRecorder()
+	adminOnly(chaosOnly(debugAllocHandler))(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 when chaos disabled, got %d", rr.Code)
+	}
+}
+
+// TestDebugPayload は帯域試験用の本文を返すエンドポイントのテスト
+// 指定したサイズの本文と一致する Content-Length を返し、上限を超えるサイズは拒否することを保証
+func TestDebugPayload(t *testing.T) {
+	withConfig(t, func(c *Config) {
+		c.AdminToken = "secret"
+		c.EnableChaos = true
+		c.DebugPayloadMaxBytes = 1 << 20
+	})
+	handler := adminOnly(chaosOnly(debugPayloadHandler))
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/debug/payload?"+query, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	// 埋め草（32KiB）の繰り返しの途中で終わるサイズ
+	const size = 100000
+	rr := get("bytes=100000")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rr.Code)
+	}
+	if rr.Body.Len() != size {
+		t.Errorf("Expected %d bytes, got %d", size, rr.Body.Len())
+	}
+	if cl := rr.Header().Get("Content-Length"); cl != "100000" {
+		t.Errorf("Expected Content-Length 100000, got %q", cl)
+	}
+
+	for _, query := range []string{"bytes=2097152", "bytes=-1", "bytes=abc"} {
+		if rr := get(query); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, rr.Code)
+		}
+	}
+	if rr := get("bytes=0"); rr.Code != http.StatusOK || rr.Body.Len() != 0 {
+		t.Errorf("Expected empty 200 for bytes=0, got %d with %d bytes", rr.Code, rr.Body.Len())
+	}
+}
+
+// slowChecker は指定時間待ってから成功するテスト用の依存先チェック
+type slowChecker struct {
+	name  string
+	delay time.Duration
+}
+
+func (s *slowChecker) Name() string { return s.name }
+
+func (s *slowChecker) Check(ctx context.Context) error {
+	time.Sleep(s.delay)
+	return nil
+}
+
+// TestDebugDependencies は依存先レイテンシ計測エンドポイントのテスト
+// レイテンシの異なる依存先について、計測値の大小関係が正しく報告されることを保証
+func TestDebugDependencies(t *testing.T) {
+	withConfig(t, func(c *Config) { c.AdminToken = "secret" })
+	withCheckers(t,
+		&slowChecker{name: "slow", delay: 60 * time.Millisecond},
+		&slowChecker{name: "fast", delay: 5 * time.Millisecond},
+		&fakeChecker{name: "down", err: errors.New("connection refused")},
+	)
+	handler := adminOnly(debugDependenciesHandler)
+
+	// 認証なしのリクエストは拒否される
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest("GET", "/debug/dependencies", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without token, got %d", rr.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/debug/dependencies", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rr = httptest.NewRecorder()
+	handler(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rr.Code)
+	}
+
+	var resp DependenciesResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Could not unmarshal response: %v", err)
+	}
+	if resp.Healthy || len(resp.Dependencies) != 3 {
+		t.Fatalf("Expected 3 dependencies with one failure, got %+v", resp)
+	}
+
+	slow, fast, down := resp.Dependencies[0], resp.Dependencies[1], resp.Dependencies[2]
+	if slow.LatencyMs < 60 || fast.LatencyMs < 5 {
+		t.Errorf("Latency should cover check duration: slow %vms, fast %vms", slow.LatencyMs, fast.LatencyMs)
+	}
+	if slow.LatencyMs <= fast.LatencyMs || fast.LatencyMs <= down.LatencyMs {
+		t.Errorf("Latencies not ordered: slow %vms, fast %vms, down %vms",
+			slow.LatencyMs, fast.LatencyMs, down.LatencyMs)
+	}
+	// 「遅いが正常」と「停止」を区別できること
+	if slow.Status != checkStatusPass || down.Status != checkStatusFail || down.Error == "" {
+		t.Errorf("Unexpected statuses: %+v", resp.Dependencies)
+	}
+}
+
+// TestDebugBuildInfo はビルド情報エンドポイントのテスト
+// ldflags なしでも Go が埋め込むビルド情報（Go バージョンなど）を返すことを保証
+func TestDebugBuildInfo(t *testing.T) {
+	withConfig(t, func(c *Config) { c.AdminToken = "secret" })
+	handler := adminOnly(debugBuildInfoHandler)
+
+	req := httptest.NewRequest("GET", "/debug/buildinfo", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var resp BuildInfoResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Could not unmarshal response: %v", err)
+	}
+	if resp.GoVersion != runtime.Version() {
+		t.Errorf("Expected Go version %s, got '%s'", runtime.Version(), resp.GoVersion)
+	}
+
+	// ビルド情報が埋め込まれていない場合は 503
+	orig := readBuildInfo
+	readBuildInfo = func() (*debug.BuildInfo, bool) { return nil, false }
+	t.Cleanup(func() { readBuildInfo = orig })
+	rr = httptest.NewRecorder()
+	handler(rr, req)
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 without build info, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"syscall"
+)
+
+// eventDiagnosticDump は診断ダンプのログのイベント名（section でダンプの種類を区別する）
+const eventDiagnosticDump = "diagnostic.dump"
+
+// 診断ダンプのセクション
+const (
+	diagSectionMemStats   = "memstats"
+	diagSectionConfig     = "config"
+	diagSectionGoroutines = "goroutines"
+)
+
+// dumpDiagnostics はメモリ統計・設定・全ゴルーチンのスタックを構造化ログに出力する
+// 稼働中のプロセスを止めずに、ハングやリークの調査に必要な情報を取得するために使用する
+func dumpDiagnostics() {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	logger.Info(eventDiagnosticDump,
+		"section", diagSectionMemStats,
+		"heap_alloc_bytes", ms.HeapAlloc,
+		"heap_inuse_bytes", ms.HeapInuse,
+		"heap_objects", ms.HeapObjects,
+		"stack_inuse_bytes", ms.StackInuse,
+		"sys_bytes", ms.Sys,
+		"num_gc", ms.NumGC,
+		"gc_pause_total_ns", ms.PauseTotalNs)
+
+	// 管理用トークンと依存先 URL の認証情報（user:pass@）はログに残さない
+	c := *cfg()
+	if c.AdminToken != "" {
+		c.AdminToken = "[REDACTED]"
+	}
+	c.HTTPCheckURLs = redactURLList(c.HTTPCheckURLs)
+	c.HTTPCheckOptionalURLs = redactURLList(c.HTTPCheckOptionalURLs)
+	logger.Info(eventDiagnosticDump,
+		"section", diagSectionConfig,
+		"config", fmt.Sprintf("%+v", c))
+
+	logger.Info(eventDiagnosticDump,
+		"section", diagSectionGoroutines,
+		"count", runtime.NumGoroutine(),
+		"stacks", string(allGoroutineStacks()))
+}
+
+// redactURLList はカンマ区切りの URL 一覧からユーザー情報（user:pass@）を取り除く
+// 解析できない要素は認証情報を含み得るため、要素ごと伏せ字にする
+func redactURLList(list string) string {
+	if list == "" {
+		return list
+	}
+	parts := strings.Split(list, ",")
+	for i, p := range parts {
+		u, err := url.Parse(strings.TrimSpace(p))
+		switch {
+		case err != nil:
+			parts[i] = "[REDACTED]"
+		case u.User != nil:
+			u.User = nil
+			parts[i] = u.String()
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// allGoroutineStacks はすべてのゴルーチンのスタックトレースを返す（バッファに収まるまで拡張する）
+func allGoroutineStacks() []byte {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// watchDiagnosticSignal は SIGQUIT 受信時に診断ダンプを出力するゴルーチンを開始する
+// Go ランタイムの既定の SIGQUIT 処理（スタックを出力して終了）と異なり、ダンプ後も処理を継続する
+// 返り値の関数でシグナルの監視を停止する（既定の処理に戻る）
+func watchDiagnosticSignal() (stop func()) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGQUIT)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-sigCh:
+				dumpDiagnostics()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sigCh)
+		close(done)
+	}
+}
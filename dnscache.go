@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// eventDNSRefreshFailed は DNS キャッシュのバックグラウンド更新の失敗を記録するログのイベント名
+const eventDNSRefreshFailed = "dns.refresh_failed"
+
+// dnsCache は依存先チェックが接続するホスト名の名前解決結果のキャッシュ
+// TTL 切れのたびにチェックの中で名前解決するとレイテンシが跳ねるため、
+// 一度解決したホスト名は run のゴルーチンが TTL ごとに更新し、チェックは常にキャッシュを使う
+type dnsCache struct {
+	ttl    time.Duration                                            // 更新間隔
+	lookup func(ctx context.Context, host string) ([]string, error) // 差し替え可能な名前解決（テスト用）
+
+	mu    sync.Mutex
+	addrs map[string][]string // ホスト名ごとの IP アドレス
+}
+
+// newDNSCache は ttl ごとに更新する DNS キャッシュを作成する
+func newDNSCache(ttl time.Duration) *dnsCache {
+	return &dnsCache{
+		ttl:    ttl,
+		lookup: net.DefaultResolver.LookupHost,
+		addrs:  make(map[string][]string),
+	}
+}
+
+// checkDNSCache は依存先チェックで共有する DNS キャッシュ（nil ならキャッシュしない）
+var checkDNSCache *dnsCache
+
+// resolve は host の IP アドレスを返す
+// キャッシュにあればそのまま返し、初めてのホスト名のみ同期的に名前解決して以降の更新対象に加える
+func (d *dnsCache) resolve(ctx context.Context, host string) ([]string, error) {
+	d.mu.Lock()
+	addrs, ok := d.addrs[host]
+	d.mu.Unlock()
+	if ok {
+		return addrs, nil
+	}
+
+	addrs, err := d.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	d.mu.Lock()
+	d.addrs[host] = addrs
+	d.mu.Unlock()
+	return addrs, nil
+}
+
+// refresh はキャッシュ済みのすべてのホスト名を名前解決し直す
+// 失敗した場合は前回の結果を使い続ける（DNS の一時的な障害で依存先チェックを失敗させない）
+func (d *dnsCache) refresh(ctx context.Context) {
+	d.mu.Lock()
+	hosts := make([]string, 0, len(d.addrs))
+	for host := range d.addrs {
+		hosts = append(hosts, host)
+	}
+	d.mu.Unlock()
+
+	for _, host := range hosts {
+		addrs, err := d.lookup(ctx, host)
+		if err != nil || len(addrs) == 0 {
+			if ctx.Err() != nil {
+				return
+			}
+			if err == nil {
+				err = errors.New("no addresses")
+			}
+			logger.Warn(eventDNSRefreshFailed, "host", host, "error", err.Error())
+			continue
+		}
+		d.mu.Lock()
+		d.addrs[host] = addrs
+		d.mu.Unlock()
+	}
+}
+
+// run は ctx がキャンセルされるまで TTL ごとにキャッシュを更新する
+func (d *dnsCache) run(ctx context.Context) {
+	ticker := time.NewTicker(d.ttl)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			d.refresh(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// transport は接続先の名前解決にキャッシュを使う HTTPChecker 用のトランスポートを返す
+// TLS の SNI・証明書の検証には URL のホスト名がそのまま使われる
+func (d *dnsCache) transport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return d.dial(ctx, dialer, network, addr)
+	}
+	return t
+}
+
+// dial はキャッシュした IP アドレスへ順に接続を試みる（addr のホストが IP アドレスならそのまま接続する）
+func (d *dnsCache) dial(ctx context.Context, dialer *net.Dialer, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return dialer.DialContext(ctx, network, addr)
+	}
+	addrs, err := d.resolve(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range addrs {
+		var conn net.Conn
+		if conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(ip, port)); err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestDNSCacheBackgroundRefresh は依存先チェックの DNS キャッシュのテスト
+// 名前解決は初回とバックグラウンドの更新のみで行われ、更新中もチェックが名前解決を待たないことを保証
+func TestDNSCacheBackgroundRefresh(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	// 2回目以降（バックグラウンドの更新）の名前解決は release まで応答しない
+	var lookups atomic.Int64
+	release := make(chan struct{})
+	cache := newDNSCache(20 * time.Millisecond)
+	cache.lookup = func(ctx context.Context, host string) ([]string, error) {
+		if lookups.Add(1) > 1 {
+			select {
+			case <-release:
+			case <-ctx.Done():
+			}
+		}
+		return []string{"127.0.0.1"}, nil
+	}
+
+	checker := NewTCPChecker("tcp:db", net.JoinHostPort("db.internal", port))
+	checker.dns = cache
+	if err := checker.Check(context.Background()); err != nil {
+		t.Fatalf("First check should resolve and connect, got %v", err)
+	}
+	if got := lookups.Load(); got != 1 {
+		t.Fatalf("Expected 1 synchronous lookup on first use, got %d", got)
+	}
+
+	// TTL 経過後にバックグラウンドで名前解決が始まる
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go cache.run(ctx)
+	deadline := time.Now().Add(2 * time.Second)
+	for lookups.Load() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected background refresh to resolve the host again")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// 更新の名前解決が応答しない間も、チェックはキャッシュを使ってすぐに完了する
+	done := make(chan error, 1)
+	go func() { done <- checker.Check(context.Background()) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Check during refresh should use cached addresses, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Check should not wait for the resolver")
+	}
+	if got := lookups.Load(); got != 2 {
+		t.Errorf("Check should not call the resolver, got %d lookups", got)
+	}
+	close(release)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// drainNotifier はシャットダウン（ドレイン）の開始を長時間接続のハンドラーへ通知する
+// http.Server.Shutdown は処理中のハンドラーの完了を待つため、ロングポーリングや SSE の
+// ハンドラーはこの通知を受けてクライアントに再接続を促し、自ら応答を終える必要がある
+type drainNotifier struct {
+	once sync.Once
+	ch   chan struct{}
+}
+
+// newDrainNotifier は未通知の drainNotifier を作成する
+func newDrainNotifier() *drainNotifier {
+	return &drainNotifier{ch: make(chan struct{})}
+}
+
+// Done はドレイン開始時に閉じられるチャネルを返す
+func (d *drainNotifier) Done() <-chan struct{} {
+	return d.ch
+}
+
+// notify はドレインの開始を通知する（複数回呼んでも一度だけ通知する）
+func (d *drainNotifier) notify() {
+	d.once.Do(func() { close(d.ch) })
+}
+
+// serverDrain はアプリケーション全体で共有するドレイン通知（runServer が Shutdown の直前に通知する）
+var serverDrain = newDrainNotifier()
+
+// sseReconnectRetryMs はドレイン時にクライアントへ指示する再接続までの待機時間（ミリ秒）
+const sseReconnectRetryMs = 1000
+
+// streamEvents は events の内容を Server-Sent Events として送り続ける
+// クライアントの切断・events のクローズで終了し、ドレイン開始時は reconnect イベントを送ってから終了する
+// （EventSource は retry の間隔で自動的に再接続し、LB によって別のインスタンスへ振り分けられる）
+// ルートテーブルでは streaming を指定し、ハンドラータイムアウトでストリームが切られないようにする
+func streamEvents(w http.ResponseWriter, r *http.Request, events <-chan string) {
+	// ミドルウェアのラッパー越しに Flush できるよう http.ResponseController を使う
+	rc := http.NewResponseController(w)
+	// サーバーの WriteTimeout でストリームが切られないよう、書き込み期限を解除する
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		writeError(w, r, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+	flush := func() bool { return rc.Flush() == nil }
+
+	for {
+		select {
+		case data, ok := <-events:
+			if !ok {
+				return
+			}
+			fmt.Fprintf(w, "data: %s\n\n", strings.ReplaceAll(data, "\n", "\ndata: "))
+			if !flush() {
+				return
+			}
+		case <-serverDrain.Done():
+			fmt.Fprintf(w, "event: reconnect\nretry: %d\ndata: server is shutting down\n\n", sseReconnectRetryMs)
+			rc.Flush()
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
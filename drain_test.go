@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSSEReconnectOnDrain はドレイン時の SSE クライアントへの通知のテスト
+// 実際のルーター（共通ミドルウェア）越しにストリームが配信され、ハンドラータイムアウトで切られず、
+// シャットダウン開始時にストリームが閉じられる前に reconnect イベントが届くことを保証
+func TestSSEReconnectOnDrain(t *testing.T) {
+	logs := captureLogs(t)
+	t.Cleanup(func() { setReady(true) })
+	withConfig(t, func(c *Config) {
+		c.ShutdownDelay = 0
+		c.HandlerTimeout = 50 * time.Millisecond
+	})
+	orig := serverDrain
+	serverDrain = newDrainNotifier()
+	t.Cleanup(func() { serverDrain = orig })
+
+	events := make(chan string, 1)
+	events <- "hello"
+	origRoutes := routeTable
+	routeTable = func() []route {
+		return append(routes(), route{pattern: "/events", handler: func(w http.ResponseWriter, r *http.Request) {
+			streamEvents(w, r, events)
+		}, streaming: true})
+	}
+	t.Cleanup(func() { routeTable = origRoutes })
+	server := &http.Server{Addr: "127.0.0.1:0", Handler: newRouter()}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- runServer(ctx, server) }()
+
+	var addr string
+	deadline := time.Now().Add(2 * time.Second)
+	for addr == "" {
+		for _, e := range logs.entries(t) {
+			if e["msg"] == eventServerListening {
+				addr = e["addr"].(string)
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Server did not start listening in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	resp, err := http.Get("http://" + addr + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Expected text/event-stream, got %q", ct)
+	}
+
+	r := bufio.NewReader(resp.Body)
+	if line, _ := r.ReadString('\n'); line != "data: hello\n" {
+		t.Fatalf("Expected first event, got %q", line)
+	}
+	r.ReadString('\n')
+
+	// HANDLER_TIMEOUT を過ぎてもストリームは切られない
+	time.Sleep(100 * time.Millisecond)
+
+	// ストリーム接続中にシャットダウンを開始する
+	cancel()
+	var rest strings.Builder
+	for {
+		line, err := r.ReadString('\n')
+		rest.WriteString(line)
+		if err != nil {
+			break
+		}
+	}
+	if !strings.HasPrefix(rest.String(), "event: reconnect\nretry: 1000\n") {
+		t.Errorf("Expected reconnect event before stream close, got %q", rest.String())
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("runServer returned error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown should not wait for the stream after notifying the client")
+	}
+}
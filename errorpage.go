@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+)
+
+// defaultErrorPageTemplate はブラウザー向けエラーページの組み込みテンプレート
+// ERROR_PAGE_TEMPLATE で差し替えられる（.Status・.StatusText・.Message・.RequestID を参照可能）
+var defaultErrorPageTemplate = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head>
+    <title>{{.Status}} {{.StatusText}}</title>
+    <meta charset="UTF-8">
+</head>
+<body>
+    <h1>{{.Status}} {{.StatusText}}</h1>
+    <p>{{.Message}}</p>
+    {{if .RequestID}}<p>Request ID: <code>{{.RequestID}}</code></p>{{end}}
+</body>
+</html>`))
+
+// errorPageData はエラーページのテンプレートに渡す値
+type errorPageData struct {
+	Status     int
+	StatusText string
+	Message    string
+	RequestID  string
+}
+
+// ErrorResponse は API クライアント向けのエラーレスポンス
+type ErrorResponse struct {
+	Error     string `json:"error"`
+	Status    int    `json:"status"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// writeError は Accept ヘッダーに応じた形式でエラーレスポンスを返す
+// ブラウザー（text/html を優先）には HTML のエラーページ、application/json を求める API クライアントには JSON、
+// それ以外（Accept なし・*/* など）には従来どおり http.Error と同じプレーンテキストを返す
+func writeError(w http.ResponseWriter, r *http.Request, msg string, code int) {
+	switch negotiateContentType(r.Header.Get("Accept"), "text/plain", "application/json", "text/html") {
+	case "application/json":
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(ErrorResponse{
+			Error:     msg,
+			Status:    code,
+			RequestID: requestIDFromContext(r.Context()),
+		})
+	case "text/html":
+		writeErrorPage(w, r, msg, code)
+	default:
+		http.Error(w, msg, code)
+	}
+}
+
+// writeErrorPage はエラーページのテンプレートを描画して返す
+// 描画に失敗した場合はプレーンテキストにフォールバックする
+func writeErrorPage(w http.ResponseWriter, r *http.Request, msg string, code int) {
+	tmpl := cfg().ErrorPageTemplate
+	if tmpl == nil {
+		tmpl = defaultErrorPageTemplate
+	}
+	var buf bytes.Buffer
+	data := errorPageData{
+		Status:     code,
+		StatusText: http.StatusText(code),
+		Message:    msg,
+		RequestID:  requestIDFromContext(r.Context()),
+	}
+	if err := tmpl.Execute(&buf, data); err != nil {
+		log.Printf("Error rendering error page: %v", err)
+		http.Error(w, msg, code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// エラーページもランディングページと同じ CSP で外部リソースの読み込みを禁止する
+	if csp := cfg().RootCSP; csp != "" {
+		w.Header().Set("Content-Security-Policy", csp)
+	}
+	w.WriteHeader(code)
+	buf.WriteTo(w)
+}
+
+// writeNotFound は http.NotFound と同じ 404 を Accept に応じた形式で返す
+func writeNotFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, "404 page not found", http.StatusNotFound)
+}
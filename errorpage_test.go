@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestErrorContentNegotiation はブラウザーには HTML、API クライアントには JSON のエラーを返すことを確認する
+func TestErrorContentNegotiation(t *testing.T) {
+	captureLogs(t)
+	withConfig(t, func(c *Config) { c.StrictQuery = true })
+	router := newRouter()
+	get := func(accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/healthz?verbos=true", nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("Accept %q: expected 400, got %d", accept, rr.Code)
+		}
+		return rr
+	}
+
+	// ブラウザーの典型的な Accept ヘッダー
+	rr := get("text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Browser: expected text/html, got %q", ct)
+	}
+	if body := rr.Body.String(); !strings.Contains(body, "<h1>400 Bad Request</h1>") || !strings.Contains(body, "unknown query parameter") {
+		t.Errorf("Browser: unexpected error page: %s", body)
+	}
+	if rr.Header().Get("Content-Security-Policy") == "" {
+		t.Error("Browser: expected Content-Security-Policy on error page")
+	}
+
+	rr = get("application/json")
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("API client: expected application/json, got %q", ct)
+	}
+	var resp ErrorResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("API client: invalid JSON: %v", err)
+	}
+	if resp.Status != http.StatusBadRequest || !strings.Contains(resp.Error, "unknown query parameter") || resp.RequestID == "" {
+		t.Errorf("API client: unexpected error response: %+v", resp)
+	}
+
+	// Accept なしは従来どおりプレーンテキスト
+	rr = get("")
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("No Accept: expected text/plain, got %q", ct)
+	}
+}
+
+// TestErrorPageTemplate は ERROR_PAGE_TEMPLATE のテンプレートでエラーページを描画することを確認する
+func TestErrorPageTemplate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "error.html")
+	if err := os.WriteFile(path, []byte(`<p class="custom">{{.Status}}: {{.Message}}</p>`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ERROR_PAGE_TEMPLATE", path)
+	c := mustLoadConfig(t)
+	withConfig(t, func(cc *Config) { cc.ErrorPageTemplate = c.ErrorPageTemplate })
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept", "text/html")
+	rr := httptest.NewRecorder()
+	writeError(rr, req, "<boom>", http.StatusServiceUnavailable)
+	if want := `<p class="custom">503: &lt;boom&gt;</p>`; rr.Body.String() != want {
+		t.Errorf("Expected %q, got %q", want, rr.Body.String())
+	}
+
+	t.Setenv("ERROR_PAGE_TEMPLATE", filepath.Join(t.TempDir(), "missing.html"))
+	if _, err := loadConfig(); err == nil {
+		t.Error("Expected error for missing ERROR_PAGE_TEMPLATE")
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// 実験の割り当て結果
+const (
+	experimentTreatment = "treatment" // 実験群
+	experimentControl   = "control"   // 対照群
+)
+
+// experiment は A/B 実験の定義
+type experiment struct {
+	name    string
+	percent int // 実験群に割り当てるクライアントの割合（0〜100）
+}
+
+// parseExperiments は "name=percent" のカンマ区切り一覧を解析する
+func parseExperiments(s string) ([]experiment, error) {
+	var out []experiment
+	seen := make(map[string]bool)
+	for _, pair := range splitList(s) {
+		name, v, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		percent, err := strconv.Atoi(strings.TrimSpace(v))
+		if !ok || name == "" || err != nil || percent < 0 || percent > 100 {
+			return nil, fmt.Errorf("invalid entry %q: expected name=percent (0-100)", pair)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate experiment %q", name)
+		}
+		seen[name] = true
+		out = append(out, experiment{name: name, percent: percent})
+	}
+	return out, nil
+}
+
+// experimentBucket はクライアントを実験ごとに 0〜99 のバケットへ割り当てる
+// 実験名とクライアントIDのハッシュで決めるため、同じクライアントは常に同じバケットになり、
+// 実験ごとの割り当ては互いに独立する
+func experimentBucket(name, clientID string) int {
+	h := fnv.New32a()
+	h.Write([]byte(name + "\x00" + clientID))
+	return int(h.Sum32() % 100)
+}
+
+// ExperimentAssignment は1つの実験に対するクライアントの割り当て
+type ExperimentAssignment struct {
+	Name    string `json:"name"`    // 実験名
+	Percent int    `json:"percent"` // 実験群の割合（%）
+	Bucket  int    `json:"bucket"`  // クライアントのバケット（0〜99、percent 未満なら実験群）
+	Variant string `json:"variant"` // "treatment" または "control"
+}
+
+// ExperimentsResponse は実験割り当てAPIのレスポンス構造体
+type ExperimentsResponse struct {
+	ClientID    string                 `json:"client_id"`   // 割り当てに使用したクライアントID
+	Experiments []ExperimentAssignment `json:"experiments"` // 実験ごとの割り当て
+}
+
+// assignExperiments は clientID に対する全実験の割り当てを返す
+func assignExperiments(experiments []experiment, clientID string) []ExperimentAssignment {
+	out := make([]ExperimentAssignment, 0, len(experiments))
+	for _, e := range experiments {
+		a := ExperimentAssignment{Name: e.name, Percent: e.percent, Bucket: experimentBucket(e.name, clientID), Variant: experimentControl}
+		if a.Bucket < e.percent {
+			a.Variant = experimentTreatment
+		}
+		out = append(out, a)
+	}
+	return out
+}
+
+// debugExperimentsHandler はリクエスト元クライアントの実験割り当てを返すエンドポイント（GET /debug/experiments）
+// クライアントは EXPERIMENT_CLIENT_HEADER（既定 X-Client-ID）で識別する
+func debugExperimentsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, r, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	header := cfg().ExperimentClientHeader
+	clientID := r.Header.Get(header)
+	if clientID == "" {
+		writeError(w, r, header+" header is required", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	resp := ExperimentsResponse{ClientID: clientID, Experiments: assignExperiments(cfg().Experiments, clientID)}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Error encoding experiments response: %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestExperimentBucketingConsistent は実験の割り当てのテスト
+// 同じクライアントIDは常に同じバケットに割り当てられ、割合がおおむね設定どおりになることを保証
+func TestExperimentBucketingConsistent(t *testing.T) {
+	captureLogs(t)
+	experiments, err := parseExperiments("new-ui=20, fast-path=50")
+	if err != nil {
+		t.Fatal(err)
+	}
+	withConfig(t, func(c *Config) {
+		c.AdminToken = "secret"
+		c.Experiments = experiments
+	})
+	router := newRouter()
+	get := func(clientID string) ExperimentsResponse {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/debug/experiments", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		req.Header.Set("X-Client-ID", clientID)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var resp ExperimentsResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Could not unmarshal response: %v", err)
+		}
+		return resp
+	}
+
+	first := get("user-42")
+	if len(first.Experiments) != 2 || first.Experiments[0].Name != "new-ui" {
+		t.Fatalf("Unexpected assignments: %+v", first)
+	}
+	for i := 0; i < 5; i++ {
+		again := get("user-42")
+		for j := range first.Experiments {
+			if again.Experiments[j] != first.Experiments[j] {
+				t.Errorf("Assignment changed for the same client: %+v != %+v", again.Experiments[j], first.Experiments[j])
+			}
+		}
+	}
+
+	treated := 0
+	for i := 0; i < 1000; i++ {
+		if assignExperiments(experiments, fmt.Sprintf("user-%d", i))[0].Variant == experimentTreatment {
+			treated++
+		}
+	}
+	if treated < 150 || treated > 250 {
+		t.Errorf("Expected about 20%% of clients in treatment, got %d/1000", treated)
+	}
+}
+
+// TestParseExperiments は EXPERIMENTS の検証テスト
+func TestParseExperiments(t *testing.T) {
+	for _, bad := range []string{"new-ui", "new-ui=101", "new-ui=-1", "=20", "a=10,a=20"} {
+		if _, err := parseExperiments(bad); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HealthChecker は依存先（DB・外部APIなど）の疎通確認インターフェース
+// /health?deep=true の深いヘルスチェックで実行される
+type HealthChecker interface {
+	Name() string                    // チェック名（レスポンスのキーとして使用）
+	Check(ctx context.Context) error // 正常なら nil を返す
+}
+
+// OptionalChecker は失敗してもサービス停止とはみなさない依存先チェック
+// Optional() が true のチェックの失敗は "degraded"（機能低下）として扱う
+type OptionalChecker interface {
+	Optional() bool
+}
+
+// CachedChecker は結果を一定期間キャッシュできる依存先チェック
+// チェックのコストは依存先ごとに異なるため（安価な DB の ping と高価な外部 API 呼び出しなど）、
+// CacheTTL() の期間内は前回の結果を再利用して依存先への負荷を抑える（0 以下ならキャッシュしない）
+type CachedChecker interface {
+	CacheTTL() time.Duration
+}
+
+// cacheTTL はチェック結果のキャッシュ期間を返す（キャッシュしない場合は 0）
+func cacheTTL(c HealthChecker) time.Duration {
+	if cc, ok := c.(CachedChecker); ok {
+		return cc.CacheTTL()
+	}
+	return 0
+}
+
+// isOptional はチェックが任意（失敗時に degraded 扱い）かを判定する
+func isOptional(c HealthChecker) bool {
+	o, ok := c.(OptionalChecker)
+	return ok && o.Optional()
+}
+
+// サービス全体の状態
+const (
+	healthStatusHealthy   = "healthy"
+	healthStatusDegraded  = "degraded"  // 任意の依存先のみ失敗
+	healthStatusUnhealthy = "unhealthy" // 必須の依存先が失敗
+
+	healthStatusShuttingDown = "shutting_down" // シャットダウン開始後（ドレイン中）
+)
+
+// overallStatus はチェック結果からサービス全体の状態を判定する
+func overallStatus(results []CheckResult) string {
+	status := healthStatusHealthy
+	for _, r := range results {
+		if r.Status == checkStatusPass {
+			continue
+		}
+		if !r.Optional {
+			return healthStatusUnhealthy
+		}
+		status = healthStatusDegraded
+	}
+	return status
+}
+
+// degradedStatusCode は degraded 状態で返す HTTP ステータスコードを返す
+// DEGRADED_STATUS_CODE 未設定時は、liveness では 200（再起動させない）、
+// readiness では 503（振り分け対象から外す）を返す
+func degradedStatusCode(liveness bool) int {
+	if code := cfg().DegradedStatusCode; code != 0 {
+		return code
+	}
+	if liveness {
+		return http.StatusOK
+	}
+	return http.StatusServiceUnavailable
+}
+
+// /health のレスポンス形式（HEALTH_FORMAT）
+const (
+	healthFormatJSON = "json" // HealthResponse の JSON
+	healthFormatText = "text" // "OK" または "FAIL" のみ（固定文字列を期待する旧来の監視ツール向け）
+)
+
+// healthProduces は HEALTH_FORMAT に応じた /health の応答メディアタイプを返す
+func healthProduces() []string {
+	if cfg().HealthFormat == healthFormatText {
+		return producesText
+	}
+	return producesJSON
+}
+
+// writeHealthText は /health の結果をテキスト形式で書き込む
+// ステータスコードは JSON 形式と同じで、エラー応答（4xx・5xx）なら "FAIL"、それ以外は "OK" を返す
+func writeHealthText(w http.ResponseWriter, status int) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	setCacheControl(w)
+	w.WriteHeader(status)
+	if status >= http.StatusBadRequest {
+		fmt.Fprint(w, "FAIL")
+		return
+	}
+	fmt.Fprint(w, "OK")
+}
+
+// チェック結果のステータス
+const (
+	checkStatusPass    = "pass"
+	checkStatusFail    = "fail"
+	checkStatusTimeout = "timeout" // HEALTH_CHECK_DEADLINE までに完了しなかった
+)
+
+// CheckResult は個々の依存先チェック結果
+type CheckResult struct {
+	Name   string `json:"name"`            // チェック名
+	Status string `json:"status"`          // "pass"、"fail" または "timeout"
+	Error  string `json:"error,omitempty"` // 失敗時のエラー内容
+
+	LatencyMs float64 `json:"latency_ms"`         // チェックに要した時間（ミリ秒）
+	Optional  bool    `json:"optional,omitempty"` // 任意の依存先か（失敗時は degraded 扱い）
+	Cached    bool    `json:"cached,omitempty"`   // キャッシュ済みの結果を返したか
+}
+
+// cachedResult はキャッシュしたチェック結果と有効期限
+type cachedResult struct {
+	res     CheckResult
+	expires time.Time
+}
+
+// checkRegistry は登録された依存先チェックの一覧
+type checkRegistry struct {
+	mu       sync.RWMutex
+	checkers []HealthChecker
+
+	cacheMu sync.Mutex
+	cache   map[string]cachedResult // チェック名ごとの直近の結果（CachedChecker のみ）
+	now     func() time.Time        // キャッシュの有効期限の判定に使う時計（テスト用。nil なら time.Now）
+
+	// キャッシュの効果を確認するための集計（キャッシュ期間が設定されたチェックのみ計上）
+	cacheHits   atomic.Int64
+	cacheMisses atomic.Int64
+}
+
+// healthChecks はアプリケーション全体で共有する依存先チェックの登録先
+var healthChecks = &checkRegistry{}
+
+// Register は依存先チェックを登録する
+func (reg *checkRegistry) Register(c HealthChecker) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.checkers = append(reg.checkers, c)
+}
+
+// clock はキャッシュの有効期限の判定に使う現在時刻を返す
+func (reg *checkRegistry) clock() time.Time {
+	if reg.now != nil {
+		return reg.now()
+	}
+	return time.Now()
+}
+
+// Run はすべてのチェックを並行に実行し、登録順の結果と全体の成否を返す
+// HEALTH_CHECK_DEADLINE を全体の期限とし、期限までに完了したチェックの結果を返す
+// 期限内に完了しなかったチェックは "timeout" として扱い、プローブのレイテンシを期限内に抑える
+func (reg *checkRegistry) Run(ctx context.Context) ([]CheckResult, bool) {
+	reg.mu.RLock()
+	checkers := append([]HealthChecker(nil), reg.checkers...)
+	reg.mu.RUnlock()
+
+	if d := cfg().HealthCheckDeadline; d > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+
+	type indexed struct {
+		i   int
+		res CheckResult
+	}
+	// 期限後に完了したチェックがブロックしないようバッファを確保する
+	done := make(chan indexed, len(checkers))
+	start := time.Now()
+	results := make([]CheckResult, len(checkers))
+	finished := make([]bool, len(checkers))
+	pending := 0
+	cacheNow := reg.clock()
+	for i, c := range checkers {
+		if res, ok := reg.cached(c, cacheNow); ok {
+			results[i], finished[i] = res, true
+			continue
+		}
+		pending++
+		go func(i int, c HealthChecker) {
+			res := runCheck(ctx, c)
+			reg.store(c, res)
+			done <- indexed{i, res}
+		}(i, c)
+	}
+
+collect:
+	for remaining := pending; remaining > 0; remaining-- {
+		select {
+		case d := <-done:
+			results[d.i], finished[d.i] = d.res, true
+		case <-ctx.Done():
+			break collect
+		}
+	}
+
+	healthy := true
+	for i, c := range checkers {
+		if !finished[i] {
+			results[i] = CheckResult{
+				Name:      c.Name(),
+				Status:    checkStatusTimeout,
+				Error:     ctx.Err().Error(),
+				LatencyMs: float64(time.Since(start)) / float64(time.Millisecond),
+				Optional:  isOptional(c),
+			}
+		}
+		if results[i].Status != checkStatusPass {
+			healthy = false
+		}
+	}
+	return results, healthy
+}
+
+// cached は有効期限内のキャッシュ済み結果を返す
+func (reg *checkRegistry) cached(c HealthChecker, now time.Time) (CheckResult, bool) {
+	if cacheTTL(c) <= 0 {
+		return CheckResult{}, false
+	}
+	reg.cacheMu.Lock()
+	defer reg.cacheMu.Unlock()
+	e, ok := reg.cache[c.Name()]
+	if !ok || !now.Before(e.expires) {
+		reg.cacheMisses.Add(1)
+		return CheckResult{}, false
+	}
+	reg.cacheHits.Add(1)
+	res := e.res
+	res.Cached = true
+	return res, true
+}
+
+// store はチェック結果をチェックごとの TTL でキャッシュする
+// 全体の期限切れで中断された結果（timeout）は依存先の状態を表さないためキャッシュしない
+func (reg *checkRegistry) store(c HealthChecker, res CheckResult) {
+	ttl := cacheTTL(c)
+	if ttl <= 0 || res.Status == checkStatusTimeout {
+		return
+	}
+	reg.cacheMu.Lock()
+	defer reg.cacheMu.Unlock()
+	if reg.cache == nil {
+		reg.cache = make(map[string]cachedResult)
+	}
+	reg.cache[c.Name()] = cachedResult{res: res, expires: reg.clock().Add(ttl)}
+}
+
+// runCheck は1つのチェックを実行し、結果とレイテンシを返す
+// CHECK_TIMEOUT を期限とする子コンテキストを渡し、期限を過ぎたら依存先への通信を中断させる
+func runCheck(ctx context.Context, c HealthChecker) CheckResult {
+	if d := cfg().CheckTimeout; d > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+	res := CheckResult{Name: c.Name(), Status: checkStatusPass, Optional: isOptional(c)}
+	start := time.Now()
+	err := c.Check(ctx)
+	// 「遅いが正常」と「停止」を区別できるよう、成否にかかわらずレイテンシを記録する
+	res.LatencyMs = float64(time.Since(start)) / float64(time.Millisecond)
+	switch {
+	case err == nil:
+	case errors.Is(err, context.DeadlineExceeded):
+		res.Status = checkStatusTimeout
+		res.Error = err.Error()
+	default:
+		res.Status = checkStatusFail
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// notReady はシャットダウン開始後にレディネスを落とすためのフラグ
+// ゼロ値（false）をレディ状態として扱う
+var notReady atomic.Bool
+
+// setReady はレディネス状態を切り替える
+func setReady(ready bool) {
+	notReady.Store(!ready)
+}
+
+// readyHandler はレディネスプローブ用エンドポイント
+// シャットダウン開始後は 503 を返し、LB に新規リクエストの振り分けを止めさせる
+// プロセス生存の確認（/health）とは分離し、ドレイン中にコンテナが再起動されないようにする
+// ?deep=true の場合は依存先チェックも実行し、degraded 時は DEGRADED_STATUS_CODE（既定 503）を返す
+func readyHandler(w http.ResponseWriter, r *http.Request) {
+	health := HealthResponse{
+		Status:     "ready",
+		Timestamp:  time.Now().Format(time.RFC3339),
+		Version:    cfg().Version,
+		Generation: cfg().RolloutGeneration,
+		Canary:     isCanary(r.Context()),
+	}
+	status := http.StatusOK
+	if deep, _ := strconv.ParseBool(r.URL.Query().Get("deep")); deep {
+		health.Checks, _ = healthChecks.Run(r.Context())
+		switch overallStatus(health.Checks) {
+		case healthStatusUnhealthy:
+			health.Status = healthStatusUnhealthy
+			status = http.StatusServiceUnavailable
+		case healthStatusDegraded:
+			health.Status = healthStatusDegraded
+			status = degradedStatusCode(false)
+		}
+	}
+	if notReady.Load() {
+		health.Status = healthStatusShuttingDown
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	setCacheControl(w)
+	w.WriteHeader(status)
+	if err := encodeResponse(w, health); err != nil {
+		log.Printf("Error encoding ready response: %v", err)
+	}
+}
+
+// healthzHandler は Kubernetes 形式のヘルスチェックエンドポイント
+// liveness プローブとして使われるため、既定では依存先チェックを実行せずプロセスの生存のみを返す
+// （依存先の障害で全 Pod が再起動されるのを防ぐ）。?deep=true の場合のみ依存先チェックを実行する
+// プレーンテキストで "ok" または失敗内容を返す
+// ?verbose の場合はチェックごとに "[+]name ok" / "[-]name failed: reason" を列挙し、
+// 最終行に "healthz check passed" / "healthz check failed" を出力する
+// 依存先チェックを実行しない場合は、プロセスの生存を示す "[+]ping ok" のみを列挙する
+// 任意の依存先の失敗は degraded として扱い、DEGRADED_STATUS_CODE（既定 200）に従う
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	var results []CheckResult
+	deep, _ := strconv.ParseBool(r.URL.Query().Get("deep"))
+	if deep {
+		results, _ = healthChecks.Run(r.Context())
+	}
+	status := http.StatusOK
+	switch overallStatus(results) {
+	case healthStatusUnhealthy:
+		status = http.StatusServiceUnavailable
+	case healthStatusDegraded:
+		status = degradedStatusCode(true)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	setCacheControl(w)
+	w.WriteHeader(status)
+
+	_, verbose := r.URL.Query()["verbose"]
+	if !verbose && status == http.StatusOK {
+		fmt.Fprint(w, "ok")
+		return
+	}
+	if !deep {
+		fmt.Fprintln(w, "[+]ping ok")
+	}
+	for _, res := range results {
+		if res.Status == checkStatusPass {
+			fmt.Fprintf(w, "[+]%s ok\n", res.Name)
+			continue
+		}
+		suffix := ""
+		if res.Optional {
+			suffix = " (optional)"
+		}
+		fmt.Fprintf(w, "[-]%s %s%s: %s\n", res.Name, res.Status, suffix, res.Error)
+	}
+	if status == http.StatusOK {
+		fmt.Fprintln(w, "healthz check passed")
+	} else {
+		fmt.Fprintln(w, "healthz check failed")
+	}
+}
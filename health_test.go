@@ -0,0 +1,412 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeChecker はテスト用の依存先チェック
+// 呼び出し回数を記録し、設定されたエラーを返す
+type fakeChecker struct {
+	name  string
+	err   error
+	calls int64
+}
+
+func (f *fakeChecker) Name() string { return f.name }
+
+func (f *fakeChecker) Check(ctx context.Context) error {
+	atomic.AddInt64(&f.calls, 1)
+	return f.err
+}
+
+// withCheckers はテスト中のみ依存先チェックの登録先を差し替える
+func withCheckers(t *testing.T, checkers ...HealthChecker) {
+	t.Helper()
+	orig := healthChecks
+	healthChecks = &checkRegistry{}
+	for _, c := range checkers {
+		healthChecks.Register(c)
+	}
+	t.Cleanup(func() { healthChecks = orig })
+}
+
+// TestHealthShallowAndDeep は浅い/深いヘルスチェックの切り替えテスト
+// 依存先チェックは ?deep=true の場合のみ実行されることを保証
+func TestHealthShallowAndDeep(t *testing.T) {
+	db := &fakeChecker{name: "database"}
+	withCheckers(t, db)
+
+	// 浅いチェック（デフォルト）では依存先チェックを実行しない
+	rr := httptest.NewRecorder()
+	healthHandler(rr, httptest.NewRequest("GET", "/health", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("Shallow: expected 200, got %d", rr.Code)
+	}
+	if calls := atomic.LoadInt64(&db.calls); calls != 0 {
+		t.Errorf("Shallow: dependency check should not run, got %d calls", calls)
+	}
+
+	var health HealthResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &health); err != nil {
+		t.Fatalf("Could not unmarshal response: %v", err)
+	}
+	if len(health.Checks) != 0 {
+		t.Errorf("Shallow: expected no checks in response, got %v", health.Checks)
+	}
+
+	// 深いチェックでは依存先チェックを実行して結果を返す
+	rr = httptest.NewRecorder()
+	healthHandler(rr, httptest.NewRequest("GET", "/health?deep=true", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("Deep: expected 200, got %d", rr.Code)
+	}
+	if calls := atomic.LoadInt64(&db.calls); calls != 1 {
+		t.Errorf("Deep: dependency check should run once, got %d calls", calls)
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &health); err != nil {
+		t.Fatalf("Could not unmarshal response: %v", err)
+	}
+	if len(health.Checks) != 1 || health.Checks[0].Status != checkStatusPass {
+		t.Errorf("Deep: expected one passing check, got %v", health.Checks)
+	}
+}
+
+// TestHealthDeepFailure は依存先チェック失敗時のテスト
+func TestHealthDeepFailure(t *testing.T) {
+	withCheckers(t, &fakeChecker{name: "cache", err: errors.New("connection refused")})
+
+	rr := httptest.NewRecorder()
+	healthHandler(rr, httptest.NewRequest("GET", "/health?deep=true", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 on failing dependency, got %d", rr.Code)
+	}
+
+	var health HealthResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &health); err != nil {
+		t.Fatalf("Could not unmarshal response: %v", err)
+	}
+	if health.Status != "unhealthy" {
+		t.Errorf("Expected status 'unhealthy', got '%s'", health.Status)
+	}
+	if len(health.Checks) != 1 || health.Checks[0].Error != "connection refused" {
+		t.Errorf("Expected failing check with error, got %v", health.Checks)
+	}
+
+	// 浅いチェックは依存先の障害に影響されない
+	rr = httptest.NewRecorder()
+	healthHandler(rr, httptest.NewRequest("GET", "/health", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("Shallow check should stay 200 on dependency failure, got %d", rr.Code)
+	}
+}
+
+// TestHealthTextFormat は HEALTH_FORMAT=text のテスト
+// 本文は OK / FAIL のみで、ステータスコードは JSON 形式と同じであることを保証
+func TestHealthTextFormat(t *testing.T) {
+	t.Setenv("HEALTH_FORMAT", "text")
+	if c := mustLoadConfig(t); c.HealthFormat != healthFormatText {
+		t.Fatalf("Expected HEALTH_FORMAT to be loaded, got %q", c.HealthFormat)
+	}
+	withConfig(t, func(c *Config) { c.HealthFormat = healthFormatText })
+	withCheckers(t, &fakeChecker{name: "cache", err: errors.New("connection refused")})
+
+	rr := httptest.NewRecorder()
+	healthHandler(rr, httptest.NewRequest("GET", "/health", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != "OK" {
+		t.Errorf("Expected 200 OK, got %d %q", rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Expected text/plain, got %q", ct)
+	}
+
+	rr = httptest.NewRecorder()
+	healthHandler(rr, httptest.NewRequest("GET", "/health?deep=true", nil))
+	if rr.Code != http.StatusServiceUnavailable || rr.Body.String() != "FAIL" {
+		t.Errorf("Expected 503 FAIL, got %d %q", rr.Code, rr.Body.String())
+	}
+
+	t.Setenv("HEALTH_FORMAT", "xml")
+	if _, err := loadConfig(); err == nil {
+		t.Error("Expected error for unknown HEALTH_FORMAT")
+	}
+}
+
+// blockingChecker はコンテキストを無視して一定時間応答しないテスト用の依存先チェック
+type blockingChecker struct {
+	name  string
+	delay time.Duration
+}
+
+func (b *blockingChecker) Name() string { return b.name }
+
+func (b *blockingChecker) Check(ctx context.Context) error {
+	time.Sleep(b.delay)
+	return nil
+}
+
+// TestHealthCheckDeadline は深いヘルスチェック全体の期限のテスト
+// 期限を超えたチェックは timeout となり、完了したチェックの結果は期限内に返ることを保証
+func TestHealthCheckDeadline(t *testing.T) {
+	withConfig(t, func(c *Config) { c.HealthCheckDeadline = 50 * time.Millisecond })
+	withCheckers(t,
+		&fakeChecker{name: "cache"},
+		&blockingChecker{name: "slow-api", delay: time.Second},
+		&fakeChecker{name: "queue", err: errors.New("connection refused")},
+	)
+
+	start := time.Now()
+	results, healthy := healthChecks.Run(context.Background())
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Run should return at the deadline, took %v", elapsed)
+	}
+	if healthy {
+		t.Error("Expected unhealthy when a check times out")
+	}
+
+	want := map[string]string{
+		"cache":    checkStatusPass,
+		"slow-api": checkStatusTimeout,
+		"queue":    checkStatusFail,
+	}
+	if len(results) != len(want) {
+		t.Fatalf("Expected %d results, got %v", len(want), results)
+	}
+	for i, name := range []string{"cache", "slow-api", "queue"} {
+		if results[i].Name != name || results[i].Status != want[name] {
+			t.Errorf("Result %d: got %s=%s, want %s=%s", i, results[i].Name, results[i].Status, name, want[name])
+		}
+	}
+	if results[1].LatencyMs < 50 {
+		t.Errorf("Timed out check should report elapsed time up to the deadline, got %vms", results[1].LatencyMs)
+	}
+}
+
+// TestHealthDeepTimeout は依存先チェックがハングした場合の /health のテスト
+// プローブ自体のタイムアウトより前に、timeout を含む 503 を即座に返すことを保証
+func TestHealthDeepTimeout(t *testing.T) {
+	t.Setenv("HEALTH_CHECK_TIMEOUT", "50ms")
+	setConfig(mustLoadConfig(t))
+	t.Cleanup(func() { setConfig(defaultConfig()) })
+	withCheckers(t,
+		&fakeChecker{name: "database"},
+		&blockingChecker{name: "hanging-api", delay: time.Second},
+	)
+
+	start := time.Now()
+	rr := httptest.NewRecorder()
+	healthHandler(rr, httptest.NewRequest("GET", "/health?deep=true", nil))
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Deep health should respond promptly, took %v", elapsed)
+	}
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 when a check times out, got %d", rr.Code)
+	}
+
+	var resp HealthResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Could not unmarshal response: %v", err)
+	}
+	if len(resp.Checks) != 2 || resp.Checks[0].Status != checkStatusPass || resp.Checks[1].Status != checkStatusTimeout {
+		t.Errorf("Expected database=pass, hanging-api=timeout, got %+v", resp.Checks)
+	}
+}
+
+// optionalChecker は失敗時に degraded 扱いとなるテスト用の依存先チェック
+type optionalChecker struct {
+	fakeChecker
+}
+
+func (o *optionalChecker) Optional() bool { return true }
+
+// TestDegradedStatusCode は degraded 状態のステータスコード設定のテスト
+// 既定では liveness は 200・readiness は 503 を返し、DEGRADED_STATUS_CODE で切り替えられることを保証
+func TestDegradedStatusCode(t *testing.T) {
+	withCheckers(t,
+		&fakeChecker{name: "database"},
+		&optionalChecker{fakeChecker{name: "recommendations", err: errors.New("timeout")}},
+	)
+
+	probe := func(h http.HandlerFunc, path string) (int, HealthResponse) {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		h(rr, httptest.NewRequest("GET", path, nil))
+		var resp HealthResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Could not unmarshal response: %v", err)
+		}
+		return rr.Code, resp
+	}
+
+	tests := []struct {
+		env           string
+		wantLiveness  int
+		wantReadiness int
+	}{
+		{"", http.StatusOK, http.StatusServiceUnavailable},
+		{"200", http.StatusOK, http.StatusOK},
+		{"503", http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Setenv("DEGRADED_STATUS_CODE", tt.env)
+		setConfig(mustLoadConfig(t))
+
+		code, resp := probe(healthHandler, "/health?deep=true")
+		if code != tt.wantLiveness || resp.Status != healthStatusDegraded {
+			t.Errorf("DEGRADED_STATUS_CODE=%q liveness: got %d %s, want %d degraded",
+				tt.env, code, resp.Status, tt.wantLiveness)
+		}
+		code, resp = probe(readyHandler, "/ready?deep=true")
+		if code != tt.wantReadiness || resp.Status != healthStatusDegraded {
+			t.Errorf("DEGRADED_STATUS_CODE=%q readiness: got %d %s, want %d degraded",
+				tt.env, code, resp.Status, tt.wantReadiness)
+		}
+	}
+	t.Cleanup(func() { setConfig(defaultConfig()) })
+
+	t.Setenv("DEGRADED_STATUS_CODE", "418")
+	if _, err := loadConfig(); err == nil {
+		t.Error("Expected error for DEGRADED_STATUS_CODE other than 200/503")
+	}
+}
+
+// TestHealthzVerbose は Kubernetes 形式の /healthz?deep=true&verbose のテスト
+// チェックごとの行と最終行のサマリーがプレーンテキストで出力されることを保証
+func TestHealthzVerbose(t *testing.T) {
+	withCheckers(t, &fakeChecker{name: "database"}, &fakeChecker{name: "cache"})
+
+	rr := httptest.NewRecorder()
+	healthzHandler(rr, httptest.NewRequest("GET", "/healthz?deep=true&verbose", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected 200, got %d", rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Errorf("Expected plain text, got '%s'", ct)
+	}
+	if want := "[+]database ok\n[+]cache ok\nhealthz check passed\n"; rr.Body.String() != want {
+		t.Errorf("Unexpected verbose body:\n%s", rr.Body.String())
+	}
+
+	// verbose なしの成功時は "ok" のみ
+	rr = httptest.NewRecorder()
+	healthzHandler(rr, httptest.NewRequest("GET", "/healthz", nil))
+	if rr.Body.String() != "ok" {
+		t.Errorf("Expected 'ok', got '%s'", rr.Body.String())
+	}
+
+	// 失敗時は理由付きの行と失敗サマリーを 503 で返す
+	withCheckers(t, &fakeChecker{name: "database"}, &fakeChecker{name: "cache", err: errors.New("connection refused")})
+	rr = httptest.NewRecorder()
+	healthzHandler(rr, httptest.NewRequest("GET", "/healthz?deep=true&verbose", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503, got %d", rr.Code)
+	}
+	if want := "[+]database ok\n[-]cache fail: connection refused\nhealthz check failed\n"; rr.Body.String() != want {
+		t.Errorf("Unexpected verbose body:\n%s", rr.Body.String())
+	}
+}
+
+// TestHealthzShallowByDefault は /healthz が既定では依存先チェックを実行しないことのテスト
+// liveness プローブとして使われるため、依存先の障害があっても 200 を返すことを保証
+func TestHealthzShallowByDefault(t *testing.T) {
+	db := &fakeChecker{name: "database", err: errors.New("connection refused")}
+	withCheckers(t, db)
+
+	for target, want := range map[string]string{
+		"/healthz":         "ok",
+		"/healthz?verbose": "[+]ping ok\nhealthz check passed\n",
+	} {
+		rr := httptest.NewRecorder()
+		healthzHandler(rr, httptest.NewRequest("GET", target, nil))
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: expected 200 despite failing dependency, got %d", target, rr.Code)
+		}
+		if body := rr.Body.String(); body != want {
+			t.Errorf("%s: expected body %q, got %q", target, want, body)
+		}
+	}
+	if calls := atomic.LoadInt64(&db.calls); calls != 0 {
+		t.Errorf("Shallow /healthz should not run dependency checks, got %d calls", calls)
+	}
+}
+
+// cachedChecker はキャッシュ期間を持つテスト用の依存先チェック
+type cachedChecker struct {
+	fakeChecker
+	ttl time.Duration
+}
+
+func (c *cachedChecker) CacheTTL() time.Duration { return c.ttl }
+
+// TestHealthCacheHitsMisses は依存先チェックのキャッシュのヒット・ミス数のテスト
+// キャッシュ期間内の連続したプローブでは、最初のミスの後にヒットが積み上がることを保証
+func TestHealthCacheHitsMisses(t *testing.T) {
+	withCheckers(t,
+		&cachedChecker{fakeChecker: fakeChecker{name: "database"}, ttl: time.Hour},
+		&fakeChecker{name: "cache"}, // キャッシュ期間なしのチェックは計上しない
+	)
+	scrape := func() MetricsResponse {
+		rr := httptest.NewRecorder()
+		metricsHandler(rr, httptest.NewRequest("GET", "/metrics", nil))
+		var m MetricsResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &m); err != nil {
+			t.Fatalf("Could not unmarshal response: %v", err)
+		}
+		return m
+	}
+
+	for i := 0; i < 5; i++ {
+		rr := httptest.NewRecorder()
+		healthHandler(rr, httptest.NewRequest("GET", "/health?deep=true", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Probe %d: expected 200, got %d", i, rr.Code)
+		}
+	}
+	if m := scrape(); m.HealthCacheMisses != 1 || m.HealthCacheHits != 4 {
+		t.Errorf("Expected 1 miss and 4 hits, got misses=%d hits=%d", m.HealthCacheMisses, m.HealthCacheHits)
+	}
+}
+
+// TestCheckCacheTTL は依存先チェックごとのキャッシュ期間のテスト
+// キャッシュ期間の異なるチェックがそれぞれの周期で再実行されることを保証
+func TestCheckCacheTTL(t *testing.T) {
+	cheap := &cachedChecker{fakeChecker: fakeChecker{name: "database"}, ttl: 50 * time.Millisecond}
+	expensive := &cachedChecker{fakeChecker: fakeChecker{name: "external-api"}, ttl: time.Hour}
+	uncached := &fakeChecker{name: "cache"}
+	withCheckers(t, cheap, expensive, uncached)
+	now := time.Unix(1700000000, 0)
+	healthChecks.now = func() time.Time { return now }
+
+	run := func() []CheckResult {
+		results, _ := healthChecks.Run(context.Background())
+		return results
+	}
+	calls := func() [3]int64 {
+		return [3]int64{atomic.LoadInt64(&cheap.calls), atomic.LoadInt64(&expensive.calls), atomic.LoadInt64(&uncached.calls)}
+	}
+
+	run()
+	results := run()
+	if got, want := calls(), [3]int64{1, 1, 2}; got != want {
+		t.Errorf("Within TTL: expected calls %v, got %v", want, got)
+	}
+	if !results[0].Cached || !results[1].Cached || results[2].Cached {
+		t.Errorf("Within TTL: unexpected cached flags: %+v", results)
+	}
+
+	now = now.Add(60 * time.Millisecond)
+	results = run()
+	if got, want := calls(), [3]int64{2, 1, 3}; got != want {
+		t.Errorf("After short TTL: expected calls %v, got %v", want, got)
+	}
+	if results[0].Cached || !results[1].Cached {
+		t.Errorf("After short TTL: unexpected cached flags: %+v", results)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxIdempotencyKeyLen は受け付ける Idempotency-Key の最大長
+const maxIdempotencyKeyLen = 255
+
+// perRequestHeaders は外側のミドルウェアがリクエストごとに付与するヘッダー
+// 再送時は最初のリクエストの値ではなく、リトライ自身の値を返す
+var perRequestHeaders = map[string]bool{
+	"X-Request-Id":        true,
+	"X-Served-By-Version": true,
+}
+
+// idempotentResponse は最初のリクエストで記録したレスポンス
+type idempotentResponse struct {
+	done    chan struct{} // 最初のリクエストの処理完了で close される
+	expires time.Time     // キャッシュの有効期限（処理完了時に設定）
+	failed  bool          // 最初のリクエストが panic などでレスポンスを記録できなかった
+	status  int
+	header  http.Header
+	body    []byte
+}
+
+// idempotencyCache は Idempotency-Key ごとのレスポンスキャッシュ
+// 管理用の変更系エンドポイントで、リトライによる重複実行を防ぐために使用する
+type idempotencyCache struct {
+	mu      sync.Mutex
+	entries map[string]*idempotentResponse
+	now     func() time.Time // 差し替え可能な時刻関数（テスト用）
+}
+
+// newIdempotencyCache は空のキャッシュを生成する
+func newIdempotencyCache() *idempotencyCache {
+	return &idempotencyCache{
+		entries: make(map[string]*idempotentResponse),
+		now:     time.Now,
+	}
+}
+
+// idempotencyResponses はアプリケーション全体で共有するキャッシュ
+var idempotencyResponses = newIdempotencyCache()
+
+// acquire はキーに対応するエントリを返す
+// 新規（または期限切れ）の場合は owner=true を返し、呼び出し側がリクエストを実行する
+func (c *idempotencyCache) acquire(key string) (entry *idempotentResponse, owner bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for k, e := range c.entries {
+		if !e.expires.IsZero() && now.After(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+	if e, ok := c.entries[key]; ok {
+		return e, false
+	}
+	e := &idempotentResponse{done: make(chan struct{})}
+	c.entries[key] = e
+	return e, true
+}
+
+// complete は記録したレスポンスを保存し、待機中の重複リクエストに通知する
+func (c *idempotencyCache) complete(e *idempotentResponse, rec *responseRecorder, ttl time.Duration) {
+	c.mu.Lock()
+	e.expires = c.now().Add(ttl)
+	e.status = rec.status
+	e.header = rec.Header().Clone()
+	e.body = rec.body.Bytes()
+	c.mu.Unlock()
+	close(e.done)
+}
+
+// abort はレスポンスを記録できなかったエントリを削除し、待機中の重複リクエストに失敗を通知する
+// 削除したキーは次のリクエストで再実行される
+func (c *idempotencyCache) abort(key string, e *idempotentResponse) {
+	c.mu.Lock()
+	if c.entries[key] == e {
+		delete(c.entries, key)
+	}
+	e.failed = true
+	c.mu.Unlock()
+	close(e.done)
+}
+
+// responseRecorder はレスポンスをクライアントへ返しつつ内容を記録する
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	r.body.Write(p)
+	return r.ResponseWriter.Write(p)
+}
+
+// idempotent は Idempotency-Key ヘッダー付きの POST を一度だけ実行するミドルウェア
+// 同じキーのリトライには IDEMPOTENCY_TTL の間、最初のレスポンスをそのまま返す
+// 最初のリクエストが処理中の場合は完了を待ってから同じレスポンスを返す
+func idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if r.Method != http.MethodPost || key == "" {
+			next(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			writeError(w, r, "Idempotency-Key too long", http.StatusBadRequest)
+			return
+		}
+
+		// 同じキーでも異なるエンドポイントへのリクエストは別の操作として扱う
+		cacheKey := r.URL.Path + "\x00" + key
+		entry, owner := idempotencyResponses.acquire(cacheKey)
+		if owner {
+			completed := false
+			defer func() {
+				// panic は外側の recoveryMiddleware で回復されるため、ここではキーの解放だけ行う
+				// （解放しないと同じキーのリクエストがすべて待ち続ける）
+				if !completed {
+					idempotencyResponses.abort(cacheKey, entry)
+				}
+			}()
+			rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+			next(rec, r)
+			idempotencyResponses.complete(entry, rec, cfg().IdempotencyTTL)
+			completed = true
+			return
+		}
+
+		select {
+		case <-entry.done:
+		case <-r.Context().Done():
+			return
+		}
+		if entry.failed {
+			// 最初のリクエストと同じく失敗として返す（キーは解放済みのため、リトライすれば再実行される）
+			writeError(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		for k, v := range entry.header {
+			if perRequestHeaders[k] {
+				continue
+			}
+			w.Header()[k] = v
+		}
+		w.Header().Set("Idempotent-Replayed", "true")
+		w.WriteHeader(entry.status)
+		w.Write(entry.body)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestIdempotencyKey は Idempotency-Key による重複実行防止のテスト
+// 同じキーのリトライでは処理が一度だけ実行され、最初のレスポンスが返ることを保証
+func TestIdempotencyKey(t *testing.T) {
+	orig := idempotencyResponses
+	idempotencyResponses = newIdempotencyCache()
+	t.Cleanup(func() { idempotencyResponses = orig })
+
+	var executions int64
+	handler := idempotent(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt64(&executions, 1)
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintf(w, "execution %d", n)
+	})
+
+	send := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/debug/alloc/release", nil)
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	first := send("key-1")
+	retry := send("key-1")
+	if executions != 1 {
+		t.Fatalf("Expected mutation to execute once, got %d", executions)
+	}
+	if retry.Code != http.StatusAccepted || retry.Body.String() != "execution 1" {
+		t.Errorf("Retry should replay first response, got %d %q", retry.Code, retry.Body.String())
+	}
+	if first.Header().Get("Idempotent-Replayed") != "" || retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("Only replayed responses should be marked with Idempotent-Replayed")
+	}
+
+	// 別のキー・キーなしのリクエストは毎回実行される
+	send("key-2")
+	send("")
+	if executions != 3 {
+		t.Errorf("Different or missing keys should execute, got %d executions", executions)
+	}
+
+	// TTL を過ぎたキーは再実行される
+	now := time.Now().Add(time.Hour)
+	idempotencyResponses.now = func() time.Time { return now }
+	if rr := send("key-1"); rr.Body.String() != "execution 4" {
+		t.Errorf("Expired key should execute again, got %q", rr.Body.String())
+	}
+}
+
+// TestIdempotencyKeyReplayRequestID は再送レスポンスの X-Request-ID のテスト
+// 再送時に最初のリクエストの ID で上書きせず、リトライ自身の ID を返すことを保証
+func TestIdempotencyKeyReplayRequestID(t *testing.T) {
+	orig := idempotencyResponses
+	idempotencyResponses = newIdempotencyCache()
+	t.Cleanup(func() { idempotencyResponses = orig })
+
+	handler := requestIDMiddleware(idempotent(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	send := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/debug/alloc/release", nil)
+		req.Header.Set("Idempotency-Key", "key-1")
+		req.Header.Set("X-Request-ID", id)
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	send("first-request")
+	retry := send("retry-request")
+	if retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatal("Expected the retry to be replayed")
+	}
+	if got := retry.Header().Get("X-Request-ID"); got != "retry-request" {
+		t.Errorf("Replayed response should carry the retry's request ID, got %q", got)
+	}
+	if got := retry.Header().Values("X-Request-ID"); len(got) != 1 {
+		t.Errorf("Expected a single X-Request-ID, got %v", got)
+	}
+	if got := retry.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Replayed response should keep recorded headers, got Content-Type %q", got)
+	}
+}
+
+// TestIdempotencyKeyPanic は最初のリクエストが panic した場合のテスト
+// 待機中の重複リクエストが解放されて 500 を受け取り、同じキーのリトライは再実行されることを保証
+func TestIdempotencyKeyPanic(t *testing.T) {
+	captureLogs(t)
+	orig := idempotencyResponses
+	idempotencyResponses = newIdempotencyCache()
+	t.Cleanup(func() { idempotencyResponses = orig })
+	// acquire は時刻の取得をロック内で行うため、呼び出しを数えて重複リクエストの到着を待てる
+	acquired := make(chan struct{}, 10)
+	idempotencyResponses.now = func() time.Time {
+		acquired <- struct{}{}
+		return time.Now()
+	}
+
+	var executions int64
+	started, release := make(chan struct{}), make(chan struct{})
+	handler := recoveryMiddleware(idempotent(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&executions, 1) == 1 {
+			close(started)
+			<-release
+			panic("boom")
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/debug/alloc", nil)
+		req.Header.Set("Idempotency-Key", "key-1")
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	first := make(chan *httptest.ResponseRecorder)
+	go func() { first <- send() }()
+	<-started
+	<-acquired
+	waiter := make(chan *httptest.ResponseRecorder)
+	go func() { waiter <- send() }()
+	<-acquired // 重複リクエストが最初のリクエストのエントリを取得した
+	close(release)
+
+	if rr := <-first; rr.Code != http.StatusInternalServerError {
+		t.Errorf("Panicking request: got %d want 500", rr.Code)
+	}
+	select {
+	case rr := <-waiter:
+		if rr.Code != http.StatusInternalServerError {
+			t.Errorf("Waiting duplicate: got %d want 500", rr.Code)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Duplicate request is still waiting for the panicked request")
+	}
+
+	if rr := send(); rr.Code != http.StatusAccepted {
+		t.Errorf("Retry after panic should execute again, got %d", rr.Code)
+	}
+	if executions != 2 {
+		t.Errorf("Expected 2 executions, got %d", executions)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// connClassKey はコネクション分類をコンテキストに格納するためのキー
+type connClassKey struct{}
+
+// connClass はコネクションの分類
+// プローブ用エンドポイントへのリクエストを処理したコネクションを probe として扱う
+type connClass struct {
+	probe atomic.Bool
+	used  atomic.Bool // 1件以上のリクエストを処理したか（キープアライブでの再利用の判定用）
+}
+
+// connReuseStats は新規コネクションと再利用（キープアライブ）されたコネクションで処理したリクエスト数
+// クライアントやプロキシがコネクションを再利用できていない（毎回接続している）ことを検知するために使用
+type connReuseStats struct {
+	newConn atomic.Int64 // コネクションの最初のリクエスト
+	reused  atomic.Int64 // 再利用されたコネクションでのリクエスト
+}
+
+// connReuse はアプリケーション全体で共有するコネクション再利用の集計
+var connReuse = &connReuseStats{}
+
+// Ratio はリクエストのうち再利用されたコネクションで処理したものの割合を返す（リクエストがなければ 0）
+func (s *connReuseStats) Ratio() float64 {
+	reused := s.reused.Load()
+	total := s.newConn.Load() + reused
+	if total == 0 {
+		return 0
+	}
+	return float64(reused) / float64(total)
+}
+
+// markProbeConn はリクエストを処理したコネクションをプローブ用として分類するミドルウェア
+func markProbeConn(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if cc, ok := r.Context().Value(connClassKey{}).(*connClass); ok {
+			cc.probe.Store(true)
+		}
+		next(w, r)
+	}
+}
+
+// keepAliveReaper はコネクション分類ごとのキープアライブアイドル時間を適用する
+// http.Server の IdleTimeout はサーバー全体で共通のため、頻繁に再接続される
+// プローブ用コネクションは KEEPALIVE_IDLE 経過後に個別に切断する
+type keepAliveReaper struct {
+	mu      sync.Mutex
+	classes map[net.Conn]*connClass
+	timers  map[net.Conn]*time.Timer
+	idle    func() time.Duration // プローブ用コネクションのアイドル時間（0 以下なら IdleTimeout のみ）
+}
+
+// newKeepAliveReaper は KEEPALIVE_IDLE を参照するリーパーを生成する
+func newKeepAliveReaper() *keepAliveReaper {
+	return &keepAliveReaper{
+		classes: make(map[net.Conn]*connClass),
+		timers:  make(map[net.Conn]*time.Timer),
+		idle:    func() time.Duration { return cfg().KeepAliveIdle },
+	}
+}
+
+// install はサーバーにコネクション分類とアイドル切断のフックを設定する
+func (k *keepAliveReaper) install(s *http.Server) {
+	s.ConnContext = k.connContext
+	s.ConnState = k.connState
+}
+
+// connContext は新しいコネクションに分類情報を割り当てる
+func (k *keepAliveReaper) connContext(ctx context.Context, c net.Conn) context.Context {
+	cc := &connClass{}
+	k.mu.Lock()
+	k.classes[c] = cc
+	k.mu.Unlock()
+	return context.WithValue(ctx, connClassKey{}, cc)
+}
+
+// connState はアイドル状態になったプローブ用コネクションに切断タイマーを設定する
+// あわせて、リクエストの開始時にコネクションが新規か再利用かを集計する
+func (k *keepAliveReaper) connState(c net.Conn, state http.ConnState) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if t, ok := k.timers[c]; ok {
+		t.Stop()
+		delete(k.timers, c)
+	}
+
+	switch state {
+	case http.StateActive:
+		// HTTP/1.x では StateActive への遷移がリクエストの開始に対応する
+		if cc := k.classes[c]; cc != nil {
+			if cc.used.Swap(true) {
+				connReuse.reused.Add(1)
+			} else {
+				connReuse.newConn.Add(1)
+			}
+		}
+	case http.StateIdle:
+		cc := k.classes[c]
+		if d := k.idle(); d > 0 && cc != nil && cc.probe.Load() {
+			k.timers[c] = time.AfterFunc(d, func() { c.Close() })
+		}
+	case http.StateClosed, http.StateHijacked:
+		delete(k.classes, c)
+	}
+}
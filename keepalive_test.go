@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestKeepAliveIdleProbeConn はプローブ用コネクションのキープアライブアイドル切断テスト
+// プローブ用コネクションは KEEPALIVE_IDLE 経過後に切断され、それ以外は IdleTimeout まで維持されることを保証
+func TestKeepAliveIdleProbeConn(t *testing.T) {
+	withConfig(t, func(c *Config) { c.KeepAliveIdle = 50 * time.Millisecond })
+
+	srv := httptest.NewUnstartedServer(newRouter())
+	srv.Config.IdleTimeout = time.Minute
+	newKeepAliveReaper().install(srv.Config)
+	srv.Start()
+	defer srv.Close()
+
+	// get はキープアライブ接続でリクエストを送り、接続を維持したまま返す
+	get := func(path string) net.Conn {
+		t.Helper()
+		conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+		if err != nil {
+			t.Fatalf("Dial failed: %v", err)
+		}
+		if _, err := io.WriteString(conn, "GET "+path+" HTTP/1.1\r\nHost: test\r\n\r\n"); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatalf("ReadResponse failed: %v", err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return conn
+	}
+
+	// プローブ用コネクション：KEEPALIVE_IDLE 経過後にサーバー側から切断される
+	probe := get("/health")
+	defer probe.Close()
+	start := time.Now()
+	probe.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := probe.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Fatalf("Expected probe connection to be closed, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Probe connection closed too late: %v", elapsed)
+	}
+
+	// 通常のコネクション：KEEPALIVE_IDLE を過ぎても維持される
+	normal := get("/")
+	defer normal.Close()
+	normal.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+	var ne net.Error
+	if _, err := normal.Read(make([]byte, 1)); !errors.As(err, &ne) || !ne.Timeout() {
+		t.Errorf("Expected normal connection to stay open, got %v", err)
+	}
+}
+
+// TestConnectionReuseRatio はコネクション再利用率のテスト
+// 1つのコネクションで連続したリクエストを送ると、2件目以降が再利用として計上されることを保証
+func TestConnectionReuseRatio(t *testing.T) {
+	orig := connReuse
+	connReuse = &connReuseStats{}
+	t.Cleanup(func() { connReuse = orig })
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	newKeepAliveReaper().install(srv.Config)
+	srv.Start()
+	defer srv.Close()
+
+	client := srv.Client()
+	for i := 0; i < 4; i++ {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	if n, r := connReuse.newConn.Load(), connReuse.reused.Load(); n != 1 || r != 3 {
+		t.Errorf("Expected 1 new and 3 reused, got %d new and %d reused", n, r)
+	}
+	if ratio := connReuse.Ratio(); ratio != 0.75 {
+		t.Errorf("Expected reuse ratio 0.75, got %v", ratio)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// requestSlots はサーバー全体の同時処理数を制限するセマフォ
+// 上限到達時はすぐに拒否せず、QUEUE_TIMEOUT まで空きを待つ（短いバーストを吸収するため）
+type requestSlots struct {
+	sem chan struct{}
+}
+
+// newRequestSlots は同時処理数の上限 max のセマフォを作成する（0 以下なら nil = 無制限）
+func newRequestSlots(max int) *requestSlots {
+	if max <= 0 {
+		return nil
+	}
+	return &requestSlots{sem: make(chan struct{}, max)}
+}
+
+// globalRequestSlots はアプリケーション全体で共有する同時処理数の制限（nil なら無制限）
+var globalRequestSlots *requestSlots
+
+// queueWaitNanos は処理枠の空きを待った時間の累計（ナノ秒）
+// 枠の待ちはレイテンシに含まれるもののハンドラーの処理時間とは区別できないため、個別に計測する
+var queueWaitNanos atomic.Int64
+
+// concurrencyMiddleware は MAX_CONCURRENT_REQUESTS を超えるリクエストを処理枠が空くまで待たせるミドルウェア
+// QUEUE_TIMEOUT までに空かない場合（またはクライアントの切断時）は 503 を返す
+func concurrencyMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slots := globalRequestSlots
+		if slots == nil {
+			next(w, r)
+			return
+		}
+
+		start := time.Now()
+		timer := time.NewTimer(cfg().QueueTimeout)
+		defer timer.Stop()
+		select {
+		case slots.sem <- struct{}{}:
+			queueWaitNanos.Add(int64(time.Since(start)))
+		case <-timer.C:
+			queueWaitNanos.Add(int64(time.Since(start)))
+			w.Header().Set("Retry-After", "1")
+			writeError(w, r, "Service Unavailable: too many concurrent requests", http.StatusServiceUnavailable)
+			return
+		case <-r.Context().Done():
+			queueWaitNanos.Add(int64(time.Since(start)))
+			return
+		}
+		defer func() { <-slots.sem }()
+
+		next(w, r)
+	}
+}
+
+// ipConcurrencyLimiter はクライアント IP ごとの同時処理数を制限する
+// 全体の同時処理数とは別に、単一の騒がしいクライアントがサーバーを占有することを防ぐ
+type ipConcurrencyLimiter struct {
+	mu       sync.Mutex
+	inflight map[string]int
+}
+
+// perIPLimiter はアプリケーション全体で共有する IP 別同時処理数リミッター
+var perIPLimiter = &ipConcurrencyLimiter{inflight: make(map[string]int)}
+
+// acquire は ip の処理枠を確保する（上限到達時は false）
+func (l *ipConcurrencyLimiter) acquire(ip string, max int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inflight[ip] >= max {
+		return false
+	}
+	l.inflight[ip]++
+	return true
+}
+
+// release は ip の処理枠を解放する（0 になったエントリは削除してメモリを抑える）
+func (l *ipConcurrencyLimiter) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inflight[ip]--; l.inflight[ip] <= 0 {
+		delete(l.inflight, ip)
+	}
+}
+
+// perIPConcurrencyMiddleware はクライアント IP ごとの同時処理数を MAX_INFLIGHT_PER_IP に制限する
+// 上限を超えたリクエストには 429 を返す（0 以下なら無制限）
+func perIPConcurrencyMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		max := cfg().MaxInflightPerIP
+		if max <= 0 {
+			next(w, r)
+			return
+		}
+
+		ip := clientIP(r)
+		if !perIPLimiter.acquire(ip, max) {
+			w.Header().Set("Retry-After", "1")
+			writeError(w, r, "Too Many Requests", http.StatusTooManyRequests)
+			return
+		}
+		defer perIPLimiter.release(ip)
+
+		next(w, r)
+	}
+}
+
+// limitListener は同時に保持する TCP コネクション数を制限するリスナー
+// リクエスト単位の同時処理数とは別に、キープアライブやヘッダー送信途中で滞留する
+// コネクションによるファイルディスクリプタ枯渇を防ぐ（golang.org/x/net/netutil.LimitListener 相当）
+// 上限到達中は Accept を待機させ、既存のコネクションが閉じられるまで新規接続は OS のバックログに留まる
+type limitListener struct {
+	net.Listener
+	sem       chan struct{} // 空きコネクション枠（容量が上限）
+	closeOnce sync.Once
+	done      chan struct{} // リスナーのクローズ通知
+}
+
+// newLimitListener は ln の同時コネクション数を max に制限する
+func newLimitListener(ln net.Listener, max int) net.Listener {
+	return &limitListener{
+		Listener: ln,
+		sem:      make(chan struct{}, max),
+		done:     make(chan struct{}),
+	}
+}
+
+// Accept は枠が空くまで待ってから次のコネクションを受け付ける
+func (l *limitListener) Accept() (net.Conn, error) {
+	select {
+	case l.sem <- struct{}{}:
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		<-l.sem
+		return nil, err
+	}
+	return &limitListenerConn{Conn: conn, release: func() { <-l.sem }}, nil
+}
+
+// Close は待機中の Accept を解除してからリスナーを閉じる
+func (l *limitListener) Close() error {
+	err := l.Listener.Close()
+	l.closeOnce.Do(func() { close(l.done) })
+	return err
+}
+
+// limitListenerConn はクローズ時に枠を1度だけ返却するコネクション
+type limitListenerConn struct {
+	net.Conn
+	releaseOnce sync.Once
+	release     func()
+}
+
+func (c *limitListenerConn) Close() error {
+	err := c.Conn.Close()
+	c.releaseOnce.Do(c.release)
+	return err
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestPerIPConcurrencyLimit は IP 別同時処理数制限のテスト
+// 1つの IP が上限に達しても、他の IP のリクエストは影響を受けないことを保証
+func TestPerIPConcurrencyLimit(t *testing.T) {
+	_, proxyNet, _ := net.ParseCIDR("10.0.0.0/8")
+	withConfig(t, func(c *Config) {
+		c.MaxInflightPerIP = 1
+		c.TrustedProxies = []*net.IPNet{proxyNet}
+	})
+
+	entered := make(chan struct{})
+	unblock := make(chan struct{})
+	h := perIPConcurrencyMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Block") == "true" {
+			entered <- struct{}{}
+			<-unblock
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	request := func(client string, block bool) *http.Request {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "10.0.0.1:5000" // 信頼できるロードバランサー経由
+		req.Header.Set("X-Forwarded-For", client)
+		if block {
+			req.Header.Set("X-Block", "true")
+		}
+		return req
+	}
+
+	// クライアント A の処理枠を埋める
+	done := make(chan int)
+	go func() {
+		rr := httptest.NewRecorder()
+		h(rr, request("203.0.113.10", true))
+		done <- rr.Code
+	}()
+	<-entered
+
+	// 同じクライアント A の追加リクエストは 429
+	rr := httptest.NewRecorder()
+	h(rr, request("203.0.113.10", false))
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 for saturated IP, got %d", rr.Code)
+	}
+
+	// 別のクライアント B は影響を受けない
+	rr = httptest.NewRecorder()
+	h(rr, request("198.51.100.20", false))
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected 200 for other IP, got %d", rr.Code)
+	}
+
+	close(unblock)
+	if code := <-done; code != http.StatusOK {
+		t.Errorf("Blocked request should complete with 200, got %d", code)
+	}
+
+	// 処理完了後はクライアント A も再び受け付ける
+	rr = httptest.NewRecorder()
+	h(rr, request("203.0.113.10", false))
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected 200 after slot released, got %d", rr.Code)
+	}
+}
+
+// TestConcurrencyQueueWait はサーバー全体の同時処理数制限のテスト
+// 上限到達中のリクエストは処理枠が空くまで待ち、その待ち時間が queue_wait_time_ms に計上されることを保証
+func TestConcurrencyQueueWait(t *testing.T) {
+	withConfig(t, func(c *Config) {
+		c.MaxConcurrentRequests = 1
+		c.QueueTimeout = 5 * time.Second
+	})
+	orig := globalRequestSlots
+	globalRequestSlots = newRequestSlots(1)
+	t.Cleanup(func() { globalRequestSlots = orig })
+
+	entered := make(chan struct{}, 2)
+	unblock := make(chan struct{})
+	h := concurrencyMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-unblock
+		w.WriteHeader(http.StatusOK)
+	})
+
+	queueWait := func() float64 {
+		rr := httptest.NewRecorder()
+		metricsHandler(rr, httptest.NewRequest("GET", "/metrics", nil))
+		var m MetricsResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &m); err != nil {
+			t.Fatalf("Could not unmarshal response: %v", err)
+		}
+		return m.QueueWaitTimeMs
+	}
+
+	// 1件目で処理枠を埋め、2件目を待たせる
+	before := queueWait()
+	done := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			rr := httptest.NewRecorder()
+			h(rr, httptest.NewRequest("GET", "/", nil))
+			done <- rr.Code
+		}()
+	}
+	<-entered
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case <-entered:
+		t.Fatal("Second request should wait while the slot is held")
+	default:
+	}
+
+	// 処理枠が空くと待っていたリクエストが処理される
+	unblock <- struct{}{}
+	<-entered
+	close(unblock)
+	for i := 0; i < 2; i++ {
+		if code := <-done; code != http.StatusOK {
+			t.Errorf("Expected 200, got %d", code)
+		}
+	}
+	if waited := queueWait() - before; waited < 40 {
+		t.Errorf("Expected queue wait of at least ~50ms, got %.1fms", waited)
+	}
+}
+
+// TestConcurrencyQueueTimeout は処理枠を待つ上限のテスト
+// QUEUE_TIMEOUT までに処理枠が空かない場合は 503 を返すことを保証
+func TestConcurrencyQueueTimeout(t *testing.T) {
+	withConfig(t, func(c *Config) {
+		c.QueueTimeout = 20 * time.Millisecond
+	})
+	orig := globalRequestSlots
+	globalRequestSlots = newRequestSlots(1)
+	t.Cleanup(func() { globalRequestSlots = orig })
+
+	globalRequestSlots.sem <- struct{}{} // 処理枠を埋めたままにする
+	rr := httptest.NewRecorder()
+	concurrencyMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Handler should not run without a slot")
+	})(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusServiceUnavailable || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected 503 with Retry-After, got %d", rr.Code)
+	}
+}
+
+// TestLimitListener は同時コネクション数制限のテスト
+// 上限を超えた接続は受け付けられず、既存の接続が閉じられると受け付けられることを保証
+func TestLimitListener(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	ln := newLimitListener(inner, 2)
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 3)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+
+	// 接続自体は OS のバックログで成立するため、3本とも Dial は成功する
+	for i := 0; i < 3; i++ {
+		client, err := net.Dial("tcp", inner.Addr().String())
+		if err != nil {
+			t.Fatalf("dial %d: %v", i, err)
+		}
+		defer client.Close()
+	}
+
+	var conns []net.Conn
+	for i := 0; i < 2; i++ {
+		select {
+		case conn := <-accepted:
+			conns = append(conns, conn)
+		case <-time.After(time.Second):
+			t.Fatalf("Expected connection %d to be accepted", i+1)
+		}
+	}
+	select {
+	case <-accepted:
+		t.Fatal("Expected third connection to wait while at the limit")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// 1本閉じると待機中の接続が受け付けられる（二重クローズでも枠は1つだけ返却）
+	conns[0].Close()
+	conns[0].Close()
+	select {
+	case conn := <-accepted:
+		conn.Close()
+	case <-time.After(time.Second):
+		t.Fatal("Expected waiting connection to be accepted after one closed")
+	}
+
+	// クローズ後の Accept は待機せずにエラーを返す
+	ln.Close()
+	if _, err := ln.Accept(); err == nil {
+		t.Error("Expected error from Accept after Close")
+	}
+	conns[1].Close()
+}
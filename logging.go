@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// logger は構造化ログ（JSON）を出力するロガー
+// Cloud Logging などのログ基盤でフィールド単位の検索・集計を可能にする
+// main で設定読み込み後に newDestLogger で出力先・共通フィールドを設定したものへ差し替える
+var logger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+// ログ出力先（LOG_DEST）
+const (
+	logDestStdout = "stdout"
+	logDestStderr = "stderr"
+)
+
+// newDestLogger は LOG_DEST に応じた出力先へ書き込む構造化ロガーを構築する
+// LOG_ERRORS_TO_STDERR 有効時はエラーレベルのログのみ stderr へ振り分ける
+// すべてのログにポッド情報を共通フィールドとして付与する
+func newDestLogger(c *Config, stdout, stderr io.Writer) *slog.Logger {
+	stdout, stderr = &countingWriter{w: stdout}, &countingWriter{w: stderr}
+	var h slog.Handler = slog.NewJSONHandler(logDestWriter(c, stdout, stderr), nil)
+	if c.LogErrorsToStderr {
+		h = &levelSplitHandler{Handler: h, errors: slog.NewJSONHandler(stderr, nil)}
+	}
+	return withPodAttrs(slog.New(h), c)
+}
+
+// logBytesWritten は構造化ロガーが出力した総バイト数（ログ量のコスト把握用）
+var logBytesWritten atomic.Int64
+
+// countingWriter は書き込んだバイト数を logBytesWritten に加算する io.Writer
+type countingWriter struct {
+	w io.Writer
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	logBytesWritten.Add(int64(n))
+	return n, err
+}
+
+// logDestWriter は LOG_DEST に対応する出力先を返す
+func logDestWriter(c *Config, stdout, stderr io.Writer) io.Writer {
+	if c.LogDest == logDestStderr {
+		return stderr
+	}
+	return stdout
+}
+
+// levelSplitHandler はエラーレベル以上のログを別の出力先へ振り分けるハンドラー
+// ログ収集基盤がストリームでエラーを判別する場合に使用する
+type levelSplitHandler struct {
+	slog.Handler              // エラーレベル未満の出力先
+	errors       slog.Handler // エラーレベル以上の出力先
+}
+
+func (h *levelSplitHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= slog.LevelError {
+		return h.errors.Handle(ctx, r)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *levelSplitHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelSplitHandler{Handler: h.Handler.WithAttrs(attrs), errors: h.errors.WithAttrs(attrs)}
+}
+
+func (h *levelSplitHandler) WithGroup(name string) slog.Handler {
+	return &levelSplitHandler{Handler: h.Handler.WithGroup(name), errors: h.errors.WithGroup(name)}
+}
+
+// withPodAttrs はポッド情報を共通フィールドとして付与する（未設定の項目は省略）
+// Kubernetes の Downward API で渡されたポッド情報をすべてのログに含め、
+// クラスタ内でどのポッド・ノードのログかを特定できるようにする
+func withPodAttrs(l *slog.Logger, c *Config) *slog.Logger {
+	var attrs []any
+	for _, f := range []struct{ key, value string }{
+		{"pod_name", c.PodName},
+		{"pod_namespace", c.PodNamespace},
+		{"node_name", c.NodeName},
+	} {
+		if f.value != "" {
+			attrs = append(attrs, slog.String(f.key, f.value))
+		}
+	}
+	if len(attrs) > 0 {
+		l = l.With(attrs...)
+	}
+	return l
+}
+
+// eventHeartbeat はハートビートログのイベント名
+const eventHeartbeat = "heartbeat"
+
+// startHeartbeat は一定間隔でハートビートを構造化ログに出力するゴルーチンを開始する
+// ログが途絶えたことで、プロセスが応答不能（ハング）になったことを検知できるようにする
+// ctx がキャンセルされる（シャットダウン）と停止し、返り値のチャネルが閉じられる
+func startHeartbeat(ctx context.Context, interval time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer close(done)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				logger.Info(eventHeartbeat,
+					"uptime_seconds", time.Since(startTime).Seconds(),
+					"request_count", collector.Snapshot().RequestCount,
+					"goroutines", runtime.NumGoroutine())
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return done
+}
+
+// logFields はリクエスト単位でハンドラーが追加するアクセスログのフィールド
+// timeoutMiddleware によりハンドラーが別ゴルーチンで動くことがあるため排他制御する
+type logFields struct {
+	mu    sync.Mutex
+	attrs []any // key, value の交互の並び（追加順を保つ）
+}
+
+// logFieldsKey は logFields をコンテキストに格納するためのキー
+type logFieldsKey struct{}
+
+// withLogFields はフィールドの追加先をコンテキストに用意する（logMiddleware が使用）
+func withLogFields(ctx context.Context) (context.Context, *logFields) {
+	lf := &logFields{}
+	return context.WithValue(ctx, logFieldsKey{}, lf), lf
+}
+
+// AddLogField はアクセスログ（http.access）に任意のフィールドを追加する
+// 同じキーを再度追加した場合は値を上書きする。logMiddleware 外のコンテキストでは何もしない
+func AddLogField(ctx context.Context, key string, value any) {
+	lf, ok := ctx.Value(logFieldsKey{}).(*logFields)
+	if !ok {
+		return
+	}
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	for i := 0; i < len(lf.attrs); i += 2 {
+		if lf.attrs[i] == key {
+			lf.attrs[i+1] = value
+			return
+		}
+	}
+	lf.attrs = append(lf.attrs, key, value)
+}
+
+// snapshot は追加されたフィールドのコピーを返す
+func (lf *logFields) snapshot() []any {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	return append([]any(nil), lf.attrs...)
+}
+
+// bodyCapture はハンドラーが読み取ったリクエスト本文の先頭を上限まで保持する
+// timeoutMiddleware のタイムアウト後もハンドラーが読み続けることがあるため排他制御する
+type bodyCapture struct {
+	mu        sync.Mutex
+	max       int
+	buf       []byte
+	truncated bool // 上限を超える本文が読み取られたか
+}
+
+// Write は上限までを保持し、超過分は切り捨てる（本文の読み取り自体は妨げない）
+func (c *bodyCapture) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if room := c.max - len(c.buf); len(p) > room {
+		c.buf = append(c.buf, p[:room]...)
+		c.truncated = true
+	} else {
+		c.buf = append(c.buf, p...)
+	}
+	return len(p), nil
+}
+
+// captureBody は LOG_BODY 有効時に r の本文を読み取りながら先頭を保持するよう差し替える
+// 本文を先読みしないため、Expect: 100-continue の拒否や本文サイズ制限の挙動は変わらない
+// （ハンドラーが読まなかった本文は記録されない）
+func captureBody(r *http.Request, c *Config) *bodyCapture {
+	if !c.LogBody || c.LogBodyMaxBytes <= 0 || r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+	capture := &bodyCapture{max: c.LogBodyMaxBytes}
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.TeeReader(r.Body, capture), r.Body}
+	return capture
+}
+
+// attrs はアクセスログに追加する本文のフィールドを返す
+func (c *bodyCapture) attrs() []any {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return []any{"body", string(c.buf), "body_truncated", c.truncated}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestLoggerPodMetadata はポッド情報がログの共通フィールドに含まれることのテスト
+// 未設定の項目はフィールド自体が省略されることを保証
+func TestLoggerPodMetadata(t *testing.T) {
+	t.Setenv("POD_NAME", "sre-workflow-7d9f8-abcde")
+	t.Setenv("POD_NAMESPACE", "production")
+	t.Setenv("NODE_NAME", "")
+	c := mustLoadConfig(t)
+
+	var buf bytes.Buffer
+	newDestLogger(&c, &buf, io.Discard).Info("test.event", "key", "value")
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Log line is not valid JSON: %v", err)
+	}
+
+	if entry["pod_name"] != "sre-workflow-7d9f8-abcde" {
+		t.Errorf("Expected pod_name in log, got %v", entry["pod_name"])
+	}
+	if entry["pod_namespace"] != "production" {
+		t.Errorf("Expected pod_namespace in log, got %v", entry["pod_namespace"])
+	}
+	if _, ok := entry["node_name"]; ok {
+		t.Errorf("Unset node_name should be omitted, got %v", entry["node_name"])
+	}
+	if entry["key"] != "value" {
+		t.Errorf("Event fields should be preserved, got %v", entry["key"])
+	}
+}
+
+// TestHeartbeat はハートビートログの出力テスト
+// 稼働時間・リクエスト数・ゴルーチン数を含むハートビートが定期的に出力されることを保証
+func TestHeartbeat(t *testing.T) {
+	logs := captureLogs(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := startHeartbeat(ctx, 5*time.Millisecond)
+
+	deadline := time.Now().Add(2 * time.Second)
+	var beat map[string]any
+	for beat == nil && time.Now().Before(deadline) {
+		for _, e := range logs.entries(t) {
+			if e["msg"] == eventHeartbeat {
+				beat = e
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if beat == nil {
+		t.Fatal("Expected at least one heartbeat log")
+	}
+	for _, key := range []string{"uptime_seconds", "request_count", "goroutines"} {
+		if _, ok := beat[key]; !ok {
+			t.Errorf("Heartbeat should include %s: %v", key, beat)
+		}
+	}
+}
+
+// TestLogDest はログ出力先の設定テスト
+// LOG_DEST で指定したストリームに出力され、LOG_ERRORS_TO_STDERR 有効時はエラーのみ stderr に振り分けられることを保証
+func TestLogDest(t *testing.T) {
+	tests := []struct {
+		dest        string
+		splitErrors bool
+		wantInfo    string // info ログの出力先
+		wantError   string // error ログの出力先
+	}{
+		{"", false, "stdout", "stdout"},
+		{"stderr", false, "stderr", "stderr"},
+		{"stdout", true, "stdout", "stderr"},
+	}
+	for _, tt := range tests {
+		t.Setenv("LOG_DEST", tt.dest)
+		t.Setenv("LOG_ERRORS_TO_STDERR", strconv.FormatBool(tt.splitErrors))
+		t.Setenv("POD_NAME", "pod-1")
+		c := mustLoadConfig(t)
+
+		streams := map[string]*bytes.Buffer{"stdout": {}, "stderr": {}}
+		l := newDestLogger(&c, streams["stdout"], streams["stderr"])
+		l.Info("test.info")
+		l.Error("test.error")
+
+		for msg, want := range map[string]string{"test.info": tt.wantInfo, "test.error": tt.wantError} {
+			for name, buf := range streams {
+				got := strings.Contains(buf.String(), `"msg":"`+msg+`"`)
+				if got != (name == want) {
+					t.Errorf("LOG_DEST=%q split=%v: %s on %s = %v, want on %s",
+						tt.dest, tt.splitErrors, msg, name, got, want)
+				}
+			}
+		}
+		// 振り分け後もポッド情報は付与される
+		if !strings.Contains(streams[tt.wantError].String(), `"pod_name":"pod-1"`) {
+			t.Errorf("LOG_DEST=%q: pod metadata missing from error log", tt.dest)
+		}
+	}
+
+	t.Setenv("LOG_DEST", "file")
+	if _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), "LOG_DEST") {
+		t.Errorf("Expected LOG_DEST validation error, got %v", err)
+	}
+}
+
+// TestLogBytesWritten はログ出力バイト数のメトリクスのテスト
+// 出力したログのバイト数だけ log_bytes_written が増加することを保証
+func TestLogBytesWritten(t *testing.T) {
+	scrape := func() int64 {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		metricsHandler(rr, httptest.NewRequest("GET", "/metrics", nil))
+		var m MetricsResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &m); err != nil {
+			t.Fatalf("Could not unmarshal response: %v", err)
+		}
+		return m.LogBytesWritten
+	}
+
+	c := defaultConfig()
+	c.LogErrorsToStderr = true
+	var stdout, stderr bytes.Buffer
+	l := newDestLogger(&c, &stdout, &stderr)
+
+	before := scrape()
+	l.Info("test.bytes", "payload", strings.Repeat("x", 100))
+	l.Error("test.bytes.error")
+	after := scrape()
+
+	want := int64(stdout.Len() + stderr.Len())
+	if want == 0 || stderr.Len() == 0 {
+		t.Fatal("Expected log output on both streams")
+	}
+	if got := after - before; got != want {
+		t.Errorf("log_bytes_written increased by %d, want %d", got, want)
+	}
+}
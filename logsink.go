@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// AccessLogRecord はログシンクへ送るアクセスログの1レコード
+type AccessLogRecord struct {
+	Time          time.Time
+	Method        string
+	URI           string
+	RemoteAddr    string
+	RequestID     string
+	Duration      time.Duration
+	ResponseBytes int64
+}
+
+// LogSink はアクセスログの送信先
+// 高スループット環境で標準出力へのテキストログを避け、gRPC などの収集基盤へ直接送る場合に実装する
+// Send はバッチ単位で呼ばれ、records はその呼び出しの間のみ有効
+type LogSink interface {
+	Send(ctx context.Context, records []AccessLogRecord) error
+}
+
+// nopLogSink は何も送信しないログシンク（デフォルト）
+type nopLogSink struct{}
+
+func (nopLogSink) Send(context.Context, []AccessLogRecord) error { return nil }
+
+// accessLogSink はアクセスログの送信先（起動時に差し替える。デフォルトは送信しない）
+var accessLogSink LogSink = nopLogSink{}
+
+// logSinkMaxPendingBatches は送信待ちとして保持する最大バッチ数
+// シンクの障害時にメモリを使い果たさないよう、超過分は破棄する
+const logSinkMaxPendingBatches = 10
+
+// logBatcher はアクセスログをバッチにまとめてログシンクへ送る
+// リクエスト処理ではバッファへの追加のみ行い、送信は Run のゴルーチンで行う
+type logBatcher struct {
+	sink LogSink
+	size int // 1バッチのレコード数
+
+	mu      sync.Mutex
+	pending []AccessLogRecord
+	dropped int64         // バッファ超過で破棄したレコード数
+	full    chan struct{} // バッチが埋まったことを Run に通知する
+}
+
+// newLogBatcher は size 件ごとに sink へ送る logBatcher を作成する
+func newLogBatcher(sink LogSink, size int) *logBatcher {
+	if size <= 0 {
+		size = 1
+	}
+	return &logBatcher{sink: sink, size: size, full: make(chan struct{}, 1)}
+}
+
+// accessLogBatcher はアプリケーション全体で共有するアクセスログのバッチ送信
+var accessLogBatcher = newLogBatcher(accessLogSink, 100)
+
+// Add はレコードを送信待ちに追加する（送信しないシンクの場合は何もしない）
+func (b *logBatcher) Add(rec AccessLogRecord) {
+	if _, ok := b.sink.(nopLogSink); ok {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.pending) >= b.size*logSinkMaxPendingBatches {
+		b.dropped++
+		return
+	}
+	b.pending = append(b.pending, rec)
+	if len(b.pending) >= b.size {
+		select {
+		case b.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Flush は送信待ちのレコードをバッチ単位でシンクへ送る
+// 送信に失敗したバッチは破棄する（アクセスログの欠損よりリクエスト処理への影響を避けることを優先）
+func (b *logBatcher) Flush(ctx context.Context) error {
+	b.mu.Lock()
+	records := b.pending
+	b.pending = nil
+	dropped := b.dropped
+	b.dropped = 0
+	b.mu.Unlock()
+
+	if dropped > 0 {
+		logger.Warn("log_sink.dropped", "records", dropped)
+	}
+	var firstErr error
+	for len(records) > 0 {
+		n := b.size
+		if n > len(records) {
+			n = len(records)
+		}
+		if err := b.sink.Send(ctx, records[:n]); err != nil {
+			logger.Warn("log_sink.send_failed", "records", n, "error", err.Error())
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		records = records[n:]
+	}
+	return firstErr
+}
+
+// Run はバッチが埋まったとき、または interval ごとに送信するバックグラウンド処理を開始する
+// ctx がキャンセルされると残りのレコードを送信してから終了し、返り値のチャネルが閉じられる
+// （プロセス終了前にこのチャネルを待たないと、最終送信が失われる）
+func (b *logBatcher) Run(ctx context.Context, interval time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer close(done)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-b.full:
+			case <-ticker.C:
+			case <-ctx.Done():
+				// シャットダウン時の最終送信はキャンセル済みの ctx を使わず、短い期限で行う
+				flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				b.Flush(flushCtx)
+				cancel()
+				return
+			}
+			b.Flush(ctx)
+		}
+	}()
+	return done
+}
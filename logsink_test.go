@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryLogSink は受け取ったバッチを保持するテスト用のログシンク
+type memoryLogSink struct {
+	mu      sync.Mutex
+	batches [][]AccessLogRecord
+}
+
+func (s *memoryLogSink) Send(ctx context.Context, records []AccessLogRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches = append(s.batches, append([]AccessLogRecord(nil), records...))
+	return nil
+}
+
+func (s *memoryLogSink) snapshot() [][]AccessLogRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]AccessLogRecord(nil), s.batches...)
+}
+
+// TestLogBatcher はアクセスログのバッチ送信のテスト
+// バッチが埋まると送信され、シャットダウン時には残りのレコードも送信されることを保証
+func TestLogBatcher(t *testing.T) {
+	sink := &memoryLogSink{}
+	b := newLogBatcher(sink, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := b.Run(ctx, time.Hour)
+
+	b.Add(AccessLogRecord{URI: "/a"})
+	b.Add(AccessLogRecord{URI: "/b"})
+	deadline := time.Now().Add(2 * time.Second)
+	for len(sink.snapshot()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected full batch to be delivered")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := sink.snapshot()[0]; len(got) != 2 || got[0].URI != "/a" || got[1].URI != "/b" {
+		t.Errorf("Unexpected first batch: %+v", got)
+	}
+
+	// バッチに満たないレコードはシャットダウン時に送信される
+	b.Add(AccessLogRecord{URI: "/c"})
+	cancel()
+	<-done
+	batches := sink.snapshot()
+	if len(batches) != 2 || len(batches[1]) != 1 || batches[1][0].URI != "/c" {
+		t.Errorf("Expected remaining record to be flushed on shutdown, got %+v", batches)
+	}
+}
+
+// TestAccessLogSink はアクセスログがログシンクへ送られることのテスト
+func TestAccessLogSink(t *testing.T) {
+	captureLogs(t)
+	sink := &memoryLogSink{}
+	orig := accessLogBatcher
+	accessLogBatcher = newLogBatcher(sink, 10)
+	t.Cleanup(func() { accessLogBatcher = orig })
+
+	handler := requestIDMiddleware(logMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	req := httptest.NewRequest("GET", "/hello", nil)
+	req.Header.Set("X-Request-ID", "req-sink-1")
+	handler(httptest.NewRecorder(), req)
+
+	if err := accessLogBatcher.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	batches := sink.snapshot()
+	if len(batches) != 1 || len(batches[0]) != 1 {
+		t.Fatalf("Expected one record, got %+v", batches)
+	}
+	rec := batches[0][0]
+	if rec.URI != "/hello" || rec.RequestID != "req-sink-1" || rec.ResponseBytes != 5 || rec.Duration <= 0 {
+		t.Errorf("Unexpected record: %+v", rec)
+	}
+}
+
+// TestLogSinkFlushIntervalValidation は LOG_SINK_FLUSH_INTERVAL が正の値に制限されることのテスト
+// （0 以下の間隔は time.NewTicker が panic するため、起動時にエラーとする）
+func TestLogSinkFlushIntervalValidation(t *testing.T) {
+	for _, v := range []string{"0", "-1s"} {
+		t.Setenv("LOG_SINK_FLUSH_INTERVAL", v)
+		if _, err := loadConfig(); err == nil {
+			t.Errorf("Expected error for LOG_SINK_FLUSH_INTERVAL=%s", v)
+		}
+	}
+	t.Setenv("LOG_SINK_FLUSH_INTERVAL", "2s")
+	if c := mustLoadConfig(t); c.LogSinkFlushInterval != 2*time.Second {
+		t.Errorf("Unexpected interval: %v", c.LogSinkFlushInterval)
+	}
+}
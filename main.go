@@ -1,20 +1,30 @@
 package main
 
 import (
-	"encoding/json"
-	"fmt"
+	"bytes"
+	"context"
+	"html/template"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"sync/atomic"
 	"time"
 )
 
 // HealthResponse はヘルスチェックAPIのレスポンス構造体
 // SREワークフローでの監視・ロードバランサーからの生存確認に使用
 type HealthResponse struct {
-	Status    string `json:"status"`    // サービス状態 ("healthy" など)
-	Timestamp string `json:"timestamp"` // 現在時刻（RFC3339形式）
-	Version   string `json:"version"`   // アプリケーションバージョン
+	Status    string `json:"status"`            // サービス状態 ("healthy" など)
+	Timestamp string `json:"timestamp"`         // 現在時刻（RFC3339形式）
+	Version   string `json:"version"`           // アプリケーションバージョン
+	Message   string `json:"message,omitempty"` // 運用者が設定する任意のメッセージ（HEALTH_MESSAGE）
+
+	Generation string `json:"generation" optional:"true"` // ロールアウト世代（Cloud Run のリビジョン名など）
+
+	Canary bool `json:"canary,omitempty"` // カナリア検証用のリクエスト（CANARY_HEADER 付き）への応答か
+
+	Checks []CheckResult `json:"checks,omitempty"` // 依存先チェック結果（?deep=true の場合のみ）
 }
 
 // MetricsResponse はメトリクス取得APIのレスポンス構造体
@@ -23,9 +33,58 @@ type MetricsResponse struct {
 	RequestCount  int64   `json:"request_count"`   // 総リクエスト数
 	Uptime        float64 `json:"uptime_seconds"`  // サービス稼働時間（秒）
 	MemoryUsageMB int64   `json:"memory_usage_mb"` // メモリ使用量（MB）
+	LatencyP95Ms  float64 `json:"latency_p95_ms"`  // 直近1000リクエストの p95 レイテンシ（ミリ秒）
+
+	GCFraction float64 `json:"gc_fraction"` // 起動後の経過時間のうち GC の停止時間が占める割合（0〜1）
+
+	FirstRequestLatencyMs float64 `json:"first_request_latency_ms" optional:"true"` // 起動後最初のリクエストのレイテンシ（ミリ秒、コールドスタートの計測用。未処理なら 0）
+
+	DistinctClientIPs int64 `json:"distinct_client_ips"` // 起動後に観測したクライアント IP の数（上限 10000 で頭打ち）
+
+	ConnectionReuseRatio float64 `json:"connection_reuse_ratio"` // リクエストのうちキープアライブで再利用されたコネクションで処理した割合（0〜1）
+
+	QueueWaitTimeMs float64 `json:"queue_wait_time_ms"` // MAX_CONCURRENT_REQUESTS の処理枠の空きを待った時間の累計（ミリ秒）
+
+	HealthCacheHits   int64 `json:"health_cache_hits"`   // 依存先チェックでキャッシュ済みの結果を返した回数（CHECK_CACHE_TTLS）
+	HealthCacheMisses int64 `json:"health_cache_misses"` // キャッシュ期間が設定された依存先チェックを実行した回数
+
+	OldestInflightAgeSeconds float64 `json:"oldest_inflight_age_seconds" optional:"true"` // 最も長く処理中のリクエストの経過時間（秒、処理中がなければ 0）
+	CurrentRPS               float64 `json:"current_rps"`                                 // 直近60秒の平均リクエストレート（件/秒）
+
+	LogBytesWritten int64 `json:"log_bytes_written"` // 構造化ログの総出力バイト数
+
+	PanicCount int64 `json:"panic_count"` // ハンドラーで発生した panic の総数
+
+	PanicsRecovered int64 `json:"panics_recovered"` // recoveryMiddleware で回復した panic の総数（回復後に 500 を返したもの）
+
+	ResponseSizeBytes HistogramSnapshot `json:"response_size_bytes"` // レスポンス本文サイズのヒストグラム（バイト）
+
+	LatencySuccessSeconds DurationHistogramSnapshot `json:"latency_success_seconds"` // 成功（2xx・3xx）したリクエストの処理時間のヒストグラム（秒）
+	LatencyErrorSeconds   DurationHistogramSnapshot `json:"latency_error_seconds"`   // 失敗（4xx・5xx）したリクエストの処理時間のヒストグラム（秒）
+
+	LastScrapeIntervalSeconds float64 `json:"last_scrape_interval_seconds" optional:"true"` // 直前の /metrics リクエストからの経過時間（秒、初回は 0）
+	AvgScrapeIntervalSeconds  float64 `json:"avg_scrape_interval_seconds" optional:"true"`  // /metrics リクエスト間隔の指数移動平均（秒）
+
+	ConfigReloadCount    int64  `json:"config_reload_count"`               // 設定リロード成功回数
+	LastConfigReloadTime string `json:"last_config_reload_time,omitempty"` // 最終リロード時刻（RFC3339、未リロード時は省略）
+
+	// プラットフォーム依存の値は取得できない環境ではゼロではなくキーごと省略する
+	OpenFDs *int64 `json:"open_fds,omitempty"` // オープン中のファイルディスクリプタ数（/proc/self/fd、非対応環境では省略）
+
+	Version         string `json:"version"`                    // 稼働中のバージョン
+	Generation      string `json:"generation" optional:"true"` // ロールアウト世代（ROLLOUT_GENERATION / K_REVISION）
+	ExpectedVersion string `json:"expected_version,omitempty"` // 期待バージョン（EXPECTED_VERSION 未設定時は省略）
+	VersionMatch    bool   `json:"version_match"`              // 稼働中のバージョンが期待バージョンと一致するか（未設定時は true）
+	Canary          bool   `json:"canary,omitempty"`           // カナリア検証用のリクエスト（CANARY_HEADER 付き）への応答か
+
+	Errors           []string `json:"errors,omitempty"`  // 取得に失敗したサンプラーとエラー内容
+	CollectionErrors int64    `json:"collection_errors"` // 取得に失敗（panic を含む）したサンプラーの数
+
+	lastRequest *requestExemplar // OpenMetrics のエグザンプラーに使用する直近のリクエスト
 }
 
 // グローバル変数でアプリケーション開始時刻とリクエストカウンターを管理
+// requestCount はシャード統合後の全体値（collector 経由で更新・参照する）
 var (
 	startTime    = time.Now()
 	requestCount int64
@@ -35,54 +94,134 @@ var (
 // Kubernetes/Cloud Run のヘルスチェック、ロードバランサー監視で使用
 // SREの可観測性（Observability）要件を満たす重要なエンドポイント
 func healthHandler(w http.ResponseWriter, r *http.Request) {
-	// リクエストカウンターをインクリメント（実装簡略化）
-	requestCount++
+	// リクエストカウンターをインクリメント
+	collector.RecordRequest()
 
-	// アプリケーションバージョンを環境変数から取得（デフォルト値設定）
-	version := os.Getenv("APP_VERSION")
-	if version == "" {
-		version = "1.0.0"
-	}
+	// アプリケーションバージョンを設定から取得（APP_VERSION、デフォルト "1.0.0"）
+	version := cfg().Version
 
 	// ヘルスチェックレスポンスを構築
 	health := HealthResponse{
-		Status:    "healthy",                       // 常に健康状態を返す（本格実装では内部状態をチェック）
+		Status:    "healthy",                       // プロセスが応答できていれば健康とみなす
 		Timestamp: time.Now().Format(time.RFC3339), // RFC3339形式の現在時刻
 		Version:   version,                         // アプリケーションバージョン
+		Message:   cfg().HealthMessage,             // ダッシュボード表示用の任意メッセージ
+
+		Generation: cfg().RolloutGeneration,
+		Canary:     isCanary(r.Context()),
+	}
+
+	// ?deep=true の場合のみ依存先チェックを実行
+	// デフォルトの浅いチェックはプロセス生存のみを確認し、プローブのレイテンシを低く保つ
+	status := http.StatusOK
+	// 任意の依存先のみ失敗した degraded 状態は、再起動を避けるため既定で 200 を返す
+	if deep, _ := strconv.ParseBool(r.URL.Query().Get("deep")); deep {
+		health.Checks, _ = healthChecks.Run(r.Context())
+		switch overallStatus(health.Checks) {
+		case healthStatusUnhealthy:
+			health.Status = healthStatusUnhealthy
+			status = http.StatusServiceUnavailable
+		case healthStatusDegraded:
+			health.Status = healthStatusDegraded
+			status = degradedStatusCode(true)
+		}
+	}
+	// シャットダウン開始後も liveness としては 200 のまま（ドレイン中の再起動を避ける）、
+	// 状態のみ shutting_down としてクライアントが新規リクエストを控えられるようにする
+	if notReady.Load() {
+		health.Status = healthStatusShuttingDown
+	}
+
+	if cfg().HealthFormat == healthFormatText {
+		writeHealthText(w, status)
+		log.Printf("Health check accessed - Status: %s, Version: %s", health.Status, version)
+		return
 	}
 
 	// JSONレスポンスヘッダーを設定
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	setCacheControl(w)
+	w.WriteHeader(status)
 
 	// JSONエンコードしてレスポンス送信
-	if err := json.NewEncoder(w).Encode(health); err != nil {
+	if err := encodeResponse(w, health); err != nil {
 		log.Printf("Error encoding health response: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		writeError(w, r, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Health check accessed - Status: healthy, Version: %s", version)
+	log.Printf("Health check accessed - Status: %s, Version: %s", health.Status, version)
 }
 
 // metricsHandler はメトリクス取得エンドポイント
 // Prometheus監視システムやAPMツールでの性能監視に使用
 // SREのSLI/SLO監視に必要なメトリクス提供
 func metricsHandler(w http.ResponseWriter, r *http.Request) {
-	requestCount++
+	collector.RecordRequest()
+	snap := collector.Snapshot()
 
 	// サービス稼働時間を計算
 	uptime := time.Since(startTime).Seconds()
 
-	// メモリ使用量を簡易取得（実装簡略化）
-	// 実際の本格実装では runtime.MemStats を使用
-	var memStats int64 = 50 // MB単位での仮想値
-
 	// メトリクスレスポンスを構築
 	metrics := MetricsResponse{
-		RequestCount:  requestCount,
-		Uptime:        uptime,
-		MemoryUsageMB: memStats,
+		RequestCount:      snap.RequestCount,
+		Uptime:            uptime,
+		LatencyP95Ms:      float64(snap.LatencyP95) / float64(time.Millisecond),
+		ConfigReloadCount: atomic.LoadInt64(&configReloadCount),
+		Version:           cfg().Version,
+		Generation:        cfg().RolloutGeneration,
+		ExpectedVersion:   cfg().ExpectedVersion,
+		VersionMatch:      versionMatches(),
+		Canary:            isCanary(r.Context()),
+	}
+	metrics.FirstRequestLatencyMs = float64(firstRequestLatency.Load()) / float64(time.Millisecond)
+	metrics.OldestInflightAgeSeconds = inflightRequests.OldestAge(time.Now()).Seconds()
+	metrics.CurrentRPS = requestRate.Rate(time.Now())
+	metrics.DistinctClientIPs = distinctClientIPs.Len()
+	metrics.ConnectionReuseRatio = connReuse.Ratio()
+	metrics.QueueWaitTimeMs = float64(queueWaitNanos.Load()) / float64(time.Millisecond)
+	metrics.HealthCacheHits = healthChecks.cacheHits.Load()
+	metrics.HealthCacheMisses = healthChecks.cacheMisses.Load()
+	metrics.LogBytesWritten = logBytesWritten.Load()
+	metrics.PanicCount = panicCount.Load()
+	metrics.PanicsRecovered = metrics.PanicCount
+	metrics.ResponseSizeBytes = responseSizes.Snapshot()
+	metrics.LatencySuccessSeconds = latencySuccess.Snapshot()
+	metrics.LatencyErrorSeconds = latencyError.Snapshot()
+	metrics.LastScrapeIntervalSeconds, metrics.AvgScrapeIntervalSeconds = metricsScrapes.Observe(time.Now())
+	metrics.lastRequest = lastRequestExemplar.Load()
+	if ts := atomic.LoadInt64(&lastConfigReloadUnix); ts != 0 {
+		metrics.LastConfigReloadTime = time.Unix(0, ts).Format(time.RFC3339Nano)
+	}
+
+	// メモリ・FD などプラットフォーム依存の値はサンプラーで取得
+	// 一部のサンプラーが失敗しても、取得できた値とエラー内容を返す（部分的成功）
+	runSamplers(&metrics)
+
+	setCacheControl(w)
+
+	// Prometheus スクレイパー向けにはテキスト形式で応答（?format=prometheus でも指定可能）
+	// Accept で application/openmetrics-text を優先された場合は OpenMetrics 形式で応答
+	format := negotiateContentType(r.Header.Get("Accept"), "application/json", "text/plain", "application/openmetrics-text")
+	if r.URL.Query().Get("format") == "prometheus" {
+		format = "text/plain"
+	}
+	switch format {
+	case "text/plain":
+		w.Header().Set("Content-Type", contentTypePrometheus)
+		w.WriteHeader(http.StatusOK)
+		if err := writePrometheus(w, promMetrics(metrics)); err != nil {
+			log.Printf("Error writing prometheus metrics: %v", err)
+		}
+		return
+	case "application/openmetrics-text":
+		w.Header().Set("Content-Type", contentTypeOpenMetrics)
+		w.WriteHeader(http.StatusOK)
+		if err := writeOpenMetrics(w, promMetrics(metrics)); err != nil {
+			log.Printf("Error writing openmetrics metrics: %v", err)
+		}
+		return
 	}
 
 	// JSONレスポンスヘッダーを設定
@@ -90,22 +229,34 @@ func metricsHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 
 	// JSONエンコードしてレスポンス送信
-	if err := json.NewEncoder(w).Encode(metrics); err != nil {
+	if err := encodeResponse(w, metrics); err != nil {
 		log.Printf("Error encoding metrics response: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		writeError(w, r, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Metrics accessed - Requests: %d, Uptime: %.2fs", requestCount, uptime)
+	log.Printf("Metrics accessed - Requests: %d, Uptime: %.2fs", snap.RequestCount, uptime)
 }
 
-// rootHandler はルートパスのハンドラー
-// 基本的なサービス情報を提供するランディングページ
-func rootHandler(w http.ResponseWriter, r *http.Request) {
-	requestCount++
+// versionMatches は稼働中のバージョンが EXPECTED_VERSION と一致するかを返す
+// ローリングデプロイ中の新旧混在を中央の監視側で集計するために使用
+// 期待バージョン未設定時は比較対象がないため一致とみなす
+func versionMatches() bool {
+	c := cfg()
+	return c.ExpectedVersion == "" || c.ExpectedVersion == c.Version
+}
+
+// setCacheControl は監視系レスポンスに Cache-Control ヘッダーを付与する
+// 中間プロキシやスクレイパーが古い監視データをキャッシュすることを防ぐ
+func setCacheControl(w http.ResponseWriter) {
+	if cfg().CacheControl != "" {
+		w.Header().Set("Cache-Control", cfg().CacheControl)
+	}
+}
 
-	// シンプルなHTMLレスポンス
-	html := `<!DOCTYPE html>
+// rootTemplate はランディングページのHTMLテンプレート
+// BASE_PATH 配下で動作する場合もリンクが正しく解決されるようプレフィックスを埋め込む
+var rootTemplate = template.Must(template.New("root").Parse(`<!DOCTYPE html>
 <html>
 <head>
     <title>SRE Workflow Demo</title>
@@ -115,68 +266,216 @@ func rootHandler(w http.ResponseWriter, r *http.Request) {
     <h1>SRE Workflow Demo Application</h1>
     <p>Golang製のSREワークフロー検証用アプリケーションです。</p>
     <ul>
-        <li><a href="/health">Health Check</a> - サービス生存確認</li>
-        <li><a href="/metrics">Metrics</a> - 監視用メトリクス</li>
+        <li><a href="{{.BasePath}}/health">Health Check</a> - サービス生存確認</li>
+        <li><a href="{{.BasePath}}/metrics">Metrics</a> - 監視用メトリクス</li>
     </ul>
     <p>Container Image: 署名付きでセキュアにデプロイ済み</p>
 </body>
-</html>`
+</html>`))
+
+// rootHandler はルートパスのハンドラー
+// 基本的なサービス情報を提供するランディングページ
+func rootHandler(w http.ResponseWriter, r *http.Request) {
+	collector.RecordRequest()
+
+	// テンプレートをバッファに描画してからレスポンス送信（描画失敗時に500を返せるように）
+	var buf bytes.Buffer
+	data := struct{ BasePath string }{BasePath: cfg().BasePath}
+	if err := rootTemplate.Execute(&buf, data); err != nil {
+		log.Printf("Error rendering root page: %v", err)
+		writeError(w, r, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// ランディングページは静的な内容のため、設定に応じてキャッシュを許可する
+	if cc := cfg().RootCacheControl; cc != "" {
+		w.Header().Set("Cache-Control", cc)
+	}
+	// CSP は HTML レスポンスにのみ付与する（JSON エンドポイントには不要）
+	if csp := cfg().RootCSP; csp != "" {
+		w.Header().Set("Content-Security-Policy", csp)
+	}
 	w.WriteHeader(http.StatusOK)
-	fmt.Fprint(w, html)
+	buf.WriteTo(w)
 
 	log.Printf("Root page accessed from %s", r.RemoteAddr)
 }
 
+// eventHTTPAccess はアクセスログのイベント名
+const eventHTTPAccess = "http.access"
+
 // logMiddleware はHTTPリクエストをログ出力するミドルウェア
 // SREの監視要件：すべてのリクエストをトレース可能にする
 func logMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
+		// 滞留リクエスト検知のため処理中の開始時刻を記録
+		defer inflightRequests.end(inflightRequests.begin(start))
+
+		// ハンドラーが AddLogField で追加したフィールドをアクセスログに含める
+		ctx, fields := withLogFields(r.Context())
+		r = r.WithContext(ctx)
+		// LOG_BODY 有効時はハンドラーが読み取った本文の先頭を記録する
+		body := captureBody(r, cfg())
 
-		// リクエスト処理を実行
-		next(w, r)
+		// リクエスト処理を実行（レスポンスサイズのヒストグラム用に書き込みバイト数を数える）
+		sw := &sizeCountingResponseWriter{ResponseWriter: w}
+		next(sw, r)
 
 		// 処理時間とリクエスト情報をログ出力
 		duration := time.Since(start)
-		log.Printf("%s %s %s - Duration: %v",
-			r.Method,
-			r.RequestURI,
-			r.RemoteAddr,
-			duration)
+		collector.ObserveLatency(duration)
+		requestRate.Observe(start)
+		responseSizes.Observe(sw.bytes)
+		observeLatencyByOutcome(sw.Status(), duration)
+		observeFirstRequest(duration)
+		distinctClientIPs.Add(clientIP(r))
+
+		// 構造化アクセスログとして出力
+		// duration は人が読む表記、duration_us はサブミリ秒の高速なエンドポイントも集計できる数値
+		// （マイクロ秒未満で丸めて 0 にならないよう小数で出力）
+		attrs := []any{
+			"method", r.Method,
+			"uri", r.RequestURI,
+			"remote_addr", r.RemoteAddr,
+			"duration", duration.String(),
+			"duration_us", float64(duration.Nanoseconds()) / 1e3,
+		}
+		// mTLS 有効時は検証済みクライアント証明書の CN も記録（呼び出し元サービスの特定用）
+		if cn := clientCommonName(r); cn != "" {
+			attrs = append(attrs, "client_cn", cn)
+		}
+		if id := requestIDFromContext(r.Context()); id != "" {
+			attrs = append(attrs, "request_id", id)
+			lastRequestExemplar.Store(&requestExemplar{requestID: id, time: start})
+		}
+		attrs = append(attrs, traceparentAttrs(r, cfg())...)
+		attrs = append(attrs, cloudTraceAttrs(r, cfg())...)
+		attrs = append(attrs, body.attrs()...)
+		attrs = append(attrs, fields.snapshot()...)
+		if !logExcluded(r.URL.Path) {
+			logger.Info(eventHTTPAccess, attrs...)
+		}
+
+		accessLogBatcher.Add(AccessLogRecord{
+			Time:          start,
+			Method:        r.Method,
+			URI:           r.RequestURI,
+			RemoteAddr:    r.RemoteAddr,
+			RequestID:     requestIDFromContext(r.Context()),
+			Duration:      duration,
+			ResponseBytes: sw.bytes,
+		})
+		recentRequests.Add(RequestLogEntry{
+			Time:       start.Format(time.RFC3339Nano),
+			Method:     r.Method,
+			URI:        r.RequestURI,
+			RemoteAddr: r.RemoteAddr,
+			DurationMs: float64(duration) / float64(time.Millisecond),
+			RequestID:  requestIDFromContext(r.Context()),
+		})
 	}
 }
 
-func main() {
-	// ポート番号を環境変数から取得（Cloud Run では PORT が自動設定される）
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080" // Golangの一般的なデフォルトポート
+// logExcluded は path が LOG_EXCLUDE_PATHS に含まれ、アクセスログを出力しないかを判定する
+// 毎秒実行されるプローブでアクセスログが埋まるのを防ぐ
+func logExcluded(path string) bool {
+	for _, p := range cfg().LogExcludePaths {
+		if p == path {
+			return true
+		}
 	}
+	return false
+}
 
-	// アプリケーション開始ログ
-	log.Printf("Starting SRE Workflow Demo Server on port %s", port)
-	log.Printf("Start time: %s", startTime.Format(time.RFC3339))
+func main() {
+	// 環境変数から設定を読み込み（Cloud Run では PORT が自動設定される）
+	// 不正な設定の場合は明確なエラーを出して非ゼロで終了
+	c, err := loadConfig()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	setConfig(c)
+	// 構造化ログ・ハンドラーのテキストログとも LOG_DEST に出力する
+	logger = newDestLogger(cfg(), os.Stdout, os.Stderr)
+	log.SetOutput(logDestWriter(cfg(), os.Stdout, os.Stderr))
+	port := cfg().Port
 
-	// HTTPルーティング設定
-	// ミドルウェアを適用してすべてのリクエストをログ出力
-	http.HandleFunc("/", logMiddleware(rootHandler))
-	http.HandleFunc("/health", logMiddleware(healthHandler))
-	http.HandleFunc("/metrics", logMiddleware(metricsHandler))
+	// SIGHUP による設定リロードを有効化
+	watchReloadSignal()
+	// SIGQUIT で診断ダンプを出力（終了はしない）
+	if cfg().SigquitDump {
+		defer watchDiagnosticSignal()()
+	}
 
 	// HTTPサーバー設定
-	// 本格的なSREワークフローではタイムアウト設定が重要
-	server := &http.Server{
-		Addr:         ":" + port,
-		ReadTimeout:  15 * time.Second, // リクエスト読み取りタイムアウト
-		WriteTimeout: 15 * time.Second, // レスポンス書き込みタイムアウト
-		IdleTimeout:  60 * time.Second, // アイドル接続タイムアウト
+	server := newHTTPServer(cfg(), ":"+port, newRouter())
+
+	// 深いヘルスチェック用の依存先チェックを登録
+	checkRetryBudget = newRetryBudget(cfg().RetryBudget, cfg().RetryBudgetRefill)
+	if ttl := cfg().DNSCacheTTL; ttl > 0 {
+		checkDNSCache = newDNSCache(ttl)
 	}
+	registerCheckers(cfg())
 
-	// HTTPサーバー開始
-	log.Printf("Server listening on :%s", port)
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		log.Fatalf("Server failed to start: %v", err)
+	// RATE_LIMIT 設定時はプローブ以外のリクエストのレートを制限
+	requestRateLimiter = newRequestLimiter(cfg())
+	globalRequestSlots = newRequestSlots(cfg().MaxConcurrentRequests)
+
+	// TLS_CERT_FILE / TLS_KEY_FILE 設定時は TLS（TLS_CLIENT_CA 設定時は mTLS）で待ち受け
+	tlsConfig, err := newTLSConfig(cfg())
+	if err != nil {
+		log.Fatalf("Invalid TLS configuration: %v", err)
 	}
+	server.TLSConfig = tlsConfig
+
+	// SIGTERM（Cloud Run のインスタンス停止通知）/ SIGINT・ウォッチドッグ・管理用リスナーの異常停止で
+	// グレースフルシャットダウンし、原因に応じた終了コードで終了する
+	ctx, shutdown := context.WithCancelCause(context.Background())
+	defer shutdown(nil)
+	defer notifyShutdownSignals(shutdown)()
+
+	// メトリクスのシャード統合をバックグラウンドで開始
+	collector.startFlusher(ctx, cfg().MetricsFlushInterval)
+
+	// アクセスログをバッチにまとめてログシンクへ送信（accessLogSink 設定時のみ送信される）
+	accessLogBatcher = newLogBatcher(accessLogSink, cfg().LogSinkBatchSize)
+	logsFlushed := accessLogBatcher.Run(ctx, cfg().LogSinkFlushInterval)
+
+	// 依存先チェックのバックグラウンド実行（BACKGROUND_CHECK_INTERVAL 設定時のみ）
+	if interval := cfg().BackgroundCheckInterval; interval > 0 {
+		wd := &watchdog{max: cfg().WatchdogFailures, trip: shutdown}
+		startBackgroundChecks(ctx, interval, cfg().BackgroundCheckJitter, wd)
+	}
+
+	// 初回の依存先チェックを実行し、完了後にスタートアッププローブ（/startupz）を 200 にする
+	go runStartup(ctx)
+
+	// 依存先のホスト名の名前解決結果をバックグラウンドで更新（DNS_CACHE_TTL 設定時のみ）
+	if checkDNSCache != nil {
+		go checkDNSCache.run(ctx)
+	}
+
+	// ハング検知用のハートビートログ（HEARTBEAT_INTERVAL 設定時のみ）
+	if interval := cfg().HeartbeatInterval; interval > 0 {
+		startHeartbeat(ctx, interval)
+	}
+
+	servers := []namedServer{{listener: listenerPublic, server: server}}
+	// ADMIN_PORT 設定時はメトリクス・デバッグ用の管理用リスナーを別ポートで起動
+	// 公開リスナーとライフサイクルを共有し、アイドル接続タイムアウトのみ個別に設定する
+	if adminPort := cfg().AdminPort; adminPort != "" {
+		admin := newAdminHTTPServer(cfg(), ":"+adminPort, newAdminRouter())
+		admin.TLSConfig = tlsConfig
+		servers = append(servers, namedServer{listener: listenerAdmin, server: admin})
+	}
+
+	// HTTPサーバー開始（ライフサイクルイベントは runServers が listener 付きの構造化ログで出力）
+	// いずれかのリスナーが異常停止した場合も、両方のドレインが完了してから返る
+	serveErr := runServers(ctx, servers...)
+	// 待ち受けに失敗した場合もバックグラウンド処理を停止し、アクセスログの最終送信を待ってから終了する
+	shutdown(serveErr)
+	<-logsFlushed
+	exitAfterShutdown(ctx, serveErr)
 }
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -178,6 +180,305 @@ func TestLogMiddleware(t *testing.T) {
 	}
 }
 
+// TestLogMiddlewareDurationMicros はアクセスログのマイクロ秒単位の処理時間のテスト
+// サブミリ秒で終わる高速なエンドポイントでも処理時間を数値で計測できることを保証
+func TestLogMiddlewareDurationMicros(t *testing.T) {
+	logs := captureLogs(t)
+
+	logMiddleware(func(w http.ResponseWriter, r *http.Request) {})(
+		httptest.NewRecorder(), httptest.NewRequest("GET", "/health", nil))
+
+	entries := logs.entries(t)
+	if len(entries) != 1 || entries[0]["msg"] != eventHTTPAccess {
+		t.Fatalf("Expected one access log entry, got %v", entries)
+	}
+	us, ok := entries[0]["duration_us"].(float64)
+	if !ok {
+		t.Fatalf("duration_us should be numeric, got %v", entries[0]["duration_us"])
+	}
+	if us <= 0 || us >= 1e6 {
+		t.Errorf("Expected small non-zero duration_us, got %v", us)
+	}
+	if _, ok := entries[0]["duration"].(string); !ok {
+		t.Errorf("Human-readable duration should be kept alongside, got %v", entries[0]["duration"])
+	}
+}
+
+// TestAddLogField はハンドラーが追加したフィールドのアクセスログ出力テスト
+// タイムアウト用に別ゴルーチンで動くハンドラーからの追加も反映されることを保証
+func TestAddLogField(t *testing.T) {
+	logs := captureLogs(t)
+
+	handler := logMiddleware(timeoutMiddleware(time.Second, func(w http.ResponseWriter, r *http.Request) {
+		AddLogField(r.Context(), "user_id", "u-123")
+		AddLogField(r.Context(), "tenant", "acme")
+		AddLogField(r.Context(), "tenant", "globex")
+	}))
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	entries := logs.entries(t)
+	if len(entries) != 1 || entries[0]["msg"] != eventHTTPAccess {
+		t.Fatalf("Expected one access log entry, got %v", entries)
+	}
+	if entries[0]["user_id"] != "u-123" {
+		t.Errorf("Expected user_id field, got %v", entries[0]["user_id"])
+	}
+	if entries[0]["tenant"] != "globex" {
+		t.Errorf("Expected later value to overwrite tenant, got %v", entries[0]["tenant"])
+	}
+
+	// logMiddleware 外のコンテキストでは何もしない
+	AddLogField(context.Background(), "ignored", true)
+}
+
+// TestLogBody はアクセスログへのリクエスト本文の記録テスト
+// 上限で切り詰めた本文がログに出力され、ハンドラーは本文全体を読み取れることを保証
+func TestLogBody(t *testing.T) {
+	logs := captureLogs(t)
+	withConfig(t, func(c *Config) {
+		c.LogBody = true
+		c.LogBodyMaxBytes = 8
+	})
+
+	var got string
+	handler := logMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("ReadAll: %v", err)
+		}
+		got = string(b)
+	})
+	handler(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader("0123456789abcdef")))
+
+	if got != "0123456789abcdef" {
+		t.Errorf("Handler should read the full body, got %q", got)
+	}
+	entries := logs.entries(t)
+	if len(entries) != 1 {
+		t.Fatalf("Expected one access log entry, got %v", entries)
+	}
+	if entries[0]["body"] != "01234567" || entries[0]["body_truncated"] != true {
+		t.Errorf("Expected truncated body in log, got %v (truncated=%v)", entries[0]["body"], entries[0]["body_truncated"])
+	}
+
+	// 無効時は本文を記録しない
+	withConfig(t, func(c *Config) { c.LogBody = false })
+	handler(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader("secret")))
+	if e := logs.entries(t); len(e) != 2 || e[1]["body"] != nil {
+		t.Errorf("Body should not be logged when LOG_BODY is disabled: %v", e)
+	}
+}
+
+// TestLogExcludePaths はアクセスログの除外パスのテスト
+// 除外したパスはログに出力されずメトリクスには計上され、それ以外のパスは引き続きログに出力されることを保証
+func TestLogExcludePaths(t *testing.T) {
+	logs := captureLogs(t)
+	withConfig(t, func(c *Config) { c.LogExcludePaths = []string{"/livez"} })
+	handler := logMiddleware(func(w http.ResponseWriter, r *http.Request) {})
+
+	before := responseSizes.Snapshot().Count
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/livez", nil))
+	if got := len(logs.entries(t)); got != 0 {
+		t.Errorf("Expected no access log for excluded path, got %d entries", got)
+	}
+	if responseSizes.Snapshot().Count != before+1 {
+		t.Error("Excluded path should still be counted in metrics")
+	}
+
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	entries := logs.entries(t)
+	if len(entries) != 1 || entries[0]["uri"] != "/" {
+		t.Errorf("Expected access log for /, got %v", entries)
+	}
+}
+
+// TestHealthMessage はヘルスチェックの任意メッセージ設定のテスト
+// 設定時はメッセージが含まれ、未設定時はフィールド自体が省略されることを保証
+func TestHealthMessage(t *testing.T) {
+	rr := httptest.NewRecorder()
+	healthHandler(rr, httptest.NewRequest("GET", "/health", nil))
+	if strings.Contains(rr.Body.String(), `"message"`) {
+		t.Errorf("Message should be omitted by default: %s", rr.Body.String())
+	}
+
+	withConfig(t, func(c *Config) { c.HealthMessage = "All systems operational" })
+
+	rr = httptest.NewRecorder()
+	healthHandler(rr, httptest.NewRequest("GET", "/health", nil))
+
+	var health HealthResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &health); err != nil {
+		t.Fatalf("Could not unmarshal response: %v", err)
+	}
+	if health.Message != "All systems operational" {
+		t.Errorf("Expected configured message, got '%s'", health.Message)
+	}
+}
+
+// TestMonitoringCacheControl は監視系エンドポイントのキャッシュ制御ヘッダーのテスト
+// 中間プロキシに古い監視データをキャッシュさせないことを保証
+func TestMonitoringCacheControl(t *testing.T) {
+	handlers := map[string]http.HandlerFunc{
+		"/health":  healthHandler,
+		"/metrics": metricsHandler,
+	}
+
+	for path, h := range handlers {
+		req := httptest.NewRequest("GET", path, nil)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if cc := rr.Header().Get("Cache-Control"); cc != "no-store" {
+			t.Errorf("%s: expected Cache-Control 'no-store', got '%s'", path, cc)
+		}
+	}
+}
+
+// TestRootContentSecurityPolicy はルートページの CSP ヘッダーのテスト
+// HTML のランディングページにのみ制限的な CSP が付与され、JSON エンドポイントには付与されないことを保証
+func TestRootContentSecurityPolicy(t *testing.T) {
+	rr := httptest.NewRecorder()
+	rootHandler(rr, httptest.NewRequest("GET", "/", nil))
+	if csp := rr.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "default-src 'none'") {
+		t.Errorf("Expected restrictive CSP on root page by default, got '%s'", csp)
+	}
+
+	for path, h := range map[string]http.HandlerFunc{"/health": healthHandler, "/metrics": metricsHandler} {
+		rr := httptest.NewRecorder()
+		h(rr, httptest.NewRequest("GET", path, nil))
+		if csp := rr.Header().Get("Content-Security-Policy"); csp != "" {
+			t.Errorf("%s: CSP should not be set on JSON responses, got '%s'", path, csp)
+		}
+	}
+
+	// 設定値で上書き・空文字で無効化できる
+	t.Setenv("CONTENT_SECURITY_POLICY", "default-src 'self'")
+	setConfig(mustLoadConfig(t))
+	t.Cleanup(func() { setConfig(defaultConfig()) })
+	rr = httptest.NewRecorder()
+	rootHandler(rr, httptest.NewRequest("GET", "/", nil))
+	if csp := rr.Header().Get("Content-Security-Policy"); csp != "default-src 'self'" {
+		t.Errorf("Expected configured CSP, got '%s'", csp)
+	}
+
+	t.Setenv("CONTENT_SECURITY_POLICY", "")
+	setConfig(mustLoadConfig(t))
+	rr = httptest.NewRecorder()
+	rootHandler(rr, httptest.NewRequest("GET", "/", nil))
+	if _, ok := rr.Header()["Content-Security-Policy"]; ok {
+		t.Error("Empty CONTENT_SECURITY_POLICY should disable the header")
+	}
+}
+
+// TestRootCacheControl はルートページのキャッシュ制御設定のテスト
+// 監視系とは独立して、静的なランディングページのキャッシュを許可できることを保証
+func TestRootCacheControl(t *testing.T) {
+	// デフォルトではヘッダーを付与しない
+	rr := httptest.NewRecorder()
+	rootHandler(rr, httptest.NewRequest("GET", "/", nil))
+	if cc := rr.Header().Get("Cache-Control"); cc != "" {
+		t.Errorf("Expected no Cache-Control on root by default, got '%s'", cc)
+	}
+
+	withConfig(t, func(c *Config) { c.RootCacheControl = "public, max-age=300" })
+
+	rr = httptest.NewRecorder()
+	rootHandler(rr, httptest.NewRequest("GET", "/", nil))
+	if cc := rr.Header().Get("Cache-Control"); cc != "public, max-age=300" {
+		t.Errorf("Expected configured Cache-Control on root, got '%s'", cc)
+	}
+
+	// ルートページの設定は監視系エンドポイントに影響しない
+	rr = httptest.NewRecorder()
+	healthHandler(rr, httptest.NewRequest("GET", "/health", nil))
+	if cc := rr.Header().Get("Cache-Control"); cc != "no-store" {
+		t.Errorf("Expected Cache-Control 'no-store' on /health, got '%s'", cc)
+	}
+}
+
+// TestLoadConfigCacheControl は Cache-Control 設定の読み込みテスト
+func TestLoadConfigCacheControl(t *testing.T) {
+	t.Setenv("CACHE_CONTROL", "no-cache, max-age=0")
+	if c := mustLoadConfig(t); c.CacheControl != "no-cache, max-age=0" {
+		t.Errorf("Expected configured Cache-Control, got '%s'", c.CacheControl)
+	}
+
+	// 空文字指定でヘッダー付与を無効化できること
+	t.Setenv("CACHE_CONTROL", "")
+	if c := mustLoadConfig(t); c.CacheControl != "" {
+		t.Errorf("Expected empty Cache-Control, got '%s'", c.CacheControl)
+	}
+}
+
+// TestBasePath はサブパス配下での動作テスト
+// リバースプロキシのサブパス配下でもルーティングとリンクが正しく機能することを保証
+func TestBasePath(t *testing.T) {
+	t.Setenv("BASE_PATH", "/app/")
+	setConfig(mustLoadConfig(t))
+	t.Cleanup(func() { setConfig(defaultConfig()) })
+
+	router := newRouter()
+
+	// プレフィックス付きパスでヘルスチェックが応答すること
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/app/health", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected 200 for /app/health, got %d", rr.Code)
+	}
+
+	// ルートページのリンクにプレフィックスが含まれること
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/app/", nil))
+	body := rr.Body.String()
+	if !strings.Contains(body, `href="/app/health"`) || !strings.Contains(body, `href="/app/metrics"`) {
+		t.Errorf("Root page links should include base path: %s", body)
+	}
+
+	// プレフィックス外のパスは 404
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/health", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 outside base path, got %d", rr.Code)
+	}
+}
+
+// TestMetricsVersionMatch は期待バージョンとの一致判定のテスト
+// ローリングデプロイ中の新旧混在を中央で集計できることを保証
+func TestMetricsVersionMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		want     bool
+	}{
+		{"matching", "2.0.0", true},
+		{"mismatching", "2.1.0", false},
+		{"unset", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withConfig(t, func(c *Config) {
+				c.Version = "2.0.0"
+				c.ExpectedVersion = tt.expected
+			})
+
+			rr := httptest.NewRecorder()
+			metricsHandler(rr, httptest.NewRequest("GET", "/metrics", nil))
+
+			var metrics MetricsResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &metrics); err != nil {
+				t.Fatalf("Could not unmarshal response: %v", err)
+			}
+			if metrics.VersionMatch != tt.want {
+				t.Errorf("VersionMatch: got %v want %v", metrics.VersionMatch, tt.want)
+			}
+			if metrics.Version != "2.0.0" {
+				t.Errorf("Expected running version '2.0.0', got '%s'", metrics.Version)
+			}
+		})
+	}
+}
+
 // BenchmarkHealthHandler はヘルスチェックエンドポイントのベンチマークテスト
 // SREパフォーマンス要件：レスポンス時間の測定
 func BenchmarkHealthHandler(b *testing.B) {
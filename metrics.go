@@ -0,0 +1,546 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"math/rand"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// metricsShardCount はリクエストカウンターのシャード数
+// 高RPS時に単一カウンターへの書き込みが集中しないよう分散させる
+const metricsShardCount = 32
+
+// counterShard はキャッシュライン単位で分離したカウンター
+// 隣接シャードとの false sharing を避けるためパディングする
+type counterShard struct {
+	n int64
+	_ [56]byte
+}
+
+// latencyWindowSize はレイテンシのパーセンタイル算出に使う直近リクエスト数
+const latencyWindowSize = 1000
+
+// MetricsSnapshot はある時点のメトリクス集計値
+type MetricsSnapshot struct {
+	RequestCount int64         // 総リクエスト数
+	LatencyP95   time.Duration // 直近 latencyWindowSize 件の p95 レイテンシ
+}
+
+// metricsCollector はリクエスト単位のメトリクスを集計するコレクター
+// ホットパスではシャードに加算するだけにし、バックグラウンドで定期的に全体値へ統合する
+type metricsCollector struct {
+	shards  [metricsShardCount]counterShard
+	mergeMu sync.Mutex // シャードの統合処理を直列化
+
+	latency latencyWindow // 直近リクエストのレイテンシ
+}
+
+// collector はアプリケーション全体で共有するメトリクスコレクター
+var collector = &metricsCollector{}
+
+// RecordRequest はリクエストを1件記録する
+// ランダムに選んだシャードへ加算するため、ゴルーチン間の競合が少ない
+func (c *metricsCollector) RecordRequest() {
+	i := rand.Uint32() % metricsShardCount
+	atomic.AddInt64(&c.shards[i].n, 1)
+}
+
+// flush は各シャードの未統合分を全体カウンター（requestCount）へ統合する
+func (c *metricsCollector) flush() {
+	c.mergeMu.Lock()
+	defer c.mergeMu.Unlock()
+
+	var pending int64
+	for i := range c.shards {
+		pending += atomic.SwapInt64(&c.shards[i].n, 0)
+	}
+	if pending != 0 {
+		atomic.AddInt64(&requestCount, pending)
+	}
+}
+
+// Snapshot は現在の集計値を返す
+// バックグラウンド統合を待たずに未統合分も反映するため、常に正確な値になる
+func (c *metricsCollector) Snapshot() MetricsSnapshot {
+	c.flush()
+	return MetricsSnapshot{
+		RequestCount: atomic.LoadInt64(&requestCount),
+		LatencyP95:   c.latency.Percentile(0.95),
+	}
+}
+
+// ObserveLatency はリクエストの処理時間を記録する
+func (c *metricsCollector) ObserveLatency(d time.Duration) {
+	c.latency.Observe(d)
+}
+
+// startFlusher は一定間隔でシャードを統合するバックグラウンド処理を開始する
+// ctx がキャンセルされると最後に一度統合してから終了し、返り値のチャネルが閉じられる
+func (c *metricsCollector) startFlusher(ctx context.Context, interval time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer close(done)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.flush()
+			case <-ctx.Done():
+				c.flush()
+				return
+			}
+		}
+	}()
+	return done
+}
+
+// latencyWindow は直近 latencyWindowSize 件のレイテンシを保持するリングバッファ
+// 累積ヒストグラムと異なり古いリクエストの影響が残らないため、現在の挙動を素早く反映する
+type latencyWindow struct {
+	mu      sync.Mutex
+	samples [latencyWindowSize]time.Duration
+	next    int // 次に書き込む位置
+	count   int // 記録済みの件数（最大 latencyWindowSize）
+}
+
+// Observe はレイテンシを1件記録する（バッファが満杯なら最も古い値を上書き）
+func (lw *latencyWindow) Observe(d time.Duration) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	lw.samples[lw.next] = d
+	lw.next = (lw.next + 1) % latencyWindowSize
+	if lw.count < latencyWindowSize {
+		lw.count++
+	}
+}
+
+// Percentile はウィンドウ内のレイテンシの p パーセンタイル（0 < p <= 1）を返す
+// 最近傍順位法で算出し、記録がない場合は 0 を返す
+func (lw *latencyWindow) Percentile(p float64) time.Duration {
+	lw.mu.Lock()
+	sorted := make([]time.Duration, lw.count)
+	copy(sorted, lw.samples[:lw.count])
+	lw.mu.Unlock()
+
+	if len(sorted) == 0 {
+		return 0
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+// memStatsCache は runtime.ReadMemStats の結果を一定時間キャッシュする
+// ReadMemStats は stop-the-world を伴うため、高頻度のスクレイプで毎回呼ばないようにする
+type memStatsCache struct {
+	mu    sync.Mutex
+	read  func(*runtime.MemStats) // 差し替え可能な読み取り関数（テスト用）
+	now   func() time.Time        // 差し替え可能な時計（テスト用）
+	last  time.Time               // 最後に読み取った時刻（ゼロ値は未読み取り）
+	stats runtime.MemStats
+}
+
+// memStats はアプリケーション全体で共有するメモリ統計キャッシュ
+var memStats = &memStatsCache{read: runtime.ReadMemStats, now: time.Now}
+
+// Get はメモリ統計を返す
+// 前回の読み取りから MEMSTATS_INTERVAL 以内であればキャッシュ値を再利用する
+func (c *memStatsCache) Get() runtime.MemStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if c.last.IsZero() || now.Sub(c.last) >= cfg().MemStatsInterval {
+		c.read(&c.stats)
+		c.last = now
+	}
+	return c.stats
+}
+
+// invalidate はキャッシュを破棄し、次回の Get で必ず再読み取りさせる
+// メモリ使用量を意図的に変化させた直後（/debug/alloc など）に使用する
+func (c *memStatsCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.last = time.Time{}
+}
+
+// metricsSampler はメトリクスの一部を取得するサンプラー
+// /proc の読み取りなど失敗し得る処理を分離し、失敗しても他の値の取得を妨げないようにする
+type metricsSampler struct {
+	name   string
+	sample func(m *MetricsResponse) error
+}
+
+// metricsSamplers は /metrics で実行するサンプラーの一覧（テストで差し替え可能）
+var metricsSamplers = []metricsSampler{
+	{name: "memory", sample: sampleMemory},
+	{name: "open_fds", sample: sampleOpenFDs},
+}
+
+// runSamplers はすべてのサンプラーを実行し、失敗したものを m.Errors と m.CollectionErrors に記録する
+// panic したサンプラーも失敗として扱い、残りのサンプラーの実行とレスポンスを継続する
+func runSamplers(m *MetricsResponse) {
+	for _, s := range metricsSamplers {
+		if err := runSampler(s, m); err != nil {
+			m.Errors = append(m.Errors, fmt.Sprintf("%s: %v", s.name, err))
+			m.CollectionErrors++
+		}
+	}
+}
+
+// runSampler は1つのサンプラーを実行し、panic をエラーに変換する
+func runSampler(s metricsSampler, m *MetricsResponse) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("panic: %v", v)
+		}
+	}()
+	return s.sample(m)
+}
+
+// memoryUsageMB はヒープ使用量をMB単位で返す
+// 1MB未満でも使用中であることを示すため切り上げる
+func memoryUsageMB() int64 {
+	m := memStats.Get()
+	return int64((m.HeapAlloc + (1<<20 - 1)) >> 20)
+}
+
+// sampleMemory はヒープ使用量と GC 時間の割合を取得する
+// /debug/alloc で保持したメモリも反映される
+func sampleMemory(m *MetricsResponse) error {
+	m.MemoryUsageMB = memoryUsageMB()
+	m.GCFraction = gcFraction(memStats.Get().PauseTotalNs, time.Since(startTime))
+	return nil
+}
+
+// gcFraction は経過時間 uptime のうち GC の停止時間（PauseTotalNs）が占める割合を返す
+// GC 負荷の高まりを検知するためのもので、0〜1 の範囲に収める
+func gcFraction(pauseTotalNs uint64, uptime time.Duration) float64 {
+	if uptime <= 0 {
+		return 0
+	}
+	return math.Min(float64(pauseTotalNs)/float64(uptime), 1)
+}
+
+// procSelfFD はオープン中のファイルディスクリプタ一覧のパス（テストで差し替え可能）
+var procSelfFD = "/proc/self/fd"
+
+// sampleOpenFDs はオープン中のファイルディスクリプタ数を /proc/self/fd から取得する
+// "too many open files" 障害の予兆検知に使用
+// /proc がないプラットフォームでは非対応として値を設定せず、エラーにもしない
+func sampleOpenFDs(m *MetricsResponse) error {
+	n, err := openFDCount()
+	m.OpenFDs = n
+	return err
+}
+
+// openFDCount はオープン中のファイルディスクリプタ数を返す（/proc がない場合は nil）
+func openFDCount() (*int64, error) {
+	entries, err := os.ReadDir(procSelfFD)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	n := int64(len(entries))
+	return &n, nil
+}
+
+// inflightTracker は処理中リクエストの開始時刻を追跡する
+// 完了するまで集計レイテンシに現れない滞留リクエストを検知するために使用
+type inflightTracker struct {
+	mu     sync.Mutex
+	nextID uint64
+	starts map[uint64]time.Time
+}
+
+// inflightRequests はアプリケーション全体で共有する処理中リクエストの追跡
+var inflightRequests = &inflightTracker{starts: make(map[uint64]time.Time)}
+
+// begin はリクエストの開始を記録し、終了時に end へ渡す ID を返す
+func (t *inflightTracker) begin(start time.Time) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.nextID++
+	t.starts[t.nextID] = start
+	return t.nextID
+}
+
+// end はリクエストの終了を記録する
+func (t *inflightTracker) end(id uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.starts, id)
+}
+
+// OldestAge は最も長く処理中のリクエストの経過時間を返す（処理中がなければ 0）
+func (t *inflightTracker) OldestAge(now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var oldest time.Duration
+	for _, start := range t.starts {
+		if age := now.Sub(start); age > oldest {
+			oldest = age
+		}
+	}
+	return oldest
+}
+
+// distinctClientIPsMax は distinctClientIPs が記録するクライアント IP 数の上限
+// 上限到達後は新しい IP を記録せず、件数は上限で頭打ちになる（メモリ使用量を一定に保つため）
+const distinctClientIPsMax = 10000
+
+// distinctSet は上限付きの重複なし集合
+// トラフィックの発生元の規模を把握するためのもので、上限以上の正確な件数は求めない
+type distinctSet struct {
+	mu    sync.Mutex
+	max   int
+	items map[string]struct{}
+}
+
+// newDistinctSet は最大 max 件を記録する集合を作成する
+func newDistinctSet(max int) *distinctSet {
+	return &distinctSet{max: max, items: make(map[string]struct{})}
+}
+
+// Add は値を記録する（上限到達後の新しい値は無視する）
+func (s *distinctSet) Add(v string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.items[v]; ok || len(s.items) >= s.max {
+		return
+	}
+	s.items[v] = struct{}{}
+}
+
+// Len は記録済みの件数を返す
+func (s *distinctSet) Len() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return int64(len(s.items))
+}
+
+// distinctClientIPs は起動後に観測したクライアント IP（TRUSTED_PROXIES を考慮して解決したもの）
+var distinctClientIPs = newDistinctSet(distinctClientIPsMax)
+
+// firstRequestLatency は起動後に最初に処理したリクエストのレイテンシ（ナノ秒、0 なら未処理）
+// コールドスタート（初回のテンプレート解析・コネクション確立など）のコストを可視化する
+var firstRequestLatency atomic.Int64
+
+// observeFirstRequest は最初のリクエストのレイテンシのみを記録する（以降の呼び出しは無視）
+func observeFirstRequest(d time.Duration) {
+	// 0 は未記録を表すため、計測値が 0 の場合も記録済みとなるよう最小 1ns とする
+	if d <= 0 {
+		d = 1
+	}
+	firstRequestLatency.CompareAndSwap(0, int64(d))
+}
+
+// rateWindowSeconds はリクエストレートを算出するスライディングウィンドウの長さ（秒）
+const rateWindowSeconds = 60
+
+// rateWindow は1秒単位のバケットのリングで直近のリクエストレートを算出する
+// 累積の RequestCount では分からない現在の負荷を示す
+type rateWindow struct {
+	mu      sync.Mutex
+	buckets [rateWindowSeconds]struct {
+		sec   int64 // バケットが表す Unix 秒
+		count int64
+	}
+}
+
+// requestRate はアプリケーション全体で共有するリクエストレート
+var requestRate = &rateWindow{}
+
+// Observe は now の時点のリクエストを1件記録する
+func (rw *rateWindow) Observe(now time.Time) {
+	sec := now.Unix()
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	b := &rw.buckets[sec%rateWindowSeconds]
+	if b.sec != sec {
+		// 1周前の古いバケットを再利用する
+		b.sec, b.count = sec, 0
+	}
+	b.count++
+}
+
+// Rate は now までの直近 rateWindowSeconds 秒の平均リクエスト数（件/秒）を返す
+func (rw *rateWindow) Rate(now time.Time) float64 {
+	sec := now.Unix()
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	var total int64
+	for _, b := range rw.buckets {
+		if sec-b.sec < rateWindowSeconds && b.sec <= sec {
+			total += b.count
+		}
+	}
+	return float64(total) / rateWindowSeconds
+}
+
+// scrapeIntervalSmoothing はスクレイプ間隔の指数移動平均の平滑化係数
+const scrapeIntervalSmoothing = 0.3
+
+// scrapeTracker は /metrics へのリクエスト間隔を記録する
+// 設定ミスで過剰に（または複数のスクレイパーから）収集されていることを検知するため
+type scrapeTracker struct {
+	mu   sync.Mutex
+	last time.Time // 直前のスクレイプ時刻（ゼロ値なら未スクレイプ）
+	avg  float64   // スクレイプ間隔の指数移動平均（秒）
+}
+
+// metricsScrapes はアプリケーション全体で共有するスクレイプ間隔の記録
+var metricsScrapes = &scrapeTracker{}
+
+// Observe は now のスクレイプを記録し、直前からの間隔と移動平均（秒）を返す
+// 初回は比較対象がないため 0 を返す
+func (st *scrapeTracker) Observe(now time.Time) (last, avg float64) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if !st.last.IsZero() {
+		last = now.Sub(st.last).Seconds()
+		if st.avg == 0 {
+			st.avg = last
+		} else {
+			st.avg += scrapeIntervalSmoothing * (last - st.avg)
+		}
+	}
+	st.last = now
+	return last, st.avg
+}
+
+// responseSizeBuckets はレスポンスサイズのヒストグラムのバケット上限（バイト）
+var responseSizeBuckets = []int64{256, 1 << 10, 10 << 10, 100 << 10, 1 << 20}
+
+// HistogramBucket はヒストグラムの1バケット（上限以下の件数の累積値）
+type HistogramBucket struct {
+	UpperBound int64 `json:"le"`    // バケットの上限（この値以下を含む）
+	Count      int64 `json:"count"` // 上限以下の件数（累積）
+}
+
+// HistogramSnapshot はある時点のヒストグラムの集計値
+// Prometheus の histogram と同様にバケットは累積件数で、最大の上限を超えたものは Count にのみ含まれる
+type HistogramSnapshot struct {
+	Buckets []HistogramBucket `json:"buckets"`
+	Count   int64             `json:"count"` // 全件数（+Inf バケットに相当）
+	Sum     int64             `json:"sum"`   // 観測値の合計
+}
+
+// sizeHistogram は固定バケットのヒストグラム
+// ホットパスではバケットごとの件数を加算するだけにし、累積値はスナップショット時に算出する
+type sizeHistogram struct {
+	bounds []int64
+	counts []atomic.Int64 // bounds ごとの件数と、最後の要素は上限超過の件数
+	sum    atomic.Int64
+}
+
+// newSizeHistogram は bounds（昇順）をバケット上限とするヒストグラムを作成する
+func newSizeHistogram(bounds []int64) *sizeHistogram {
+	return &sizeHistogram{bounds: bounds, counts: make([]atomic.Int64, len(bounds)+1)}
+}
+
+// responseSizes はアプリケーション全体で共有するレスポンスサイズのヒストグラム
+var responseSizes = newSizeHistogram(responseSizeBuckets)
+
+// Observe は値 n を1件記録する
+func (h *sizeHistogram) Observe(n int64) {
+	i := sort.Search(len(h.bounds), func(i int) bool { return n <= h.bounds[i] })
+	h.counts[i].Add(1)
+	h.sum.Add(n)
+}
+
+// Snapshot は累積件数に変換した集計値を返す
+func (h *sizeHistogram) Snapshot() HistogramSnapshot {
+	snap := HistogramSnapshot{Buckets: make([]HistogramBucket, len(h.bounds))}
+	for i, le := range h.bounds {
+		snap.Count += h.counts[i].Load()
+		snap.Buckets[i] = HistogramBucket{UpperBound: le, Count: snap.Count}
+	}
+	snap.Count += h.counts[len(h.bounds)].Load()
+	snap.Sum = h.sum.Load()
+	return snap
+}
+
+// DurationHistogramBucket は処理時間のヒストグラムの1バケット（上限以下の件数の累積値）
+type DurationHistogramBucket struct {
+	UpperBound float64 `json:"le"`    // バケットの上限（秒、この値以下を含む）
+	Count      int64   `json:"count"` // 上限以下の件数（累積）
+}
+
+// DurationHistogramSnapshot はある時点の処理時間のヒストグラムの集計値（単位は秒）
+type DurationHistogramSnapshot struct {
+	Buckets []DurationHistogramBucket `json:"buckets"`
+	Count   int64                     `json:"count"` // 全件数（+Inf バケットに相当）
+	Sum     float64                   `json:"sum"`   // 観測値の合計（秒）
+}
+
+// durationHistogram は処理時間の固定バケットのヒストグラム
+// 合計をナノ秒で保持し、1ミリ秒未満の処理時間も 0 に丸めずに記録する
+type durationHistogram struct {
+	bounds []time.Duration
+	counts []atomic.Int64 // bounds ごとの件数と、最後の要素は上限超過の件数
+	sum    atomic.Int64   // 観測値の合計（ナノ秒）
+}
+
+// newDurationHistogram は bounds（昇順）をバケット上限とするヒストグラムを作成する
+func newDurationHistogram(bounds []time.Duration) *durationHistogram {
+	return &durationHistogram{bounds: bounds, counts: make([]atomic.Int64, len(bounds)+1)}
+}
+
+// Observe は処理時間 d を1件記録する
+func (h *durationHistogram) Observe(d time.Duration) {
+	i := sort.Search(len(h.bounds), func(i int) bool { return d <= h.bounds[i] })
+	h.counts[i].Add(1)
+	h.sum.Add(int64(d))
+}
+
+// Snapshot は累積件数に変換した集計値を秒単位で返す
+func (h *durationHistogram) Snapshot() DurationHistogramSnapshot {
+	snap := DurationHistogramSnapshot{Buckets: make([]DurationHistogramBucket, len(h.bounds))}
+	for i, le := range h.bounds {
+		snap.Count += h.counts[i].Load()
+		snap.Buckets[i] = DurationHistogramBucket{UpperBound: le.Seconds(), Count: snap.Count}
+	}
+	snap.Count += h.counts[len(h.bounds)].Load()
+	snap.Sum = time.Duration(h.sum.Load()).Seconds()
+	return snap
+}
+
+// latencyBuckets はリクエスト処理時間のヒストグラムのバケット上限（Prometheus クライアントの既定値と同じ）
+var latencyBuckets = []time.Duration{
+	5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second,
+}
+
+// リクエストの結果ごとの処理時間のヒストグラム
+// エラーがすぐに失敗しているのか（fail fast）、タイムアウトまで待って失敗しているのかを区別するため分ける
+var (
+	latencySuccess = newDurationHistogram(latencyBuckets) // 2xx・3xx
+	latencyError   = newDurationHistogram(latencyBuckets) // 4xx・5xx
+)
+
+// observeLatencyByOutcome はステータスコードに応じた結果のヒストグラムへ処理時間を記録する
+func observeLatencyByOutcome(status int, d time.Duration) {
+	if status >= 400 {
+		latencyError.Observe(d)
+		return
+	}
+	latencySuccess.Observe(d)
+}
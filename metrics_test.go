@@ -0,0 +1,592 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestCollectorConcurrentAccuracy は並行負荷下でのリクエスト集計精度のテスト
+// バックグラウンド統合と並行して記録しても件数が失われないことを保証
+func TestCollectorConcurrentAccuracy(t *testing.T) {
+	c := &metricsCollector{}
+	before := c.Snapshot().RequestCount
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := c.startFlusher(ctx, time.Millisecond)
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	const workers, perWorker = 16, 5000
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perWorker; j++ {
+				c.RecordRequest()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := c.Snapshot().RequestCount - before; got != workers*perWorker {
+		t.Errorf("Request count mismatch after concurrent load: got %d want %d",
+			got, workers*perWorker)
+	}
+}
+
+// mutexCounter は比較用の素朴なミューテックス保護カウンター
+type mutexCounter struct {
+	mu sync.Mutex
+	n  int64
+}
+
+func (m *mutexCounter) RecordRequest() {
+	m.mu.Lock()
+	m.n++
+	m.mu.Unlock()
+}
+
+// BenchmarkRecordRequestSharded はシャード化カウンターの並行記録性能測定
+func BenchmarkRecordRequestSharded(b *testing.B) {
+	c := &metricsCollector{}
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			c.RecordRequest()
+		}
+	})
+}
+
+// BenchmarkRecordRequestMutex はミューテックス版カウンターの並行記録性能測定（比較用）
+func BenchmarkRecordRequestMutex(b *testing.B) {
+	c := &mutexCounter{}
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			c.RecordRequest()
+		}
+	})
+}
+
+// TestMemStatsCacheRateLimit はメモリ統計読み取りのレート制限テスト
+// 高頻度スクレイプでも間隔内は ReadMemStats を1回しか呼ばないことを保証
+func TestMemStatsCacheRateLimit(t *testing.T) {
+	withConfig(t, func(c *Config) { c.MemStatsInterval = 5 * time.Second })
+
+	var reads int
+	now := time.Unix(1700000000, 0)
+	c := &memStatsCache{
+		read: func(m *runtime.MemStats) {
+			reads++
+			m.HeapAlloc = uint64(reads) << 20
+		},
+		now: func() time.Time { return now },
+	}
+
+	// 間隔内の連続スクレイプ
+	for i := 0; i < 10; i++ {
+		if got := c.Get().HeapAlloc; got != 1<<20 {
+			t.Fatalf("Expected cached value, got %d", got)
+		}
+		now = now.Add(100 * time.Millisecond)
+	}
+	if reads != 1 {
+		t.Errorf("ReadMemStats should be called once within interval, got %d", reads)
+	}
+
+	// 間隔経過後は再読み取りされる
+	now = now.Add(5 * time.Second)
+	c.Get()
+	if reads != 2 {
+		t.Errorf("ReadMemStats should be called again after interval, got %d", reads)
+	}
+
+	// invalidate 後は間隔内でも再読み取りされる
+	c.invalidate()
+	c.Get()
+	if reads != 3 {
+		t.Errorf("ReadMemStats should be called after invalidate, got %d", reads)
+	}
+}
+
+// TestLatencyWindowP95 はスライディングウィンドウ p95 のテスト
+// 低速リクエストの集中に対して、累積平均と異なり p95 が即座に反応することを保証
+func TestLatencyWindowP95(t *testing.T) {
+	var lw latencyWindow
+
+	if p := lw.Percentile(0.95); p != 0 {
+		t.Errorf("Empty window should report 0, got %v", p)
+	}
+
+	// 定常状態：すべて高速なリクエスト
+	for i := 0; i < latencyWindowSize; i++ {
+		lw.Observe(time.Millisecond)
+	}
+	if p := lw.Percentile(0.95); p != time.Millisecond {
+		t.Errorf("Steady-state p95 should be 1ms, got %v", p)
+	}
+
+	// 直近の10%が低速になると p95 は低速側の値を示す
+	for i := 0; i < latencyWindowSize/10; i++ {
+		lw.Observe(500 * time.Millisecond)
+	}
+	if p := lw.Percentile(0.95); p != 500*time.Millisecond {
+		t.Errorf("p95 should react to slow burst, got %v", p)
+	}
+
+	// 高速なリクエストで低速分が押し出されると p95 は元に戻る
+	for i := 0; i < latencyWindowSize; i++ {
+		lw.Observe(time.Millisecond)
+	}
+	if p := lw.Percentile(0.95); p != time.Millisecond {
+		t.Errorf("p95 should recover once slow samples leave the window, got %v", p)
+	}
+}
+
+// TestMetricsPartialSuccess はサンプラー失敗時の部分的成功のテスト
+// 一部のサンプラーが失敗しても 200 で取得できた値を返し、失敗内容を errors に含めることを保証
+func TestMetricsPartialSuccess(t *testing.T) {
+	orig := metricsSamplers
+	metricsSamplers = []metricsSampler{
+		{name: "memory", sample: sampleMemory},
+		{name: "proc_stat", sample: func(m *MetricsResponse) error {
+			return errors.New("open /proc/self/stat: permission denied")
+		}},
+	}
+	t.Cleanup(func() { metricsSamplers = orig })
+
+	rr := httptest.NewRecorder()
+	metricsHandler(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200 on partial failure, got %d", rr.Code)
+	}
+
+	var m MetricsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &m); err != nil {
+		t.Fatalf("Could not unmarshal response: %v", err)
+	}
+	if m.MemoryUsageMB <= 0 || m.RequestCount <= 0 {
+		t.Errorf("Successful samples should still be reported: %+v", m)
+	}
+	if len(m.Errors) != 1 || !strings.HasPrefix(m.Errors[0], "proc_stat: ") {
+		t.Errorf("Expected one proc_stat error, got %v", m.Errors)
+	}
+}
+
+// TestMetricsSamplerPanic はサンプラーの panic 時のテスト
+// panic したサンプラーを飛ばして他のメトリクスを返し、collection_errors に計上することを保証
+func TestMetricsSamplerPanic(t *testing.T) {
+	orig := metricsSamplers
+	metricsSamplers = []metricsSampler{
+		{name: "custom_gauge", sample: func(m *MetricsResponse) error { panic("nil map") }},
+		{name: "memory", sample: sampleMemory},
+	}
+	t.Cleanup(func() { metricsSamplers = orig })
+
+	rr := httptest.NewRecorder()
+	metricsHandler(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200 when a sampler panics, got %d", rr.Code)
+	}
+	var m MetricsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &m); err != nil {
+		t.Fatalf("Could not unmarshal response: %v", err)
+	}
+	if m.MemoryUsageMB <= 0 {
+		t.Errorf("Samplers after the panicking one should still run: %+v", m)
+	}
+	if m.CollectionErrors != 1 || len(m.Errors) != 1 || m.Errors[0] != "custom_gauge: panic: nil map" {
+		t.Errorf("Expected one collection error, got %d %v", m.CollectionErrors, m.Errors)
+	}
+
+	req := httptest.NewRequest("GET", "/metrics?format=prometheus", nil)
+	rr = httptest.NewRecorder()
+	metricsHandler(rr, req)
+	if !strings.Contains(rr.Body.String(), "sreworkflow_metrics_collection_errors 1\n") {
+		t.Errorf("Expected collection error gauge in Prometheus output:\n%s", rr.Body.String())
+	}
+}
+
+// TestMetricsUnavailableFieldOmitted はプラットフォーム非対応の値の省略テスト
+// 取得できない値はゼロではなくキーごと省略され、エラーにもならないことを保証
+func TestMetricsUnavailableFieldOmitted(t *testing.T) {
+	scrape := func() map[string]any {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		metricsHandler(rr, httptest.NewRequest("GET", "/metrics", nil))
+		var m map[string]any
+		if err := json.Unmarshal(rr.Body.Bytes(), &m); err != nil {
+			t.Fatalf("Could not unmarshal response: %v", err)
+		}
+		return m
+	}
+
+	// /proc のないプラットフォームを再現
+	orig := procSelfFD
+	procSelfFD = filepath.Join(t.TempDir(), "no-proc")
+	t.Cleanup(func() { procSelfFD = orig })
+
+	m := scrape()
+	if _, ok := m["open_fds"]; ok {
+		t.Errorf("open_fds should be omitted when unavailable, got %v", m["open_fds"])
+	}
+	if _, ok := m["errors"]; ok {
+		t.Errorf("Unavailable field should not be reported as error: %v", m["errors"])
+	}
+
+	// 取得できる場合は値が出力される（ゼロとの区別）
+	procSelfFD = t.TempDir()
+	if v, ok := scrape()["open_fds"]; !ok || v != float64(0) {
+		t.Errorf("Expected open_fds to be present as 0, got %v (present %v)", v, ok)
+	}
+}
+
+// TestOldestInflightAge は最も古い処理中リクエストの経過時間のテスト
+// 滞留しているリクエストの経過時間が、完了前からメトリクスで増加していくことを保証
+func TestOldestInflightAge(t *testing.T) {
+	captureLogs(t)
+	scrape := func() float64 {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		metricsHandler(rr, httptest.NewRequest("GET", "/metrics", nil))
+		var m MetricsResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &m); err != nil {
+			t.Fatalf("Could not unmarshal response: %v", err)
+		}
+		return m.OldestInflightAgeSeconds
+	}
+
+	if age := scrape(); age != 0 {
+		t.Fatalf("Expected 0 with no in-flight requests, got %v", age)
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan struct{})
+	stuck := logMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+	go func() {
+		defer close(done)
+		stuck(httptest.NewRecorder(), httptest.NewRequest("GET", "/stuck", nil))
+	}()
+	<-started
+
+	first := scrape()
+	time.Sleep(20 * time.Millisecond)
+	second := scrape()
+	if first <= 0 || second < first+0.02 {
+		t.Errorf("Age should grow while request is held: first %v, second %v", first, second)
+	}
+
+	close(release)
+	<-done
+	if age := scrape(); age != 0 {
+		t.Errorf("Expected 0 after request completes, got %v", age)
+	}
+}
+
+// TestRateWindow はスライディングウィンドウのリクエストレートのテスト
+// ウィンドウ内の件数から RPS を算出し、ウィンドウ外の古いリクエストは除外されることを保証
+func TestRateWindow(t *testing.T) {
+	var rw rateWindow
+	now := time.Unix(1700000000, 0)
+
+	if r := rw.Rate(now); r != 0 {
+		t.Errorf("Empty window should report 0, got %v", r)
+	}
+
+	// 30秒間に毎秒4件（計120件）→ 60秒ウィンドウで 2 件/秒
+	for i := 0; i < 30; i++ {
+		for j := 0; j < 4; j++ {
+			rw.Observe(now.Add(time.Duration(i)*time.Second + time.Duration(j)*100*time.Millisecond))
+		}
+	}
+	now = now.Add(29 * time.Second)
+	if r := rw.Rate(now); r < 1.9 || r > 2.1 {
+		t.Errorf("Expected ~2 rps, got %v", r)
+	}
+
+	// 45秒後：最初の15秒分（60件）がウィンドウから外れる → 1 件/秒
+	now = now.Add(45 * time.Second)
+	if r := rw.Rate(now); r < 0.9 || r > 1.1 {
+		t.Errorf("Expected ~1 rps after old buckets leave window, got %v", r)
+	}
+
+	// 十分に時間が経てば 0 に戻る
+	now = now.Add(2 * time.Minute)
+	if r := rw.Rate(now); r != 0 {
+		t.Errorf("Expected 0 after window passes, got %v", r)
+	}
+}
+
+// TestScrapeInterval は /metrics のスクレイプ間隔の計測テスト
+// 連続した2回のスクレイプの間隔が報告され、移動平均が間隔の変化に追従することを保証
+func TestScrapeInterval(t *testing.T) {
+	orig := metricsScrapes
+	metricsScrapes = &scrapeTracker{}
+	t.Cleanup(func() { metricsScrapes = orig })
+
+	scrape := func() MetricsResponse {
+		rr := httptest.NewRecorder()
+		metricsHandler(rr, httptest.NewRequest("GET", "/metrics", nil))
+		var m MetricsResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &m); err != nil {
+			t.Fatalf("Could not unmarshal response: %v", err)
+		}
+		return m
+	}
+
+	if m := scrape(); m.LastScrapeIntervalSeconds != 0 {
+		t.Errorf("Expected 0 interval on first scrape, got %v", m.LastScrapeIntervalSeconds)
+	}
+	gap := 50 * time.Millisecond
+	time.Sleep(gap)
+	m := scrape()
+	if m.LastScrapeIntervalSeconds < gap.Seconds() || m.LastScrapeIntervalSeconds > gap.Seconds()+0.5 {
+		t.Errorf("Expected interval close to %v, got %vs", gap, m.LastScrapeIntervalSeconds)
+	}
+	if m.AvgScrapeIntervalSeconds != m.LastScrapeIntervalSeconds {
+		t.Errorf("Expected average to equal the first interval, got %v", m.AvgScrapeIntervalSeconds)
+	}
+
+	// 移動平均は直近の間隔に向かって平滑化される
+	st := &scrapeTracker{}
+	base := time.Unix(1700000000, 0)
+	st.Observe(base)
+	st.Observe(base.Add(15 * time.Second))
+	last, avg := st.Observe(base.Add(16 * time.Second))
+	if last != 1 {
+		t.Errorf("Expected last interval 1s, got %v", last)
+	}
+	if want := 15 + scrapeIntervalSmoothing*(1-15); avg != want {
+		t.Errorf("Expected average %v, got %v", want, avg)
+	}
+}
+
+// TestResponseSizeHistogram はレスポンスサイズのヒストグラムのテスト
+// 既知のサイズのレスポンスが正しいバケットに入り、JSON と Prometheus 形式の両方に出力されることを保証
+func TestResponseSizeHistogram(t *testing.T) {
+	captureLogs(t)
+	orig := responseSizes
+	responseSizes = newSizeHistogram(responseSizeBuckets)
+	t.Cleanup(func() { responseSizes = orig })
+
+	for _, size := range []int{0, 256, 257, 5000, 2 << 20} {
+		body := strings.Repeat("x", size)
+		logMiddleware(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(body))
+		})(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}
+
+	snap := responseSizes.Snapshot()
+	want := []int64{2, 3, 4, 4, 4} // 累積: ≤256B, ≤1KB, ≤10KB, ≤100KB, ≤1MB
+	for i, b := range snap.Buckets {
+		if b.UpperBound != responseSizeBuckets[i] || b.Count != want[i] {
+			t.Errorf("Bucket le=%d: got %d want %d", b.UpperBound, b.Count, want[i])
+		}
+	}
+	if snap.Count != 5 || snap.Sum != 256+257+5000+2<<20 {
+		t.Errorf("Unexpected count/sum: %d/%d", snap.Count, snap.Sum)
+	}
+
+	rr := httptest.NewRecorder()
+	metricsHandler(rr, httptest.NewRequest("GET", "/metrics", nil))
+	var m MetricsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &m); err != nil {
+		t.Fatalf("Could not unmarshal response: %v", err)
+	}
+	if len(m.ResponseSizeBytes.Buckets) != len(responseSizeBuckets) || m.ResponseSizeBytes.Buckets[0].Count != 2 {
+		t.Errorf("Unexpected JSON histogram: %+v", m.ResponseSizeBytes)
+	}
+
+	req := httptest.NewRequest("GET", "/metrics?format=prometheus", nil)
+	rr = httptest.NewRecorder()
+	metricsHandler(rr, req)
+	body := rr.Body.String()
+	for _, line := range []string{
+		"# TYPE sreworkflow_http_response_size_bytes histogram\n",
+		"sreworkflow_http_response_size_bytes_bucket{le=\"256\"} 2\n",
+		"sreworkflow_http_response_size_bytes_bucket{le=\"1048576\"} 4\n",
+		"sreworkflow_http_response_size_bytes_bucket{le=\"+Inf\"} 5\n",
+		"sreworkflow_http_response_size_bytes_count 5\n",
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("Expected %q in Prometheus output:\n%s", line, body)
+		}
+	}
+}
+
+// TestLatencyByOutcome は結果ごとのリクエスト処理時間のヒストグラムのテスト
+// 500 はエラー、200 は成功の系列に記録され、Prometheus 形式でも秒単位の outcome ラベル付きで出力されることを保証
+func TestLatencyByOutcome(t *testing.T) {
+	captureLogs(t)
+	origSuccess, origError := latencySuccess, latencyError
+	latencySuccess, latencyError = newDurationHistogram(latencyBuckets), newDurationHistogram(latencyBuckets)
+	t.Cleanup(func() { latencySuccess, latencyError = origSuccess, origError })
+
+	logMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	logMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	// 処理時間は環境に依存するため、どの系列に記録されたかのみ確認する
+	if n := latencyError.Snapshot().Count; n != 1 {
+		t.Errorf("Expected the 500 in the error series, got %d", n)
+	}
+	if n := latencySuccess.Snapshot().Count; n != 1 {
+		t.Errorf("Expected the 200 in the success series, got %d", n)
+	}
+
+	rr := httptest.NewRecorder()
+	metricsHandler(rr, httptest.NewRequest("GET", "/metrics?format=prometheus", nil))
+	body := rr.Body.String()
+	for _, line := range []string{
+		"sreworkflow_http_request_duration_seconds_bucket{le=\"0.005\",outcome=\"success\"} ",
+		"sreworkflow_http_request_duration_seconds_count{outcome=\"success\"} 1\n",
+		"sreworkflow_http_request_duration_seconds_count{outcome=\"error\"} 1\n",
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("Expected %q in Prometheus output:\n%s", line, body)
+		}
+	}
+	// 同じファミリーの HELP・TYPE は1度だけ出力する
+	if n := strings.Count(body, "# TYPE sreworkflow_http_request_duration_seconds histogram\n"); n != 1 {
+		t.Errorf("Expected a single TYPE line for the latency family, got %d", n)
+	}
+}
+
+// TestDurationHistogram は処理時間のヒストグラムのテスト
+// 1ミリ秒未満の処理時間も 0 に丸めずに記録し、秒単位のバケット・合計を返すことを保証
+func TestDurationHistogram(t *testing.T) {
+	h := newDurationHistogram(latencyBuckets)
+	for _, d := range []time.Duration{500 * time.Microsecond, 60 * time.Millisecond, 20 * time.Second} {
+		h.Observe(d)
+	}
+
+	snap := h.Snapshot()
+	if snap.Buckets[0].UpperBound != 0.005 || snap.Buckets[0].Count != 1 {
+		t.Errorf("Expected the sub-millisecond request in le=0.005, got %+v", snap.Buckets[0])
+	}
+	if snap.Buckets[3].Count != 1 || snap.Buckets[4].UpperBound != 0.1 || snap.Buckets[4].Count != 2 {
+		t.Errorf("Expected 60ms between le=0.05 and le=0.1, got %+v", snap.Buckets)
+	}
+	if snap.Count != 3 || math.Abs(snap.Sum-20.0605) > 1e-9 {
+		t.Errorf("Unexpected count/sum: %d/%v", snap.Count, snap.Sum)
+	}
+}
+
+// TestFirstRequestLatency はコールドスタート計測用の初回リクエストレイテンシのテスト
+// 最初のリクエストのレイテンシが記録され、以降のリクエストで上書きされないことを保証
+func TestFirstRequestLatency(t *testing.T) {
+	captureLogs(t)
+	orig := firstRequestLatency.Load()
+	firstRequestLatency.Store(0)
+	t.Cleanup(func() { firstRequestLatency.Store(orig) })
+
+	logMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+	})(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	logMiddleware(func(w http.ResponseWriter, r *http.Request) {})(
+		httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	rr := httptest.NewRecorder()
+	metricsHandler(rr, httptest.NewRequest("GET", "/metrics", nil))
+	var m MetricsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &m); err != nil {
+		t.Fatalf("Could not unmarshal response: %v", err)
+	}
+	if m.FirstRequestLatencyMs < 20 || m.FirstRequestLatencyMs > 1000 {
+		t.Errorf("Expected first request latency of ~20ms to be kept, got %vms", m.FirstRequestLatencyMs)
+	}
+}
+
+// TestGCFraction は GC 時間の割合のテスト
+// gc_fraction が常に出力され、0〜1 の範囲に収まることを保証
+func TestGCFraction(t *testing.T) {
+	runtime.GC()
+	memStats.invalidate()
+
+	rr := httptest.NewRecorder()
+	metricsHandler(rr, httptest.NewRequest("GET", "/metrics", nil))
+	var m map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &m); err != nil {
+		t.Fatalf("Could not unmarshal response: %v", err)
+	}
+	v, ok := m["gc_fraction"].(float64)
+	if !ok {
+		t.Fatalf("Expected gc_fraction to be present, got %v", m["gc_fraction"])
+	}
+	if v < 0 || v > 1 {
+		t.Errorf("Expected gc_fraction between 0 and 1, got %v", v)
+	}
+
+	if f := gcFraction(uint64(2*time.Second), time.Second); f != 1 {
+		t.Errorf("Expected fraction to be capped at 1, got %v", f)
+	}
+	if f := gcFraction(uint64(250*time.Millisecond), time.Second); f != 0.25 {
+		t.Errorf("Expected 0.25, got %v", f)
+	}
+}
+
+// TestDistinctClientIPs はクライアント IP の異なり数のテスト
+// 信頼できるプロキシ経由では X-Forwarded-For のクライアントで数え、上限で頭打ちになることを保証
+func TestDistinctClientIPs(t *testing.T) {
+	captureLogs(t)
+	orig := distinctClientIPs
+	distinctClientIPs = newDistinctSet(distinctClientIPsMax)
+	t.Cleanup(func() { distinctClientIPs = orig })
+	withConfig(t, func(c *Config) {
+		_, proxy, _ := net.ParseCIDR("10.0.0.0/8")
+		c.TrustedProxies = []*net.IPNet{proxy}
+	})
+
+	handler := logMiddleware(func(w http.ResponseWriter, r *http.Request) {})
+	send := func(remote, xff string) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = remote
+		if xff != "" {
+			req.Header.Set("X-Forwarded-For", xff)
+		}
+		handler(httptest.NewRecorder(), req)
+	}
+	send("192.0.2.1:1234", "")
+	send("192.0.2.1:5678", "")            // 同じクライアント（ポート違い）
+	send("192.0.2.2:1234", "203.0.113.9") // 信頼できない接続元のヘッダーは無視
+	send("10.0.0.1:1234", "198.51.100.1") // プロキシ経由のクライアント
+	send("10.0.0.2:1234", "198.51.100.1") // 別のプロキシ経由の同じクライアント
+	send("10.0.0.1:1234", "198.51.100.2")
+
+	rr := httptest.NewRecorder()
+	metricsHandler(rr, httptest.NewRequest("GET", "/metrics", nil))
+	var m MetricsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &m); err != nil {
+		t.Fatalf("Could not unmarshal response: %v", err)
+	}
+	if m.DistinctClientIPs != 4 {
+		t.Errorf("Expected 4 distinct client IPs, got %d", m.DistinctClientIPs)
+	}
+
+	s := newDistinctSet(2)
+	for _, ip := range []string{"a", "b", "c", "a"} {
+		s.Add(ip)
+	}
+	if s.Len() != 2 {
+		t.Errorf("Expected count capped at 2, got %d", s.Len())
+	}
+}
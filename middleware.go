@@ -0,0 +1,242 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// adminOnly は管理用エンドポイントを保護するミドルウェア
+// ADMIN_TOKEN 未設定時はエンドポイント自体を存在しないものとして扱い、
+// 設定時は Authorization: Bearer <token> が一致するリクエストのみ通過させる
+func adminOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := cfg().AdminToken
+		if token == "" {
+			writeNotFound(w, r)
+			return
+		}
+
+		// Bearer スキームでない Authorization（トークンそのものなど）は比較せずに拒否する
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			writeError(w, r, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		// タイミング攻撃を避けるため定数時間で比較
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			writeError(w, r, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// chaosOnly は障害注入系エンドポイントを保護するミドルウェア
+// ENABLE_CHAOS が有効な環境（検証・訓練用）以外では 404 を返す
+func chaosOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !cfg().EnableChaos {
+			writeNotFound(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// timeoutMiddleware はハンドラーの処理時間を制限するミドルウェア
+// 制限を超えた場合は 503 を返し、遅いハンドラーがコネクションを占有し続けることを防ぐ
+// timeout が 0 以下の場合は制限しない
+func timeoutMiddleware(timeout time.Duration, next http.HandlerFunc) http.HandlerFunc {
+	if timeout <= 0 {
+		return next
+	}
+	return http.TimeoutHandler(next, timeout, "Service Unavailable: handler timeout").ServeHTTP
+}
+
+// Expect: 100-continue の扱い方針
+const (
+	expectPolicyReject = "reject" // 上限超過の Content-Length は本文送信前に 417 で拒否する
+	expectPolicyAccept = "accept" // 常に本文を受け付け、読み取り時の上限超過で 413 を返す
+)
+
+// bodyLimitMiddleware はリクエスト本文のサイズを MAX_BODY_BYTES に制限するミドルウェア
+// Expect: 100-continue 付きで上限超過が申告された場合は、本文が送信される前に拒否して帯域を節約する
+// （Go の HTTP サーバーはハンドラーが本文を読むまで 100 Continue を送信しない）
+func bodyLimitMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c := cfg()
+		if c.MaxBodyBytes <= 0 {
+			next(w, r)
+			return
+		}
+
+		if r.ContentLength > c.MaxBodyBytes {
+			expects := strings.EqualFold(r.Header.Get("Expect"), "100-continue")
+			if expects && c.ExpectContinuePolicy == expectPolicyReject {
+				writeError(w, r, "Expectation Failed: request body too large", http.StatusExpectationFailed)
+				return
+			}
+			if !expects {
+				writeError(w, r, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+				return
+			}
+		}
+
+		// Content-Length 未指定（chunked）や accept 方針の場合も読み取り量を制限する
+		r.Body = http.MaxBytesReader(w, r.Body, c.MaxBodyBytes)
+		next(w, r)
+	}
+}
+
+// allowedHostsMiddleware は Host ヘッダーを ALLOWED_HOSTS で制限するミドルウェア
+// Host ヘッダー攻撃・DNS リバインディング対策として、許可リスト外のホストには 400 を返す
+// ALLOWED_HOSTS 未設定時はすべて許可する
+func allowedHostsMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		allowed := cfg().AllowedHosts
+		if len(allowed) > 0 && !hostAllowed(r.Host, allowed) {
+			writeError(w, r, "Invalid Host header", http.StatusBadRequest)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// hostAllowed は Host ヘッダー（ポート番号を除く）が許可リストに一致するかを判定する
+// "*.example.com" はサブドメインに一致し、"example.com" 自体には一致しない
+func hostAllowed(host string, allowed []string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "" {
+		return false
+	}
+
+	for _, pattern := range allowed {
+		if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+			if strings.HasSuffix(host, suffix) && len(host) > len(suffix) {
+				return true
+			}
+			continue
+		}
+		if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// sizeCountingResponseWriter はレスポンス本文の書き込みバイト数とステータスコードを記録する ResponseWriter
+type sizeCountingResponseWriter struct {
+	http.ResponseWriter
+	bytes  int64
+	status int // 最終的なステータスコード（書き込み前は 0）
+}
+
+func (w *sizeCountingResponseWriter) WriteHeader(code int) {
+	// 1xx（100 Continue など）は中間応答のため最終的なステータスとして扱わない
+	if w.status == 0 && code >= 200 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *sizeCountingResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap は http.ResponseController が元の ResponseWriter の機能を使えるようにする
+func (w *sizeCountingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Status は最終的なステータスコードを返す（何も書き込まれなかった場合は net/http と同じく 200）
+func (w *sizeCountingResponseWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// eventHTTPPanic はハンドラーの panic を記録するログのイベント名
+const eventHTTPPanic = "http.panic"
+
+// panicCount はハンドラーで発生した panic の総数（ログを検索せずにアラートできるよう公開する）
+var panicCount atomic.Int64
+
+// recoveryMiddleware はハンドラーの panic を回復して 500 を返すミドルウェア
+// panic はスタックトレース付きでログ出力し、panicCount に計上する
+// http.ErrAbortHandler は意図的な中断のため、そのまま net/http に処理させる
+func recoveryMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			panicCount.Add(1)
+			logger.Error(eventHTTPPanic,
+				"method", r.Method,
+				"uri", r.RequestURI,
+				"request_id", requestIDFromContext(r.Context()),
+				"panic", fmt.Sprint(v),
+				"stack", string(debug.Stack()))
+			writeError(w, r, "Internal Server Error", http.StatusInternalServerError)
+		}()
+		next(w, r)
+	}
+}
+
+// strictAcceptMiddleware は STRICT_ACCEPT 有効時、Accept ヘッダーが produces のいずれとも一致しないリクエストを 406 で拒否する
+// 無効時（既定）は従来どおり Accept を無視してルートの既定形式で応答する
+func strictAcceptMiddleware(produces []string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if cfg().StrictAccept && len(produces) > 0 && negotiateContentType(r.Header.Get("Accept"), produces...) == "" {
+			writeError(w, r, "Not Acceptable: supported types are "+strings.Join(produces, ", "), http.StatusNotAcceptable)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// strictQueryMiddleware は STRICT_QUERY 有効時、known 以外のクエリパラメーターを含むリクエストを 400 で拒否する
+// "?verbos=true" のような綴り間違いが黙って無視されることを防ぐ
+func strictQueryMiddleware(known []string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if cfg().StrictQuery {
+			for name := range r.URL.Query() {
+				if !containsString(known, name) {
+					writeError(w, r, fmt.Sprintf("Bad Request: unknown query parameter %q", name), http.StatusBadRequest)
+					return
+				}
+			}
+		}
+		next(w, r)
+	}
+}
+
+// containsString は list に s が含まれるかを判定する
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestExpectContinueRejectsOversized は Expect: 100-continue の上限超過拒否テスト
+// 上限を超える本文は送信される前（100 Continue を返さずに）417 で拒否されることを保証
+func TestExpectContinueRejectsOversized(t *testing.T) {
+	withConfig(t, func(c *Config) { c.MaxBodyBytes = 1024 })
+	srv := httptest.NewServer(newRouter())
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Could not connect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// ヘッダーのみ送信し、本文は送らずに応答を待つ
+	fmt.Fprintf(conn, "POST /health HTTP/1.1\r\nHost: example.com\r\n"+
+		"Content-Length: 10485760\r\nExpect: 100-continue\r\n\r\n")
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("Could not read response: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusExpectationFailed {
+		t.Errorf("Expected 417 before body transmission, got %d", resp.StatusCode)
+	}
+}
+
+// TestBodyLimitWithoutExpect は Expect なしの上限超過リクエストのテスト
+func TestBodyLimitWithoutExpect(t *testing.T) {
+	withConfig(t, func(c *Config) { c.MaxBodyBytes = 16 })
+
+	called := false
+	h := bodyLimitMiddleware(func(w http.ResponseWriter, r *http.Request) { called = true })
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(strings.Repeat("x", 64)))
+	rr := httptest.NewRecorder()
+	h(rr, req)
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413, got %d", rr.Code)
+	}
+	if called {
+		t.Error("Handler should not be called for oversized body")
+	}
+}
+
+// TestExpectContinueAcceptPolicy は accept 方針では本文読み取り時に上限が適用されることのテスト
+func TestExpectContinueAcceptPolicy(t *testing.T) {
+	withConfig(t, func(c *Config) {
+		c.MaxBodyBytes = 16
+		c.ExpectContinuePolicy = expectPolicyAccept
+	})
+
+	var readErr error
+	h := bodyLimitMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		buf := make([]byte, 128)
+		for readErr == nil {
+			_, readErr = r.Body.Read(buf)
+		}
+	})
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(strings.Repeat("x", 64)))
+	req.Header.Set("Expect", "100-continue")
+	h(httptest.NewRecorder(), req)
+
+	if readErr == nil || !strings.Contains(readErr.Error(), "too large") {
+		t.Errorf("Expected body read to fail with size limit, got %v", readErr)
+	}
+}
+
+// TestAllowedHosts は Host ヘッダー許可リストのテスト
+// 許可されたホスト・ワイルドカードに一致するサブドメインのみ通過し、それ以外は 400 になることを保証
+func TestAllowedHosts(t *testing.T) {
+	t.Setenv("ALLOWED_HOSTS", "api.example.com, *.Internal.example.com")
+	setConfig(mustLoadConfig(t))
+	t.Cleanup(func() { setConfig(defaultConfig()) })
+
+	handler := allowedHostsMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		host string
+		want int
+	}{
+		{"api.example.com", http.StatusOK},
+		{"API.example.com:8080", http.StatusOK},
+		{"svc.internal.example.com", http.StatusOK},     // ワイルドカードに一致
+		{"a.b.internal.example.com", http.StatusOK},     // 多段のサブドメインも一致
+		{"internal.example.com", http.StatusBadRequest}, // ワイルドカードは親ドメイン自体に一致しない
+		{"evil.com", http.StatusBadRequest},
+		{"evilinternal.example.com", http.StatusBadRequest},
+		{"127.0.0.1:8080", http.StatusBadRequest}, // DNS リバインディング
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Host = tt.host
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		if rr.Code != tt.want {
+			t.Errorf("Host %q: got %d want %d", tt.host, rr.Code, tt.want)
+		}
+	}
+
+	// 未設定時はすべて許可
+	setConfig(defaultConfig())
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Host = "anything.test"
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("All hosts should be allowed without ALLOWED_HOSTS, got %d", rr.Code)
+	}
+}
+
+// TestAllowedHostsSkipsProbes はプローブ用エンドポイントに Host ヘッダーの検証を適用しないことのテスト
+// kubelet が Pod IP を Host に指定しても 200 となり、通常のエンドポイントは引き続き 400 になることを保証
+func TestAllowedHostsSkipsProbes(t *testing.T) {
+	withConfig(t, func(c *Config) { c.AllowedHosts = []string{"api.example.com"} })
+	router := newRouter()
+
+	for _, tt := range []struct {
+		path string
+		want int
+	}{
+		{"/health", http.StatusOK},
+		{"/healthz", http.StatusOK},
+		{"/", http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		req.Host = "10.0.0.12:8080"
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != tt.want {
+			t.Errorf("%s with IP Host: got %d want %d", tt.path, rr.Code, tt.want)
+		}
+	}
+}
+
+// TestRecoveryPanicCount は panic 回復時のメトリクス計上のテスト
+// ハンドラーの panic（タイムアウト用の別ゴルーチン内を含む）が 500 となり、panic_count・panics_recovered が増えることを保証
+func TestRecoveryPanicCount(t *testing.T) {
+	logs := captureLogs(t)
+	before := panicCount.Load()
+
+	handler := route{pattern: "/boom", handler: func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}}.build()
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest("GET", "/boom", nil))
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("Expected 500, got %d", rr.Code)
+	}
+	if got := panicCount.Load() - before; got != 1 {
+		t.Errorf("Expected panic counter to increment by 1, got %d", got)
+	}
+
+	rr = httptest.NewRecorder()
+	metricsHandler(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(rr.Body.String(), fmt.Sprintf(`"panic_count":%d`, before+1)) {
+		t.Errorf("Expected panic_count in metrics: %s", rr.Body.String())
+	}
+	if !strings.Contains(rr.Body.String(), fmt.Sprintf(`"panics_recovered":%d`, before+1)) {
+		t.Errorf("Expected panics_recovered in metrics: %s", rr.Body.String())
+	}
+
+	var logged bool
+	for _, e := range logs.entries(t) {
+		if e["msg"] == eventHTTPPanic && e["panic"] == "boom" && e["stack"] != "" {
+			logged = true
+		}
+	}
+	if !logged {
+		t.Error("Expected http.panic log entry with stack trace")
+	}
+}
+
+// TestStrictQuery は未知のクエリパラメーターの拒否テスト
+// STRICT_QUERY 有効時は綴り間違いのパラメーターが 400 になり、無効時は無視されることを保証
+func TestStrictQuery(t *testing.T) {
+	captureLogs(t)
+	router := newRouter()
+	get := func(path string) int {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		return rr.Code
+	}
+
+	withConfig(t, func(c *Config) { c.StrictQuery = true })
+	if code := get("/healthz?verbos=true"); code != http.StatusBadRequest {
+		t.Errorf("Strict mode: expected 400 for unknown parameter, got %d", code)
+	}
+	if code := get("/healthz?verbose"); code != http.StatusOK {
+		t.Errorf("Strict mode: expected 200 for known parameter, got %d", code)
+	}
+	if code := get("/?utm_source=x"); code != http.StatusBadRequest {
+		t.Errorf("Strict mode: expected 400 for parameter on route without params, got %d", code)
+	}
+
+	withConfig(t, func(c *Config) { c.StrictQuery = false })
+	if code := get("/healthz?verbos=true"); code != http.StatusOK {
+		t.Errorf("Non-strict mode: expected unknown parameter to be ignored, got %d", code)
+	}
+}
+
+// TestStrictAccept は STRICT_ACCEPT のテスト
+// 厳格モードでは応答できない Accept に 406 を返し、既定では従来どおり JSON で応答することを保証
+func TestStrictAccept(t *testing.T) {
+	captureLogs(t)
+	router := newRouter()
+	get := func(path, accept string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept", accept)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	withConfig(t, func(c *Config) { c.StrictAccept = true })
+	if code := get("/health", "application/xml"); code != http.StatusNotAcceptable {
+		t.Errorf("Strict mode: expected 406 for unsupported type, got %d", code)
+	}
+	for _, accept := range []string{"application/json", "application/*", "*/*", "text/html,*/*;q=0.8"} {
+		if code := get("/health", accept); code != http.StatusOK {
+			t.Errorf("Strict mode: expected 200 for Accept %q, got %d", accept, code)
+		}
+	}
+	if code := get("/metrics", "text/plain"); code != http.StatusOK {
+		t.Errorf("Strict mode: expected 200 for Prometheus format, got %d", code)
+	}
+
+	withConfig(t, func(c *Config) { c.StrictAccept = false })
+	if code := get("/health", "application/xml"); code != http.StatusOK {
+		t.Errorf("Lenient mode: expected unsupported type to be ignored, got %d", code)
+	}
+}
+
+// TestAdminOnlyBearerScheme は管理用エンドポイントの認証スキームのテスト
+// Bearer プレフィックスのないトークンそのものは一致していても 401 になることを保証
+func TestAdminOnlyBearerScheme(t *testing.T) {
+	withConfig(t, func(c *Config) { c.AdminToken = "secret" })
+	handler := adminOnly(func(w http.ResponseWriter, r *http.Request) {})
+
+	for _, tt := range []struct {
+		authorization string
+		want          int
+	}{
+		{"Bearer secret", http.StatusOK},
+		{"secret", http.StatusUnauthorized},
+		{"Basic secret", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"", http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest("GET", "/debug/requests", nil)
+		if tt.authorization != "" {
+			req.Header.Set("Authorization", tt.authorization)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		if rr.Code != tt.want {
+			t.Errorf("Authorization %q: expected %d, got %d", tt.authorization, tt.want, rr.Code)
+		}
+	}
+}
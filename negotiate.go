@@ -0,0 +1,65 @@
+package main
+
+import (
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// negotiateContentType は Accept ヘッダーと提供可能なメディアタイプから応答形式を選択する
+// q 値が最も高いものを選び、同順位の場合は offers の順序を優先する
+// Accept が空の場合は offers の先頭（デフォルト形式）を返し、一致しない場合は空文字を返す
+func negotiateContentType(accept string, offers ...string) string {
+	if len(offers) == 0 {
+		return ""
+	}
+	if strings.TrimSpace(accept) == "" {
+		return offers[0]
+	}
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		if q := acceptQuality(accept, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// acceptQuality は Accept ヘッダーにおける offer の q 値を返す（受け入れ不可なら 0）
+// "type/subtype" > "type/*" > "*/*" の順により具体的な指定を優先する
+func acceptQuality(accept, offer string) float64 {
+	offerType, _, _ := strings.Cut(offer, "/")
+
+	q, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		var s int
+		switch {
+		case mediaType == offer:
+			s = 2
+		case mediaType == offerType+"/*":
+			s = 1
+		case mediaType == "*/*":
+			s = 0
+		default:
+			continue
+		}
+		if s < specificity {
+			continue
+		}
+
+		pq := 1.0
+		if v, ok := params["q"]; ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				pq = f
+			}
+		}
+		q, specificity = pq, s
+	}
+	return q
+}
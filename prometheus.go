@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+// Prometheus テキスト形式（exposition format 0.0.4）のメディアタイプ
+const contentTypePrometheus = "text/plain; version=0.0.4; charset=utf-8"
+
+// OpenMetrics 1.0.0 テキスト形式のメディアタイプ
+const contentTypeOpenMetrics = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// promMetric は Prometheus 形式で出力する1メトリクス
+type promMetric struct {
+	name   string            // メトリクス名
+	help   string            // HELP 行の説明
+	typ    string            // "counter"・"gauge"・"histogram"
+	value  float64           // 値（histogram では未使用）
+	labels map[string]string // ラベル（任意）
+
+	histogram *HistogramSnapshot         // histogram の集計値（typ が "histogram" の場合のみ）
+	durations *DurationHistogramSnapshot // 処理時間の histogram の集計値（秒。histogram の代わりに指定する）
+
+	exemplar *requestExemplar // OpenMetrics のエグザンプラー（任意、counter のみ）
+}
+
+// requestExemplar はメトリクスから個別のリクエストを辿るためのエグザンプラー
+// OpenMetrics 形式でのみ出力し、直近のリクエストIDをカウンターに紐付ける
+type requestExemplar struct {
+	requestID string
+	time      time.Time
+}
+
+// lastRequestExemplar は直近に完了したリクエストのエグザンプラー
+var lastRequestExemplar atomic.Pointer[requestExemplar]
+
+// promMetrics は MetricsResponse を Prometheus 形式のメトリクス一覧に変換する
+func promMetrics(m MetricsResponse) []promMetric {
+	versionMatch := 0.0
+	if m.VersionMatch {
+		versionMatch = 1
+	}
+
+	metrics := []promMetric{
+		{name: "http_requests_total", help: "Total number of HTTP requests.", typ: "counter", value: float64(m.RequestCount), exemplar: m.lastRequest},
+		{name: "uptime_seconds", help: "Service uptime in seconds.", typ: "gauge", value: m.Uptime},
+		{name: "memory_usage_megabytes", help: "Heap memory in use in megabytes.", typ: "gauge", value: float64(m.MemoryUsageMB)},
+		{name: "http_request_latency_p95_seconds", help: "p95 latency over the most recent requests.", typ: "gauge", value: m.LatencyP95Ms / 1000},
+		{name: "gc_pause_fraction", help: "Fraction of wall time since startup spent in GC pauses.", typ: "gauge", value: m.GCFraction},
+		{name: "first_request_latency_seconds", help: "Latency of the first request handled after startup.", typ: "gauge", value: m.FirstRequestLatencyMs / 1000},
+		{name: "http_requests_per_second", help: "Average request rate over the last 60 seconds.", typ: "gauge", value: m.CurrentRPS},
+		{name: "distinct_client_ips", help: "Number of distinct client IPs seen since startup (capped at 10000).", typ: "gauge", value: float64(m.DistinctClientIPs)},
+		{name: "connection_reuse_ratio", help: "Fraction of requests served on reused keep-alive connections.", typ: "gauge", value: m.ConnectionReuseRatio},
+		{name: "oldest_inflight_request_age_seconds", help: "Age of the longest-running in-flight request.", typ: "gauge", value: m.OldestInflightAgeSeconds},
+		{name: "scrape_interval_seconds", help: "Seconds since the previous /metrics request.", typ: "gauge", value: m.LastScrapeIntervalSeconds},
+		{name: "scrape_interval_average_seconds", help: "Exponential moving average of the /metrics request interval.", typ: "gauge", value: m.AvgScrapeIntervalSeconds},
+		{name: "health_check_cache_hits_total", help: "Total number of dependency checks answered from the result cache.", typ: "counter", value: float64(m.HealthCacheHits)},
+		{name: "health_check_cache_misses_total", help: "Total number of cacheable dependency checks that had to run.", typ: "counter", value: float64(m.HealthCacheMisses)},
+		{name: "http_request_queue_wait_seconds_total", help: "Total time requests spent waiting for a concurrency slot.", typ: "counter", value: m.QueueWaitTimeMs / 1000},
+		{name: "http_panics_total", help: "Total number of recovered handler panics.", typ: "counter", value: float64(m.PanicCount)},
+		{name: "http_response_size_bytes", help: "Size of HTTP response bodies in bytes.", typ: "histogram", histogram: &m.ResponseSizeBytes},
+		// 同じ名前の連続したエントリーは1つのメトリクスファミリーのラベル違いの系列として出力する
+		{name: "http_request_duration_seconds", help: "HTTP request latency in seconds by outcome.", typ: "histogram", labels: map[string]string{"outcome": "success"}, durations: &m.LatencySuccessSeconds},
+		{name: "http_request_duration_seconds", help: "HTTP request latency in seconds by outcome.", typ: "histogram", labels: map[string]string{"outcome": "error"}, durations: &m.LatencyErrorSeconds},
+		{name: "log_bytes_written_total", help: "Total bytes written by the structured logger.", typ: "counter", value: float64(m.LogBytesWritten)},
+		{name: "metrics_collection_errors", help: "Number of metric samplers that failed during this scrape.", typ: "gauge", value: float64(m.CollectionErrors)},
+		{name: "config_reloads_total", help: "Total number of successful configuration reloads.", typ: "counter", value: float64(m.ConfigReloadCount)},
+		{name: "version_match", help: "Whether the running version matches EXPECTED_VERSION (1) or not (0).", typ: "gauge", value: versionMatch},
+		{
+			name: "build_info", help: "Build and rollout information.", typ: "gauge", value: 1,
+			labels: map[string]string{"version": m.Version, "generation": m.Generation},
+		},
+	}
+
+	// 非対応環境で取得できない値は出力しない（ゼロ値と区別するため）
+	if m.OpenFDs != nil {
+		metrics = append(metrics, promMetric{
+			name: "process_open_fds", help: "Number of open file descriptors.", typ: "gauge", value: float64(*m.OpenFDs),
+		})
+	}
+
+	// 同じ Prometheus に集約される他サービスのメトリクスと衝突しないよう名前空間を付与する
+	if ns := cfg().MetricsNamespace; ns != "" {
+		for i := range metrics {
+			metrics[i].name = ns + "_" + metrics[i].name
+		}
+	}
+	return metrics
+}
+
+// validMetricsNamespace は Prometheus のメトリクス名の先頭として使える名前空間かを判定する
+// （英字またはアンダースコアで始まり、英数字とアンダースコアのみ）
+func validMetricsNamespace(ns string) bool {
+	for i, r := range ns {
+		switch {
+		case r == '_', 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z':
+		case '0' <= r && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// writePrometheus はメトリクス一覧を Prometheus テキスト形式で出力する
+// 同じ名前が連続するエントリーは HELP・TYPE 行を1度だけ出力し、同じファミリーの系列とする
+func writePrometheus(w io.Writer, metrics []promMetric) error {
+	for i, m := range metrics {
+		if !continuesFamily(metrics, i) {
+			if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.typ); err != nil {
+				return err
+			}
+		}
+		if m.typ == "histogram" {
+			if err := writeHistogramSamples(w, m); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", m.name, formatLabels(m.labels), formatValue(m.value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// continuesFamily は i 番目のエントリーが直前のエントリーと同じメトリクスファミリーの系列か
+func continuesFamily(metrics []promMetric, i int) bool {
+	return i > 0 && metrics[i-1].name == metrics[i].name
+}
+
+// writeHistogramSamples は histogram の _bucket（累積、+Inf を含む）・_sum・_count サンプルを出力する
+// 形式は Prometheus テキスト形式と OpenMetrics で共通
+func writeHistogramSamples(w io.Writer, m promMetric) error {
+	h := m.histogram
+	if d := m.durations; d != nil {
+		// 処理時間のヒストグラムは上限・合計が秒単位の小数のため、書式だけ変えて同じ形式で出力する
+		les := make([]string, len(d.Buckets))
+		counts := make([]int64, len(d.Buckets))
+		for i, b := range d.Buckets {
+			les[i], counts[i] = formatValue(b.UpperBound), b.Count
+		}
+		return writeBucketSamples(w, m, les, counts, d.Count, formatValue(d.Sum))
+	}
+	les := make([]string, len(h.Buckets))
+	counts := make([]int64, len(h.Buckets))
+	for i, b := range h.Buckets {
+		les[i], counts[i] = strconv.FormatInt(b.UpperBound, 10), b.Count
+	}
+	return writeBucketSamples(w, m, les, counts, h.Count, strconv.FormatInt(h.Sum, 10))
+}
+
+// writeBucketSamples は書式化済みのバケット上限（les）・累積件数（counts）・全件数・合計から histogram のサンプルを出力する
+func writeBucketSamples(w io.Writer, m promMetric, les []string, counts []int64, count int64, sum string) error {
+	bucket := func(le string, count int64) error {
+		labels := map[string]string{"le": le}
+		for k, v := range m.labels {
+			labels[k] = v
+		}
+		_, err := fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, formatLabels(labels), count)
+		return err
+	}
+	for i, le := range les {
+		if err := bucket(le, counts[i]); err != nil {
+			return err
+		}
+	}
+	if err := bucket("+Inf", count); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%s_sum%s %s\n%s_count%s %d\n",
+		m.name, formatLabels(m.labels), sum, m.name, formatLabels(m.labels), count)
+	return err
+}
+
+// writeOpenMetrics はメトリクス一覧を OpenMetrics テキスト形式で出力する
+// counter はメトリクスファミリー名から _total を除き、サンプル名に _total を付与する
+// 出力の末尾には必須の "# EOF" 行を付ける
+func writeOpenMetrics(w io.Writer, metrics []promMetric) error {
+	for i, m := range metrics {
+		family, sample := m.name, m.name
+		if m.typ == "counter" {
+			family = strings.TrimSuffix(m.name, "_total")
+			sample = family + "_total"
+		}
+		exemplar := ""
+		if e := m.exemplar; e != nil && m.typ == "counter" && exemplarLabelsFit("request_id", e.requestID) {
+			// 1件のリクエストによる増分を、リクエストIDとその時刻とともに示す
+			exemplar = fmt.Sprintf(" # %s 1 %s", formatLabels(map[string]string{"request_id": e.requestID}),
+				strconv.FormatFloat(float64(e.time.UnixMilli())/1000, 'f', 3, 64))
+		}
+		if !continuesFamily(metrics, i) {
+			if _, err := fmt.Fprintf(w, "# TYPE %s %s\n# HELP %s %s\n", family, m.typ, family, m.help); err != nil {
+				return err
+			}
+		}
+		if m.typ == "histogram" {
+			if err := writeHistogramSamples(w, m); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "%s%s %s%s\n", sample, formatLabels(m.labels), formatValue(m.value), exemplar); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "# EOF\n")
+	return err
+}
+
+// maxExemplarLabelChars は OpenMetrics がエグザンプラーのラベル名と値の合計に課す上限（UTF-8 の文字数）
+const maxExemplarLabelChars = 128
+
+// exemplarLabelsFit はエグザンプラーのラベルが OpenMetrics の上限に収まるかを判定する
+// 上限を超えるとエクスポジション全体が厳密なパーサーに拒否されるため、収まらない場合はエグザンプラーを出力しない
+// （切り詰めたリクエストIDではリクエストを辿れないため、切り詰めはしない）
+func exemplarLabelsFit(name, value string) bool {
+	return utf8.RuneCountInString(name)+utf8.RuneCountInString(value) <= maxExemplarLabelChars
+}
+
+// formatLabels はラベルを {key="value",...} 形式に整形する（キー順は固定）
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", k, escapeLabelValue(labels[k]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// escapeLabelValue はラベル値のバックスラッシュ・ダブルクォート・改行をエスケープする
+func escapeLabelValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// formatValue は Prometheus 形式の数値表現を返す
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
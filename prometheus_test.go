@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// TestRolloutGeneration はロールアウト世代がヘルス・メトリクス・Prometheus ラベルに出力されることのテスト
+func TestRolloutGeneration(t *testing.T) {
+	t.Setenv("ROLLOUT_GENERATION", "")
+	t.Setenv("K_REVISION", "sre-workflow-00042-abc")
+	setConfig(mustLoadConfig(t))
+	t.Cleanup(func() { setConfig(defaultConfig()) })
+
+	// ヘルスチェックレスポンス
+	rr := httptest.NewRecorder()
+	healthHandler(rr, httptest.NewRequest("GET", "/health", nil))
+	var health HealthResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &health); err != nil {
+		t.Fatalf("Could not unmarshal response: %v", err)
+	}
+	if health.Generation != "sre-workflow-00042-abc" {
+		t.Errorf("Health: expected K_REVISION generation, got '%s'", health.Generation)
+	}
+
+	// JSON メトリクス
+	rr = httptest.NewRecorder()
+	metricsHandler(rr, httptest.NewRequest("GET", "/metrics", nil))
+	var metrics MetricsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &metrics); err != nil {
+		t.Fatalf("Could not unmarshal response: %v", err)
+	}
+	if metrics.Generation != "sre-workflow-00042-abc" {
+		t.Errorf("Metrics: expected K_REVISION generation, got '%s'", metrics.Generation)
+	}
+
+	// Prometheus ラベル
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Accept", "text/plain;version=0.0.4;q=0.5,*/*;q=0.1")
+	rr = httptest.NewRecorder()
+	metricsHandler(rr, req)
+	if ct := rr.Header().Get("Content-Type"); ct != contentTypePrometheus {
+		t.Errorf("Expected Prometheus content type, got '%s'", ct)
+	}
+	if !strings.Contains(rr.Body.String(), `build_info{generation="sre-workflow-00042-abc",version="1.0.0"} 1`) {
+		t.Errorf("Expected generation label in build_info:\n%s", rr.Body.String())
+	}
+
+	// ROLLOUT_GENERATION は K_REVISION より優先される
+	t.Setenv("ROLLOUT_GENERATION", "canary-7")
+	if c := mustLoadConfig(t); c.RolloutGeneration != "canary-7" {
+		t.Errorf("Expected ROLLOUT_GENERATION to take precedence, got '%s'", c.RolloutGeneration)
+	}
+
+	// どちらも未設定なら "unknown"
+	t.Setenv("ROLLOUT_GENERATION", "")
+	t.Setenv("K_REVISION", "")
+	if c := mustLoadConfig(t); c.RolloutGeneration != "unknown" {
+		t.Errorf("Expected default generation 'unknown', got '%s'", c.RolloutGeneration)
+	}
+}
+
+// TestNegotiateContentType は Accept ヘッダーによる応答形式選択のテスト
+func TestNegotiateContentType(t *testing.T) {
+	offers := []string{"application/json", "text/plain"}
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", "application/json"},
+		{"*/*", "application/json"},
+		{"application/json", "application/json"},
+		{"text/plain", "text/plain"},
+		{"text/plain;version=0.0.4;q=0.5,*/*;q=0.1", "text/plain"},
+		{"application/json;q=0.2,text/*;q=0.8", "text/plain"},
+		{"application/xml", ""},
+	}
+	for _, tt := range tests {
+		if got := negotiateContentType(tt.accept, offers...); got != tt.want {
+			t.Errorf("Accept %q: got %q want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+// TestEscapeLabelValue はラベル値のエスケープテスト
+func TestEscapeLabelValue(t *testing.T) {
+	if got := escapeLabelValue("a\"b\\c\nd"); got != `a\"b\\c\nd` {
+		t.Errorf("Unexpected escaped value: %s", got)
+	}
+}
+
+// TestOpenMetricsExposition は Accept による OpenMetrics 形式の選択テスト
+// Prometheus の既定 Accept で OpenMetrics が選ばれ、_total 規約と # EOF 終端に従うことを保証
+func TestOpenMetricsExposition(t *testing.T) {
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text;version=1.0.0,text/plain;version=0.0.4;q=0.5,*/*;q=0.1")
+	rr := httptest.NewRecorder()
+	metricsHandler(rr, req)
+
+	if ct := rr.Header().Get("Content-Type"); ct != contentTypeOpenMetrics {
+		t.Errorf("Expected OpenMetrics content type, got '%s'", ct)
+	}
+
+	body := rr.Body.String()
+	if !strings.HasSuffix(body, "\n# EOF\n") {
+		t.Errorf("Expected exposition to end with '# EOF', got:\n%s", body)
+	}
+	// counter のファミリー名には _total を含めず、サンプル名にのみ付与する
+	if !strings.Contains(body, "# TYPE sreworkflow_http_requests counter\n") {
+		t.Errorf("Expected counter family without _total suffix:\n%s", body)
+	}
+	if !strings.Contains(body, "\nsreworkflow_http_requests_total ") {
+		t.Errorf("Expected counter sample with _total suffix:\n%s", body)
+	}
+	if !strings.Contains(body, "# TYPE sreworkflow_uptime_seconds gauge\n") {
+		t.Errorf("Expected gauge family unchanged:\n%s", body)
+	}
+}
+
+// TestOpenMetricsExemplar は OpenMetrics 出力のエグザンプラーのテスト
+// 直近のリクエストIDがカウンターのエグザンプラーとして出力され、Prometheus テキスト形式には含まれないことを保証
+func TestOpenMetricsExemplar(t *testing.T) {
+	captureLogs(t)
+	handler := requestIDMiddleware(logMiddleware(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-ID", "req-exemplar-1")
+	handler(httptest.NewRecorder(), req)
+
+	scrape := func(accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		req.Header.Set("Accept", accept)
+		rr := httptest.NewRecorder()
+		metricsHandler(rr, req)
+		return rr
+	}
+
+	rr := scrape("application/openmetrics-text")
+	if ct := rr.Header().Get("Content-Type"); ct != contentTypeOpenMetrics {
+		t.Errorf("Expected OpenMetrics content type, got '%s'", ct)
+	}
+	body := rr.Body.String()
+	if !regexp.MustCompile(`(?m)^sreworkflow_http_requests_total \d+ # \{request_id="req-exemplar-1"\} 1 \d+\.\d{3}$`).MatchString(body) {
+		t.Errorf("Expected request_id exemplar on counter sample:\n%s", body)
+	}
+	if !strings.HasSuffix(body, "\n# EOF\n") {
+		t.Errorf("Expected exposition to end with '# EOF'")
+	}
+
+	// Prometheus テキスト形式はエグザンプラーに対応しないため出力しない
+	if body := scrape("text/plain").Body.String(); strings.Contains(body, "request_id=") {
+		t.Errorf("Exemplars should not appear in Prometheus text format:\n%s", body)
+	}
+
+	// ラベル名と合わせて 128 文字を超えるリクエストIDはエグザンプラーに出力しない
+	longID := strings.Repeat("a", 128)
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-ID", longID)
+	handler(httptest.NewRecorder(), req)
+	body = scrape("application/openmetrics-text").Body.String()
+	if strings.Contains(body, longID) {
+		t.Errorf("Exemplar exceeding the OpenMetrics label limit should be skipped:\n%s", body)
+	}
+	if !regexp.MustCompile(`(?m)^sreworkflow_http_requests_total \d+$`).MatchString(body) {
+		t.Errorf("Expected counter sample without exemplar:\n%s", body)
+	}
+
+	// 上限ちょうど（request_id の 10 文字 + 118 文字）は出力する
+	fitID := strings.Repeat("b", 118)
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-ID", fitID)
+	handler(httptest.NewRecorder(), req)
+	if body := scrape("application/openmetrics-text").Body.String(); !strings.Contains(body, `request_id="`+fitID+`"`) {
+		t.Errorf("Expected exemplar at the label limit:\n%s", body)
+	}
+}
+
+// TestMetricsNamespace は Prometheus メトリクス名の名前空間のテスト
+// 設定した名前空間がすべてのメトリクス名に付与され、空文字では付与されないことを保証
+func TestMetricsNamespace(t *testing.T) {
+	scrape := func() string {
+		rr := httptest.NewRecorder()
+		metricsHandler(rr, httptest.NewRequest("GET", "/metrics?format=prometheus", nil))
+		return rr.Body.String()
+	}
+
+	t.Setenv("METRICS_NAMESPACE", "checkout")
+	setConfig(mustLoadConfig(t))
+	t.Cleanup(func() { setConfig(defaultConfig()) })
+	for _, line := range strings.Split(strings.TrimSpace(scrape()), "\n") {
+		name := strings.TrimPrefix(strings.TrimPrefix(line, "# HELP "), "# TYPE ")
+		if !strings.HasPrefix(name, "checkout_") {
+			t.Errorf("Expected namespace prefix on %q", line)
+		}
+	}
+
+	t.Setenv("METRICS_NAMESPACE", "")
+	setConfig(mustLoadConfig(t))
+	if body := scrape(); !strings.Contains(body, "\nhttp_requests_total ") {
+		t.Errorf("Expected unprefixed metrics with empty namespace:\n%s", body)
+	}
+
+	t.Setenv("METRICS_NAMESPACE", "9lives")
+	if _, err := loadConfig(); err == nil {
+		t.Error("Expected error for namespace starting with a digit")
+	}
+}
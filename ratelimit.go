@@ -0,0 +1,135 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// レート制限のアルゴリズム（RATE_LIMIT_ALGORITHM）
+const (
+	rateLimitTokenBucket   = "token_bucket"   // バーストを許容しつつ平均レートを制限する
+	rateLimitSlidingWindow = "sliding_window" // 直近のウィンドウ内の件数を厳密に制限する
+)
+
+// requestLimiter はリクエスト1件を受け付けてよいかを判定するレート制限
+type requestLimiter interface {
+	allow() bool
+}
+
+// requestRateLimiter はアプリケーション全体で共有するレート制限（nil なら無制限）
+var requestRateLimiter requestLimiter
+
+// newRequestLimiter は設定に応じたレート制限を作成する（RATE_LIMIT が 0 以下なら nil）
+// トークンバケットは容量 RATE_LIMIT、RATE_LIMIT_WINDOW あたり RATE_LIMIT 個の速度で補充する
+func newRequestLimiter(c *Config) requestLimiter {
+	if c.RateLimit <= 0 || c.RateLimitWindow <= 0 {
+		return nil
+	}
+	if c.RateLimitAlgorithm == rateLimitSlidingWindow {
+		return newSlidingWindowLimiter(c.RateLimit, c.RateLimitWindow)
+	}
+	return newTokenBucket(c.RateLimit, float64(c.RateLimit)/c.RateLimitWindow.Seconds())
+}
+
+// slidingWindowLimiter は直近 window の間に受け付けた件数を max 以下に制限する（スライディングウィンドウログ方式）
+// 固定ウィンドウと異なり、ウィンドウの境界をまたいで 2 倍のリクエストを受け付けることがない
+type slidingWindowLimiter struct {
+	mu       sync.Mutex
+	max      int
+	window   time.Duration
+	accepted []time.Time      // ウィンドウ内で受け付けたリクエストの時刻（古い順、最大 max 件）
+	now      func() time.Time // 差し替え可能な時計（テスト用）
+}
+
+// newSlidingWindowLimiter は window あたり max 件までのスライディングウィンドウ制限を作成する
+func newSlidingWindowLimiter(max int, window time.Duration) *slidingWindowLimiter {
+	return &slidingWindowLimiter{max: max, window: window, now: time.Now}
+}
+
+// allow はウィンドウ外になった記録を捨て、ウィンドウ内の件数が max 未満なら受け付ける
+func (l *slidingWindowLimiter) allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	expired := 0
+	for expired < len(l.accepted) && !now.Before(l.accepted[expired].Add(l.window)) {
+		expired++
+	}
+	l.accepted = l.accepted[expired:]
+
+	if len(l.accepted) >= l.max {
+		return false
+	}
+	l.accepted = append(l.accepted, now)
+	return true
+}
+
+// newRouteLimiter はルート独自の上限 limit（RATE_LIMIT_WINDOW あたり）のレート制限を作成する
+// アルゴリズム・ウィンドウは全体の制限と共通で、limit が 0 以下なら nil（全体の制限を使用）
+func newRouteLimiter(c *Config, limit int) requestLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	rc := *c
+	rc.RateLimit = limit
+	return newRequestLimiter(&rc)
+}
+
+// routeLimiterKey はルート独自のレート制限を共有する単位
+// 上限・アルゴリズム・ウィンドウを含め、設定の変更後は新しい制限を作成する
+type routeLimiterKey struct {
+	pattern   string
+	limit     int
+	algorithm string
+	window    time.Duration
+}
+
+// routeLimiterRegistry はルート独自のレート制限をルートごとに1つだけ保持する
+// ルーターの構築のたびに作成すると、公開・管理用リスナーや再構築ごとに別々に数えてしまうため
+type routeLimiterRegistry struct {
+	mu       sync.Mutex
+	limiters map[routeLimiterKey]requestLimiter
+}
+
+func newRouteLimiterRegistry() *routeLimiterRegistry {
+	return &routeLimiterRegistry{limiters: make(map[routeLimiterKey]requestLimiter)}
+}
+
+// routeLimiters はルート独自のレート制限の登録先（差し替え可能。テスト用）
+var routeLimiters = newRouteLimiterRegistry()
+
+// get は pattern のルート独自のレート制限を返す。未作成なら newRouteLimiter で作成して登録する
+func (reg *routeLimiterRegistry) get(c *Config, pattern string, limit int) requestLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	key := routeLimiterKey{pattern: pattern, limit: limit, algorithm: c.RateLimitAlgorithm, window: c.RateLimitWindow}
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	l, ok := reg.limiters[key]
+	if !ok {
+		l = newRouteLimiter(c, limit)
+		reg.limiters[key] = l
+	}
+	return l
+}
+
+// rateLimitMiddleware は上限を超えたリクエストに 429 を返すミドルウェア
+// routeLimiter（ルート独自の制限）が nil なら全体の制限（RATE_LIMIT）を適用する
+// プローブ用エンドポイントには全体の制限を適用しない（制限によるコンテナの再起動を避けるため）
+func rateLimitMiddleware(routeLimiter requestLimiter, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		l := routeLimiter
+		if l == nil {
+			l = requestRateLimiter
+		}
+		if l != nil && !l.allow() {
+			w.Header().Set("Retry-After", "1")
+			writeError(w, r, "Too Many Requests", http.StatusTooManyRequests)
+			return
+		}
+		next(w, r)
+	}
+}
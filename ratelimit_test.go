@@ -0,0 +1,170 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSlidingWindowLimiter はスライディングウィンドウ方式のレート制限のテスト
+// ウィンドウの境界をまたいでも、直近のウィンドウ内の件数で判定することを保証
+func TestSlidingWindowLimiter(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := newSlidingWindowLimiter(3, time.Second)
+	l.now = func() time.Time { return now }
+
+	step := func(d time.Duration, want bool) {
+		t.Helper()
+		now = now.Add(d)
+		if got := l.allow(); got != want {
+			t.Errorf("At +%v: expected allow=%v, got %v", now.Sub(time.Unix(1700000000, 0)), want, got)
+		}
+	}
+	step(0, true)                     // 0.0s
+	step(600*time.Millisecond, true)  // 0.6s
+	step(300*time.Millisecond, true)  // 0.9s
+	step(50*time.Millisecond, false)  // 0.95s: ウィンドウ内に3件
+	step(150*time.Millisecond, true)  // 1.1s: 0.0s の記録がウィンドウ外に（固定ウィンドウなら新しい窓の1件目）
+	step(100*time.Millisecond, false) // 1.2s: 0.6s・0.9s・1.1s の3件
+	step(400*time.Millisecond, true)  // 1.6s: 0.6s の記録がウィンドウ外に
+	step(0, false)                    // 1.6s: 0.9s・1.1s・1.6s の3件
+}
+
+// TestRateLimitAlgorithmConfig は RATE_LIMIT_ALGORITHM による実装の選択と検証のテスト
+func TestRateLimitAlgorithmConfig(t *testing.T) {
+	t.Setenv("RATE_LIMIT", "5")
+	t.Setenv("RATE_LIMIT_ALGORITHM", "sliding_window")
+	c := mustLoadConfig(t)
+	if _, ok := newRequestLimiter(&c).(*slidingWindowLimiter); !ok {
+		t.Error("Expected sliding window limiter")
+	}
+
+	t.Setenv("RATE_LIMIT_ALGORITHM", "token_bucket")
+	c = mustLoadConfig(t)
+	if _, ok := newRequestLimiter(&c).(*tokenBucket); !ok {
+		t.Error("Expected token bucket limiter")
+	}
+
+	t.Setenv("RATE_LIMIT_ALGORITHM", "fixed_window")
+	if _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), "RATE_LIMIT_ALGORITHM") {
+		t.Errorf("Expected validation error, got %v", err)
+	}
+}
+
+// TestPerRouteRateLimit はルートごとのレート制限のテスト
+// 厳しい制限と緩い制限のルートがそれぞれ独立して制限され、未指定のルートは全体の制限に従うことを保証
+func TestPerRouteRateLimit(t *testing.T) {
+	captureLogs(t)
+	withConfig(t, func(c *Config) {
+		c.RateLimitWindow = time.Hour
+		c.RateLimitAlgorithm = rateLimitSlidingWindow
+	})
+	orig := requestRateLimiter
+	requestRateLimiter = newSlidingWindowLimiter(3, time.Hour)
+	t.Cleanup(func() { requestRateLimiter = orig })
+	origLimiters := routeLimiters
+	routeLimiters = newRouteLimiterRegistry()
+	t.Cleanup(func() { routeLimiters = origLimiters })
+
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	mux := http.NewServeMux()
+	for _, rt := range []route{
+		{pattern: "/strict", handler: ok, rateLimit: 1},
+		{pattern: "/lenient", handler: ok, rateLimit: 10},
+		{pattern: "/probe", handler: ok, probe: true, rateLimit: 2},
+		{pattern: "/default", handler: ok},
+	} {
+		mux.HandleFunc(rt.pattern, rt.build())
+	}
+	count := func(path string, n int) (accepted int) {
+		for i := 0; i < n; i++ {
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+			if rr.Code == http.StatusOK {
+				accepted++
+			} else if rr.Code != http.StatusTooManyRequests {
+				t.Fatalf("%s: unexpected status %d", path, rr.Code)
+			}
+		}
+		return accepted
+	}
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/strict", 1},
+		{"/lenient", 10}, // /strict の上限に達していても影響を受けない
+		{"/probe", 2},    // 明示的な制限はプローブにも適用する
+		{"/default", 3},  // 全体の制限（RATE_LIMIT）にフォールバック
+	}
+	for _, tt := range tests {
+		if got := count(tt.path, 12); got != tt.want {
+			t.Errorf("%s: expected %d accepted requests, got %d", tt.path, tt.want, got)
+		}
+	}
+}
+
+// TestPerRouteRateLimitSharedAcrossBuilds はルート独自のレート制限の共有のテスト
+// 公開用・管理用のルーターや再構築で同じルートを複数回構築しても、上限を1つのバケットで数えることを保証
+func TestPerRouteRateLimitSharedAcrossBuilds(t *testing.T) {
+	captureLogs(t)
+	withConfig(t, func(c *Config) {
+		c.RateLimitWindow = time.Hour
+		c.RateLimitAlgorithm = rateLimitSlidingWindow
+	})
+	origLimiters := routeLimiters
+	routeLimiters = newRouteLimiterRegistry()
+	t.Cleanup(func() { routeLimiters = origLimiters })
+
+	rt := route{pattern: "/strict", handler: func(w http.ResponseWriter, r *http.Request) {}, rateLimit: 2}
+	public, admin, rebuilt := rt.build(), rt.build(), rt.build()
+
+	var codes []int
+	for _, h := range []http.HandlerFunc{public, admin, rebuilt} {
+		rr := httptest.NewRecorder()
+		h(rr, httptest.NewRequest("GET", "/strict", nil))
+		codes = append(codes, rr.Code)
+	}
+	want := []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}
+	for i := range want {
+		if codes[i] != want[i] {
+			t.Errorf("Expected %v across builds, got %v", want, codes)
+			break
+		}
+	}
+
+	// 上限が変わった場合は新しい制限を作成する
+	rt.rateLimit = 3
+	rr := httptest.NewRecorder()
+	rt.build()(rr, httptest.NewRequest("GET", "/strict", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("Changed limit should get a fresh limiter, got %d", rr.Code)
+	}
+}
+
+// TestRateLimitMiddleware は上限超過時に 429 を返し、プローブには適用しないことを確認する
+func TestRateLimitMiddleware(t *testing.T) {
+	captureLogs(t)
+	orig := requestRateLimiter
+	requestRateLimiter = newSlidingWindowLimiter(1, time.Hour)
+	t.Cleanup(func() { requestRateLimiter = orig })
+	router := newRouter()
+
+	get := func(path string) int {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		return rr.Code
+	}
+	if code := get("/"); code != http.StatusOK {
+		t.Errorf("First request: expected 200, got %d", code)
+	}
+	if code := get("/"); code != http.StatusTooManyRequests {
+		t.Errorf("Second request: expected 429, got %d", code)
+	}
+	if code := get("/health"); code != http.StatusOK {
+		t.Errorf("Probe should not be rate limited, got %d", code)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// redirect はリダイレクトテーブルの1エントリ（旧 URL 体系からの移行用）
+type redirect struct {
+	from string // リダイレクト元のパス（ServeMux のパターン。"/" で終わる場合は配下すべて）
+	to   string // リダイレクト先のパス（同一オリジン内のみ）
+}
+
+// parseRedirects は "from=to" のカンマ区切り一覧を解析する
+// オープンリダイレクトを防ぐため、リダイレクト先はホストを含まないローカルパスに限る
+// 既存のルートやほかのエントリと重複するリダイレクト元はエラーとする
+func parseRedirects(s string) ([]redirect, error) {
+	seen := make(map[string]bool)
+	for _, rt := range routes() {
+		seen[rt.pattern] = true
+	}
+
+	var out []redirect
+	for _, pair := range splitList(s) {
+		from, to, ok := strings.Cut(pair, "=")
+		from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+		if !ok || !isLocalPath(from) || !isLocalPath(to) {
+			return nil, fmt.Errorf("invalid entry %q: expected /from=/to with local paths", pair)
+		}
+		if seen[from] {
+			return nil, fmt.Errorf("duplicate redirect source %q", from)
+		}
+		seen[from] = true
+		out = append(out, redirect{from: from, to: to})
+	}
+	return out, nil
+}
+
+// isLocalPath は p が同一オリジン内のパス（"/" で始まり、"//" や "/\" のようなホスト指定にならない）かを判定する
+func isLocalPath(p string) bool {
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") || strings.HasPrefix(p, `/\`) {
+		return false
+	}
+	return !strings.ContainsAny(p, " \t\r\n")
+}
+
+// redirectHandler は to へリダイレクトするハンドラーを返す
+// GET・HEAD は 301、それ以外はメソッドと本文を保持させるため 308 を返す
+// BASE_PATH 配下で動作する場合はプレフィックスを付与し、クエリ文字列は引き継ぐ
+func redirectHandler(to string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		code := http.StatusPermanentRedirect
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			code = http.StatusMovedPermanently
+		}
+		target := cfg().BasePath + to
+		if r.URL.RawQuery != "" && !strings.Contains(to, "?") {
+			target += "?" + r.URL.RawQuery
+		}
+		w.Header().Set("Location", target)
+		w.WriteHeader(code)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestRedirects はリダイレクトテーブルのテスト
+// 設定したパスが 301/308 と正しい Location でリダイレクトされることを保証
+func TestRedirects(t *testing.T) {
+	captureLogs(t)
+	t.Setenv("REDIRECTS", "/status=/health, /old/metrics=/metrics")
+	c := mustLoadConfig(t)
+	withConfig(t, func(cc *Config) { cc.Redirects = c.Redirects })
+	router := newRouter()
+
+	tests := []struct {
+		method, path string
+		wantCode     int
+		wantLocation string
+	}{
+		{"GET", "/status", http.StatusMovedPermanently, "/health"},
+		{"GET", "/status?deep=true", http.StatusMovedPermanently, "/health?deep=true"},
+		{"POST", "/old/metrics", http.StatusPermanentRedirect, "/metrics"},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, nil))
+		if rr.Code != tt.wantCode {
+			t.Errorf("%s %s: expected %d, got %d", tt.method, tt.path, tt.wantCode, rr.Code)
+		}
+		if loc := rr.Header().Get("Location"); loc != tt.wantLocation {
+			t.Errorf("%s %s: expected Location %q, got %q", tt.method, tt.path, tt.wantLocation, loc)
+		}
+	}
+
+	// BASE_PATH 配下ではリダイレクト先にもプレフィックスを付与する
+	withConfig(t, func(cc *Config) { cc.Redirects = c.Redirects; cc.BasePath = "/app" })
+	rr := httptest.NewRecorder()
+	newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/app/status", nil))
+	if loc := rr.Header().Get("Location"); loc != "/app/health" {
+		t.Errorf("Base path: expected Location /app/health, got %q", loc)
+	}
+}
+
+// TestRedirectsValidation はリダイレクト先がローカルパスに限られることを確認する
+func TestRedirectsValidation(t *testing.T) {
+	for _, bad := range []string{
+		"/old=https://evil.example.com/",
+		"/old=//evil.example.com",
+		`/old=/\evil.example.com`,
+		"old=/health",
+		"/old",
+		"/health=/ready",
+		"/a=/health,/a=/ready",
+	} {
+		if _, err := parseRedirects(bad); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
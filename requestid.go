@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// リクエストIDの形式
+const (
+	requestIDFormatUUID = "uuid" // UUID v4（デフォルト）
+	requestIDFormatULID = "ulid" // ULID（時刻順にソート可能）
+	requestIDFormatHex  = "hex"  // 16桁の16進数
+)
+
+// requestIDGenerators は REQUEST_ID_FORMAT で選択可能なリクエストID生成関数
+var requestIDGenerators = map[string]func() string{
+	requestIDFormatUUID: newUUIDv4,
+	requestIDFormatULID: newULID,
+	requestIDFormatHex:  newShortHex,
+}
+
+// validateRequestIDFormat はリクエストID形式が既知のものかを検証する
+func validateRequestIDFormat(format string) error {
+	if _, ok := requestIDGenerators[format]; ok {
+		return nil
+	}
+	known := make([]string, 0, len(requestIDGenerators))
+	for k := range requestIDGenerators {
+		known = append(known, k)
+	}
+	sort.Strings(known)
+	return fmt.Errorf("invalid REQUEST_ID_FORMAT %q: must be one of %s", format, strings.Join(known, ", "))
+}
+
+// requestIDKey はリクエストIDをコンテキストに格納するためのキー
+type requestIDKey struct{}
+
+// requestIDFromContext はコンテキストに格納されたリクエストIDを返す（未設定なら空文字）
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestIDMiddleware はリクエストごとにIDを割り当て、X-Request-ID ヘッダーで返すミドルウェア
+// 上流（LB・呼び出し元）が付与した妥当な X-Request-ID はそのまま引き継ぐ
+func requestIDMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = requestIDGenerators[cfg().RequestIDFormat]()
+		}
+		w.Header().Set("X-Request-ID", id)
+		next(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	}
+}
+
+// validRequestID は引き継ぐリクエストIDが妥当か（空でなく128文字以内の表示可能なASCII）を判定する
+// ログへの改行注入や巨大な値の持ち込みを防ぐ
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// newUUIDv4 は RFC 4122 形式のランダムな UUID v4 を生成する
+func newUUIDv4() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40 // バージョン 4
+	b[8] = b[8]&0x3f | 0x80 // バリアント RFC 4122
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// crockfordBase32 は ULID で使用する Crockford の Base32 文字集合
+const crockfordBase32 = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// newULID はミリ秒精度の時刻（48bit）と乱数（80bit）からなる ULID を生成する
+func newULID() string {
+	var b [16]byte
+	ms := uint64(time.Now().UnixMilli())
+	binary.BigEndian.PutUint64(b[0:8], ms<<16)
+	rand.Read(b[6:16])
+
+	// 128bit を先頭から 5bit ずつ 26文字にエンコードする（先頭文字は上位 3bit のみ）
+	hi, lo := binary.BigEndian.Uint64(b[0:8]), binary.BigEndian.Uint64(b[8:16])
+	var out [26]byte
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i] = crockfordBase32[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+// newShortHex は 64bit の乱数を16桁の16進数で返す
+func newShortHex() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
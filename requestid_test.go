@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// TestRequestIDFormats は REQUEST_ID_FORMAT ごとのリクエストID形式のテスト
+// 設定した形式のIDが生成され、レスポンスヘッダーとコンテキストに設定されることを保証
+func TestRequestIDFormats(t *testing.T) {
+	tests := []struct {
+		format  string
+		pattern string
+	}{
+		{"uuid", `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`},
+		{"ULID", `^[0-7][0-9A-HJKMNP-TV-Z]{25}$`},
+		{"hex", `^[0-9a-f]{16}$`},
+	}
+	for _, tt := range tests {
+		t.Setenv("REQUEST_ID_FORMAT", tt.format)
+		setConfig(mustLoadConfig(t))
+		t.Cleanup(func() { setConfig(defaultConfig()) })
+
+		var seen string
+		handler := requestIDMiddleware(func(w http.ResponseWriter, r *http.Request) {
+			seen = requestIDFromContext(r.Context())
+		})
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest("GET", "/", nil))
+
+		id := rr.Header().Get("X-Request-ID")
+		if !regexp.MustCompile(tt.pattern).MatchString(id) {
+			t.Errorf("%s: ID %q does not match %s", tt.format, id, tt.pattern)
+		}
+		if seen != id {
+			t.Errorf("%s: context ID %q differs from header %q", tt.format, seen, id)
+		}
+	}
+}
+
+// TestRequestIDPropagation は上流から渡されたリクエストIDの引き継ぎテスト
+func TestRequestIDPropagation(t *testing.T) {
+	handler := requestIDMiddleware(func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		incoming string
+		keep     bool
+	}{
+		{"upstream-123", true},
+		{"bad id\nwith newline", false},
+		{strings.Repeat("a", 129), false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Request-ID", tt.incoming)
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		if got := rr.Header().Get("X-Request-ID"); (got == tt.incoming) != tt.keep {
+			t.Errorf("Incoming %q: got %q, keep %v", tt.incoming, got, tt.keep)
+		}
+	}
+}
+
+// TestRequestIDFormatValidation は未知の REQUEST_ID_FORMAT を起動時に拒否することのテスト
+func TestRequestIDFormatValidation(t *testing.T) {
+	t.Setenv("REQUEST_ID_FORMAT", "snowflake")
+	if _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), "REQUEST_ID_FORMAT") {
+		t.Errorf("Expected REQUEST_ID_FORMAT validation error, got %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RequestLogEntry は直近リクエストの記録
+type RequestLogEntry struct {
+	Time       string  `json:"time"`                 // リクエスト開始時刻（RFC3339Nano）
+	Method     string  `json:"method"`               // HTTP メソッド
+	URI        string  `json:"uri"`                  // リクエスト URI
+	RemoteAddr string  `json:"remote_addr"`          // 接続元アドレス
+	DurationMs float64 `json:"duration_ms"`          // 処理時間（ミリ秒）
+	RequestID  string  `json:"request_id,omitempty"` // リクエストID
+}
+
+// requestRing は直近のリクエストを保持するリングバッファ
+// 最大 DEBUG_LOG_SIZE 件を保持し、DEBUG_LOG_MAX_AGE より古い記録はバッファが埋まっていなくても破棄する
+type requestRing struct {
+	mu      sync.Mutex
+	entries []requestRingEntry // 古い順
+	now     func() time.Time   // 差し替え可能な時刻関数（テスト用）
+}
+
+// requestRingEntry は記録時刻付きのリクエスト記録
+type requestRingEntry struct {
+	at    time.Time
+	entry RequestLogEntry
+}
+
+// recentRequests はアプリケーション全体で共有する直近リクエストの記録
+var recentRequests = &requestRing{now: time.Now}
+
+// Add はリクエストを記録し、上限件数を超えた古い記録を破棄する
+func (rr *requestRing) Add(e RequestLogEntry) {
+	size := cfg().DebugLogSize
+	if size <= 0 {
+		return
+	}
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	rr.entries = append(rr.entries, requestRingEntry{at: rr.now(), entry: e})
+	if over := len(rr.entries) - size; over > 0 {
+		rr.entries = append(rr.entries[:0], rr.entries[over:]...)
+	}
+	rr.evictLocked()
+}
+
+// Entries は保持している記録を古い順に返す（期限切れの記録は破棄してから返す）
+func (rr *requestRing) Entries() []RequestLogEntry {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	rr.evictLocked()
+	out := make([]RequestLogEntry, 0, len(rr.entries))
+	for _, e := range rr.entries {
+		out = append(out, e.entry)
+	}
+	return out
+}
+
+// evictLocked は DEBUG_LOG_MAX_AGE より古い記録を破棄する（rr.mu を保持して呼び出す）
+func (rr *requestRing) evictLocked() {
+	maxAge := cfg().DebugLogMaxAge
+	if maxAge <= 0 {
+		return
+	}
+	cutoff := rr.now().Add(-maxAge)
+	i := 0
+	for i < len(rr.entries) && rr.entries[i].at.Before(cutoff) {
+		i++
+	}
+	if i > 0 {
+		rr.entries = append(rr.entries[:0], rr.entries[i:]...)
+	}
+}
+
+// debugRequestsHandler は直近のリクエスト記録を返すエンドポイント（GET /debug/requests）
+// ログ基盤を参照せずに、直近どのようなリクエストが来ているかを確認するために使用
+func debugRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, r, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(recentRequests.Entries()); err != nil {
+		log.Printf("Error encoding requests response: %v", err)
+	}
+}
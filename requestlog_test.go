@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestRequestRingMaxAge は直近リクエスト記録の時間による破棄のテスト
+// バッファが埋まっていなくても DEBUG_LOG_MAX_AGE を過ぎた記録は破棄されることを保証
+func TestRequestRingMaxAge(t *testing.T) {
+	withConfig(t, func(c *Config) {
+		c.DebugLogSize = 10
+		c.DebugLogMaxAge = time.Minute
+	})
+	now := time.Unix(1700000000, 0)
+	ring := &requestRing{now: func() time.Time { return now }}
+
+	ring.Add(RequestLogEntry{URI: "/old-1"})
+	ring.Add(RequestLogEntry{URI: "/old-2"})
+	now = now.Add(30 * time.Second)
+	ring.Add(RequestLogEntry{URI: "/new"})
+
+	if got := len(ring.Entries()); got != 3 {
+		t.Fatalf("Expected 3 entries within max age, got %d", got)
+	}
+
+	// 最初の2件だけが期限切れになる
+	now = now.Add(45 * time.Second)
+	entries := ring.Entries()
+	if len(entries) != 1 || entries[0].URI != "/new" {
+		t.Errorf("Expected only /new after max age, got %+v", entries)
+	}
+
+	now = now.Add(time.Hour)
+	if got := ring.Entries(); len(got) != 0 {
+		t.Errorf("Expected all entries evicted, got %+v", got)
+	}
+}
+
+// TestRequestRingSize は件数上限による破棄と /debug/requests のテスト
+func TestRequestRingSize(t *testing.T) {
+	withConfig(t, func(c *Config) {
+		c.DebugLogSize = 2
+		c.AdminToken = "secret"
+	})
+	orig := recentRequests
+	recentRequests = &requestRing{now: time.Now}
+	t.Cleanup(func() { recentRequests = orig })
+	captureLogs(t)
+
+	handler := logMiddleware(func(w http.ResponseWriter, r *http.Request) {})
+	for _, path := range []string{"/a", "/b", "/c"} {
+		handler(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	req := httptest.NewRequest("GET", "/debug/requests", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rr := httptest.NewRecorder()
+	adminOnly(debugRequestsHandler)(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rr.Code)
+	}
+
+	var entries []RequestLogEntry
+	if err := json.Unmarshal(rr.Body.Bytes(), &entries); err != nil {
+		t.Fatalf("Could not unmarshal response: %v", err)
+	}
+	if len(entries) != 2 || entries[0].URI != "/b" || entries[1].URI != "/c" {
+		t.Errorf("Expected last 2 requests oldest first, got %+v", entries)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// encodeResponse はレスポンス構造体を JSON で出力する
+// JSON_OMIT_EMPTY 有効時は、任意項目（optional:"true" タグ）のゼロ値をキーごと省略する
+func encodeResponse(w io.Writer, v any) error {
+	if !cfg().JSONOmitEmpty {
+		return json.NewEncoder(w).Encode(v)
+	}
+	b, err := marshalOmitEmpty(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// marshalOmitEmpty は構造体の任意項目のゼロ値を省略して JSON に変換する
+// 省略するのは optional:"true" タグ（ゼロ値が「値がない」ことを意味する項目）と omitempty タグのフィールドのみで、
+// false や 0 に意味のあるフィールド（version_match・panic_count など）は常に出力する
+// フィールドの出力順は構造体の定義順を保つ（構造体以外は通常どおり変換する）
+func marshalOmitEmpty(v any) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return json.Marshal(v)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		optional := f.Tag.Get("optional") == "true" || strings.Contains(","+opts+",", ",omitempty,")
+		if optional && isEmptyValue(rv.Field(i)) {
+			continue
+		}
+
+		value, err := json.Marshal(rv.Field(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+		key, _ := json.Marshal(name)
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// isEmptyValue はゼロ値、または空のスライス・マップ（値がないもの）かを判定する
+func isEmptyValue(v reflect.Value) bool {
+	if k := v.Kind(); k == reflect.Slice || k == reflect.Map {
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestJSONOmitEmpty は JSON_OMIT_EMPTY によるゼロ値フィールド省略のテスト
+// 既定では従来どおりキーを出力し、有効時は未設定の任意項目がキーごと省略されることを保証
+func TestJSONOmitEmpty(t *testing.T) {
+	scrape := func() map[string]any {
+		rr := httptest.NewRecorder()
+		metricsHandler(rr, httptest.NewRequest("GET", "/metrics", nil))
+		var got map[string]any
+		if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+			t.Fatalf("Could not unmarshal response: %v", err)
+		}
+		return got
+	}
+
+	// 処理中のリクエストがなければ oldest_inflight_age_seconds は 0
+	if _, ok := scrape()["oldest_inflight_age_seconds"]; !ok {
+		t.Errorf("Expected oldest_inflight_age_seconds to be present by default")
+	}
+
+	withConfig(t, func(c *Config) { c.JSONOmitEmpty = true })
+	got := scrape()
+	if _, ok := got["oldest_inflight_age_seconds"]; ok {
+		t.Errorf("Expected zero oldest_inflight_age_seconds to be omitted, got %v", got["oldest_inflight_age_seconds"])
+	}
+	if got["version"] != "1.0.0" {
+		t.Errorf("Expected non-zero fields to be kept, got %v", got["version"])
+	}
+	// 0 や false に意味のあるフィールドは省略しない
+	if v, ok := got["collection_errors"]; !ok || v != float64(0) {
+		t.Errorf("Expected collection_errors 0 to be kept, got %v (present=%v)", v, ok)
+	}
+
+	// ヘルスチェックも同様に省略される
+	rr := httptest.NewRecorder()
+	healthHandler(rr, httptest.NewRequest("GET", "/health", nil))
+	var health map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &health); err != nil {
+		t.Fatalf("Could not unmarshal response: %v", err)
+	}
+	if health["status"] != "healthy" {
+		t.Errorf("Expected status healthy, got %v", health["status"])
+	}
+}
+
+// TestMarshalOmitEmpty はゼロ値省略時のフィールド順とタグ処理のテスト
+// 省略は任意項目（optional・omitempty タグ）に限られ、false や 0 は出力されることを保証
+func TestMarshalOmitEmpty(t *testing.T) {
+	v := struct {
+		B      string   `json:"b"`
+		A      int      `json:"a"`
+		Skip   string   `json:"-"`
+		Empty  []string `json:"empty" optional:"true"`
+		Gen    string   `json:"gen" optional:"true"`
+		Msg    string   `json:"msg,omitempty"`
+		Match  bool     `json:"match"`
+		Plain  bool
+		hidden string
+	}{B: "x", A: 0, Skip: "s", Empty: []string{}, Match: false, Plain: true, hidden: "h"}
+
+	got, err := marshalOmitEmpty(v)
+	if err != nil {
+		t.Fatalf("marshalOmitEmpty: %v", err)
+	}
+	if want := `{"b":"x","a":0,"match":false,"Plain":true}`; string(got) != want {
+		t.Errorf("got %s want %s", got, want)
+	}
+}
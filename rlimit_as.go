@@ -0,0 +1,10 @@
+//go:build unix && !openbsd
+
+package main
+
+import "syscall"
+
+// OpenBSD には RLIMIT_AS がないため、それ以外の Unix のみ as を報告する
+func init() {
+	rlimitResources["as"] = syscall.RLIMIT_AS
+}
@@ -0,0 +1,13 @@
+//go:build linux && !mips && !mipsle && !mips64 && !mips64le
+
+package main
+
+// rlimitNproc は Linux の RLIMIT_NPROC
+// 標準ライブラリのみで実装するため golang.org/x/sys/unix は使わず、カーネルの
+// include/uapi/asm-generic/resource.h の値（6）をそのまま使う
+// MIPS は arch/mips/include/uapi/asm/resource.h で別の値（8）を定義しているため、ビルドタグで除外している
+const rlimitNproc = 0x6
+
+func init() {
+	rlimitResources["nproc"] = rlimitNproc
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+// readRlimits は非 Unix 環境では常に errRlimitUnsupported を返す
+func readRlimits() (map[string]Rlimit, error) {
+	return nil, errRlimitUnsupported
+}
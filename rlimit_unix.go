@@ -0,0 +1,38 @@
+//go:build unix
+
+package main
+
+import (
+	"math"
+	"syscall"
+)
+
+// rlimitResources は /debug/limits で報告するリソース（すべての Unix で定義されているもの）
+// as は OpenBSD の syscall パッケージに定数がないため rlimit_as.go で、
+// nproc は syscall パッケージに定数がないため rlimit_linux.go で、対応する OS のみ追加する
+var rlimitResources = map[string]int{
+	"nofile": syscall.RLIMIT_NOFILE,
+	"stack":  syscall.RLIMIT_STACK,
+}
+
+// readRlimits はプロセスのリソース制限を取得する
+func readRlimits() (map[string]Rlimit, error) {
+	limits := make(map[string]Rlimit, len(rlimitResources))
+	for name, resource := range rlimitResources {
+		var rl syscall.Rlimit
+		if err := syscall.Getrlimit(resource, &rl); err != nil {
+			return nil, err
+		}
+		limits[name] = Rlimit{Soft: rlimitValue(uint64(rl.Cur)), Hard: rlimitValue(uint64(rl.Max))}
+	}
+	return limits, nil
+}
+
+// rlimitValue は RLIM_INFINITY を -1 に変換する
+// RLIM_INFINITY は OS により ^uint64(0)（Linux）または math.MaxInt64（Darwin など）のため、範囲で判定する
+func rlimitValue(v uint64) int64 {
+	if v >= math.MaxInt64 {
+		return -1
+	}
+	return int64(v)
+}
@@ -0,0 +1,44 @@
+//go:build unix
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestDebugLimits はプロセスのリソース制限エンドポイントのテスト
+// nofile のソフトリミットが正の値として報告されることを保証
+func TestDebugLimits(t *testing.T) {
+	withConfig(t, func(c *Config) { c.AdminToken = "secret" })
+	handler := route{pattern: "/debug/limits", handler: adminOnly(debugLimitsHandler)}.build()
+
+	req := httptest.NewRequest("GET", "/debug/limits", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var resp LimitsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Could not unmarshal response: %v", err)
+	}
+	nofile, ok := resp.Limits["nofile"]
+	if !ok || (nofile.Soft <= 0 && nofile.Soft != -1) {
+		t.Errorf("Expected positive nofile soft limit, got %+v", resp.Limits)
+	}
+	if nofile.Hard != -1 && nofile.Soft > nofile.Hard {
+		t.Errorf("Soft limit should not exceed hard limit: %+v", nofile)
+	}
+
+	// 管理者トークンなしは拒否される
+	rr = httptest.NewRecorder()
+	handler(rr, httptest.NewRequest("GET", "/debug/limits", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without token, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// route はルートテーブルの1エントリ
+// ルートごとの設定（タイムアウトなど）をハンドラーと一緒に登録する
+type route struct {
+	pattern string           // ServeMux のパターン
+	handler http.HandlerFunc // 認証などのルート固有ミドルウェア適用済みハンドラー
+	timeout time.Duration    // ハンドラータイムアウト（0 なら HANDLER_TIMEOUT を使用）
+	probe   bool             // プローブ用エンドポイント（コネクションに KEEPALIVE_IDLE を適用）
+	admin   bool             // 管理用リスナー（ADMIN_PORT）でも提供するエンドポイント
+	params  []string         // 受け付けるクエリパラメーター（STRICT_QUERY 有効時はそれ以外を 400 で拒否）
+
+	produces []string // 応答できるメディアタイプ（STRICT_ACCEPT 有効時は Accept と一致しなければ 406。空なら判定しない）
+
+	rateLimit int // RATE_LIMIT_WINDOW あたりのルート独自のリクエスト数の上限（0 なら全体の RATE_LIMIT。プローブにも適用）
+
+	streaming bool // SSE などの長時間接続（ハンドラータイムアウトを適用しない。ドレイン時は serverDrain で終了する）
+}
+
+// 各ルートが応答できるメディアタイプ
+var (
+	producesJSON    = []string{"application/json"}
+	producesText    = []string{"text/plain"}
+	producesHTML    = []string{"text/html"}
+	producesMetrics = []string{"application/json", "text/plain", "application/openmetrics-text"}
+	producesBinary  = []string{"application/octet-stream"}
+)
+
+// routeTable はルーターに登録するルートテーブル（差し替え可能。テスト用）
+var routeTable = routes
+
+// routes はアプリケーションのルートテーブルを返す
+func routes() []route {
+	return []route{
+		{pattern: "/", handler: rootHandler, produces: producesHTML},
+		// プローブのタイムアウトは短いため、応答が遅れた場合は早めに失敗させる
+		{pattern: "/health", handler: healthHandler, timeout: 2 * time.Second, probe: true, params: []string{"deep"}, produces: healthProduces()},
+		{pattern: "/ready", handler: readyHandler, timeout: 2 * time.Second, probe: true, params: []string{"deep"}, produces: producesJSON},
+		{pattern: "/startupz", handler: startupzHandler, timeout: 2 * time.Second, probe: true, produces: producesText},
+		{pattern: "/healthz", handler: healthzHandler, timeout: 2 * time.Second, probe: true, params: []string{"deep", "verbose"}, produces: producesText},
+		// メトリクス収集は /proc のサンプリング等で時間がかかる場合がある
+		{pattern: "/metrics", handler: metricsHandler, timeout: 10 * time.Second, probe: true, admin: true, params: []string{"format"}, produces: producesMetrics},
+
+		// デバッグ用エンドポイント（管理者認証 + カオス有効化の両方が必要）
+		// 変更系のためリトライによる重複実行を Idempotency-Key で防ぐ
+		{pattern: "/debug/alloc", handler: adminOnly(idempotent(chaosOnly(debugAllocHandler))), admin: true, params: []string{"mb"}, produces: producesJSON},
+		{pattern: "/debug/alloc/release", handler: adminOnly(idempotent(chaosOnly(debugReleaseHandler))), admin: true, produces: producesJSON},
+		// 帯域の負荷試験用に任意サイズの本文を返す（読み取り専用のため Idempotency-Key は不要）
+		{pattern: "/debug/payload", handler: adminOnly(chaosOnly(debugPayloadHandler)), admin: true, params: []string{"bytes"}, produces: producesBinary},
+
+		// 依存先のレイテンシ計測・ビルド情報・直近リクエスト（管理者認証のみ必要）
+		{pattern: "/debug/dependencies", handler: adminOnly(debugDependenciesHandler), admin: true, produces: producesJSON},
+		{pattern: "/debug/buildinfo", handler: adminOnly(debugBuildInfoHandler), admin: true, produces: producesJSON},
+		{pattern: "/debug/requests", handler: adminOnly(debugRequestsHandler), admin: true, produces: producesJSON},
+		{pattern: "/debug/limits", handler: adminOnly(debugLimitsHandler), admin: true, produces: producesJSON},
+		{pattern: "/debug/experiments", handler: adminOnly(debugExperimentsHandler), admin: true, produces: producesJSON},
+
+		// SLO 訓練用の合成エンドポイント（ENABLE_SYNTHETIC 有効時のみ）
+		{pattern: "/synthetic/500", handler: syntheticOnly(synthetic500Handler), produces: producesText},
+		{pattern: "/synthetic/slow", handler: syntheticOnly(syntheticSlowHandler), params: []string{"ms"}, produces: producesText},
+		{pattern: "/synthetic/flaky", handler: syntheticOnly(syntheticFlakyHandler), params: []string{"rate"}, produces: producesText},
+	}
+}
+
+// build は共通ミドルウェアを適用したハンドラーを構築する
+func (rt route) build() http.HandlerFunc {
+	timeout := rt.timeout
+	if timeout == 0 {
+		timeout = cfg().HandlerTimeout
+	}
+	handler := strictAcceptMiddleware(rt.produces, strictQueryMiddleware(rt.params, rt.handler))
+	// ルート独自のレート制限はルートごとに独立して数え、リスナーや再構築をまたいで共有する
+	limiter := routeLimiters.get(cfg(), rt.pattern, rt.rateLimit)
+	// kubelet のプローブは Host: <Pod IP>:<ポート> で届くため、プローブには Host ヘッダーの検証を適用しない
+	hostCheck := allowedHostsMiddleware
+	if rt.probe {
+		hostCheck = func(next http.HandlerFunc) http.HandlerFunc { return next }
+		handler = markProbeConn(handler)
+		if limiter != nil {
+			handler = rateLimitMiddleware(limiter, handler)
+		}
+	} else {
+		// プローブはウォームアップ期間中や全体のレート制限時も応答し、コンテナの再起動を招かないようにする
+		handler = warmupFilterMiddleware(rateLimitMiddleware(limiter, concurrencyMiddleware(handler)))
+	}
+	// ミドルウェアを適用してすべてのリクエストをログ出力
+	// panic の回復はアクセスログより内側に置き、500 応答もアクセスログに記録されるようにする
+	// http.TimeoutHandler は Flush に対応せず、タイムアウトでストリームを切るため、長時間接続には適用しない
+	if !rt.streaming {
+		handler = timeoutMiddleware(timeout, handler)
+	}
+	return requestIDMiddleware(canaryMiddleware(logMiddleware(recoveryMiddleware(hostCheck(
+		perIPConcurrencyMiddleware(bodyLimitMiddleware(handler)))))))
+}
+
+// newRouter はすべてのルートを登録したハンドラーを構築する
+// BASE_PATH 設定時はプレフィックス配下にルートをマウントし、プレフィックスを除去してから振り分ける
+func newRouter() http.Handler {
+	mux := http.NewServeMux()
+	for _, rt := range routeTable() {
+		mux.HandleFunc(rt.pattern, rt.build())
+	}
+	// 旧 URL 体系からのリダイレクト（REDIRECTS）もアクセスログ等の共通ミドルウェアを通す
+	for _, rd := range cfg().Redirects {
+		mux.HandleFunc(rd.from, route{pattern: rd.from, handler: redirectHandler(rd.to)}.build())
+	}
+	// 静的ファイル（ステータスダッシュボードなど）は STATIC_DIR 設定時のみ配信する
+	if c := cfg(); c.StaticDir != "" {
+		mux.HandleFunc(c.StaticPrefix, route{pattern: c.StaticPrefix, handler: staticHandler(c.StaticDir, c.StaticPrefix)}.build())
+	}
+	return mountBasePath(mux)
+}
+
+// newAdminRouter は管理用リスナー（ADMIN_PORT）のルーターを構築する
+// メトリクスとデバッグ用エンドポイントのみを提供する（公開リスナーからも引き続き利用可能）
+func newAdminRouter() http.Handler {
+	mux := http.NewServeMux()
+	for _, rt := range routeTable() {
+		if rt.admin {
+			mux.HandleFunc(rt.pattern, rt.build())
+		}
+	}
+	return mountBasePath(mux)
+}
+
+// mountBasePath は BASE_PATH 設定時に mux をプレフィックス配下にマウントする
+func mountBasePath(mux *http.ServeMux) http.Handler {
+	base := cfg().BasePath
+	if base == "" {
+		return mux
+	}
+
+	// "/app" へのアクセスは ServeMux が "/app/" へリダイレクトし、プレフィックス外は 404 になる
+	outer := http.NewServeMux()
+	outer.Handle(base+"/", http.StripPrefix(base, mux))
+	return outer
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestPerRouteTimeout はルートごとのタイムアウト設定のテスト
+// 各ルートが自身のタイムアウトを適用し、未指定ならデフォルトにフォールバックすることを保証
+func TestPerRouteTimeout(t *testing.T) {
+	withConfig(t, func(c *Config) { c.HandlerTimeout = 20 * time.Millisecond })
+
+	slow := func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(100 * time.Millisecond):
+			w.WriteHeader(http.StatusOK)
+		case <-r.Context().Done():
+		}
+	}
+
+	mux := http.NewServeMux()
+	for _, rt := range []route{
+		{pattern: "/short", handler: slow, timeout: 10 * time.Millisecond},
+		{pattern: "/long", handler: slow, timeout: time.Second},
+		{pattern: "/default", handler: slow},
+	} {
+		mux.HandleFunc(rt.pattern, rt.build())
+	}
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/short", http.StatusServiceUnavailable},
+		{"/long", http.StatusOK},
+		{"/default", http.StatusServiceUnavailable}, // HANDLER_TIMEOUT（20ms）を適用
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+		if rr.Code != tt.want {
+			t.Errorf("%s: got status %d want %d", tt.path, rr.Code, tt.want)
+		}
+	}
+}
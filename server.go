@@ -0,0 +1,363 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// サーバーライフサイクルイベント名
+// ログ解析でサーバーの起動〜停止を確実に追跡するため固定の名前で出力する
+const (
+	eventServerStarting      = "server.starting"
+	eventServerListening     = "server.listening"
+	eventServerNotReady      = "server.not_ready"
+	eventServerDraining      = "server.draining"
+	eventServerDrainProgress = "server.drain_progress"
+	eventServerStopped       = "server.stopped"
+)
+
+// newHTTPServer はタイムアウトを設定した HTTP サーバーを構築する
+// 本格的なSREワークフローではタイムアウト設定が重要
+func newHTTPServer(c *Config, addr string, handler http.Handler) *http.Server {
+	server := &http.Server{
+		Addr:         addr,
+		Handler:      handler,
+		ReadTimeout:  15 * time.Second, // リクエスト読み取りタイムアウト
+		WriteTimeout: 15 * time.Second, // レスポンス書き込みタイムアウト
+		IdleTimeout:  c.IdleTimeout,    // アイドル接続タイムアウト
+		// ヘッダーを少しずつ送り続けてコネクションを占有する slowloris 攻撃への対策
+		ReadHeaderTimeout: c.ReadHeaderTimeout,
+	}
+	// プローブ用コネクションには KEEPALIVE_IDLE を個別に適用
+	newKeepAliveReaper().install(server)
+	return server
+}
+
+// newAdminHTTPServer は管理用リスナー（ADMIN_PORT）の HTTP サーバーを構築する
+// タイムアウトは公開リスナーと共通だが、アイドル接続タイムアウトのみ ADMIN_IDLE_TIMEOUT を使用する
+func newAdminHTTPServer(c *Config, addr string, handler http.Handler) *http.Server {
+	server := newHTTPServer(c, addr, handler)
+	server.IdleTimeout = c.AdminIdleTimeout
+	return server
+}
+
+// serverClock はシャットダウン処理で使用する時刻関数（テストで差し替え可能）
+var serverClock = struct {
+	now   func() time.Time
+	sleep func(time.Duration)
+}{now: time.Now, sleep: time.Sleep}
+
+// drainProgressInterval はドレイン中に処理中リクエスト数をログ出力する間隔（テストで差し替え可能）
+var drainProgressInterval = time.Second
+
+// listen は addr で待ち受けるリスナーを作成する
+// dualStack 有効時にホストが空（":8080" など）であれば、OS のデュアルスタック既定動作に依存せず
+// IPv4（0.0.0.0）と IPv6（[::]、IPV6_V6ONLY）の2つのリスナーを明示的に作成する
+// ポート 0 の場合は IPv6 側も IPv4 側に割り当てられたポートで待ち受ける
+func listen(addr string, dualStack bool) ([]net.Listener, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || !dualStack || host != "" {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{ln}, nil
+	}
+
+	ln4, err := net.Listen("tcp4", net.JoinHostPort("0.0.0.0", port))
+	if err != nil {
+		return nil, err
+	}
+	if port == "0" {
+		port = strconv.Itoa(ln4.Addr().(*net.TCPAddr).Port)
+	}
+	ln6, err := net.Listen("tcp6", net.JoinHostPort("::", port))
+	if err != nil {
+		ln4.Close()
+		return nil, fmt.Errorf("listen on IPv6: %w", err)
+	}
+	return []net.Listener{ln4, ln6}, nil
+}
+
+// ライフサイクルイベントの listener フィールドの値（どのリスナーのイベントかを区別する）
+const (
+	listenerPublic = "public" // 公開リスナー（PORT）
+	listenerAdmin  = "admin"  // 管理用リスナー（ADMIN_PORT）
+)
+
+// namedServer はライフサイクルを共有して起動・停止するサーバーの1つ
+type namedServer struct {
+	listener string // ライフサイクルイベントの listener フィールド
+	server   *http.Server
+}
+
+// runningServer は待ち受け中のサーバーの状態
+type runningServer struct {
+	namedServer
+	lns      []net.Listener
+	inflight atomic.Int64 // ドレインの進捗を出力するための処理中リクエスト数
+}
+
+// runServer は公開リスナーのみで runServers を実行する
+func runServer(ctx context.Context, server *http.Server) error {
+	return runServers(ctx, namedServer{listener: listenerPublic, server: server})
+}
+
+// runServers はHTTPサーバー（公開・管理用リスナー）を起動し、ctx がキャンセルされるまでリクエストを処理する
+// キャンセル後はレディネスを落として SHUTDOWN_DELAY だけ待ち（LB からの登録解除を待つ）、
+// 全サーバーの処理中のリクエストを ShutdownTimeout まで待ってから停止する
+// ウォームアップ・レディネスの変更はサーバーの数によらず一度だけ行い、全サーバーのドレイン完了後に返る
+// いずれかのサーバーが異常停止した場合は残りのサーバーもドレインして停止し、最初のエラーを返す
+func runServers(ctx context.Context, servers ...namedServer) error {
+	for _, s := range servers {
+		logger.Info(eventServerStarting,
+			"listener", s.listener,
+			"addr", s.server.Addr,
+			"start_time", startTime.Format(time.RFC3339))
+	}
+
+	// 待ち受け開始前にウォームアップし、完了するまでプローブ・トラフィックを受け付けない
+	if cfg().EnableWarmup {
+		runWarmup()
+	}
+
+	// バインド失敗（ポート使用中・権限不足など）は再試行しても回復しないため即座に失敗させる
+	running := make([]*runningServer, 0, len(servers))
+	for _, s := range servers {
+		rs, err := listenServer(s)
+		if err != nil {
+			for _, r := range running {
+				for _, ln := range r.lns {
+					ln.Close()
+				}
+			}
+			logger.Error(eventServerStopped, "listener", s.listener, "error", err.Error())
+			return fmt.Errorf("%s listener: %w", s.listener, err)
+		}
+		running = append(running, rs)
+	}
+	if d := cfg().WarmupDuration; d > 0 {
+		defer startWarmupPhase(serverClock.now(), d)()
+	}
+
+	// 同じサーバーで全リスナーを処理し、Shutdown で一括して停止する
+	type serveResult struct {
+		rs  *runningServer
+		err error
+	}
+	// 受信されない結果（シャットダウン後の ErrServerClosed など）で送信側がブロックしないよう、
+	// バッファはリスナーの総数分確保する（DUAL_STACK ではサーバーごとに2つ）
+	listeners := 0
+	for _, rs := range running {
+		listeners += len(rs.lns)
+	}
+	serveErr := make(chan serveResult, listeners)
+	var serving sync.WaitGroup
+	defer serving.Wait() // すべての Serve ゴルーチンの終了を待ってから返る
+	for _, rs := range running {
+		for _, ln := range rs.lns {
+			serving.Add(1)
+			go func(rs *runningServer, ln net.Listener) {
+				defer serving.Done()
+				serveErr <- serveResult{rs, rs.server.Serve(ln)}
+			}(rs, ln)
+		}
+	}
+
+	var firstErr error
+	select {
+	case res := <-serveErr:
+		// シャットダウン要求前に Serve が終了した場合は異常停止（残りのリスナーも閉じる）
+		res.rs.server.Close()
+		logger.Error(eventServerStopped, "listener", res.rs.listener, "error", res.err.Error())
+		firstErr = fmt.Errorf("%s listener: %w", res.rs.listener, res.err)
+		running = slices.DeleteFunc(running, func(rs *runningServer) bool { return rs == res.rs })
+		if len(running) == 0 {
+			return firstErr
+		}
+	case <-ctx.Done():
+	}
+
+	// レディネスを落とし、LB が新規リクエストの振り分けを止めるまで待つ
+	// この間も既存・新規のリクエストは通常どおり処理する
+	shutdownStart := serverClock.now()
+	delay := cfg().ShutdownDelay
+	setReady(false)
+	logger.Info(eventServerNotReady, "delay", delay.String())
+	if delay > 0 {
+		serverClock.sleep(delay)
+	}
+
+	// 長時間接続（ロングポーリング・SSE）のハンドラーにクライアントへの再接続の指示と終了を促す
+	serverDrain.notify()
+	errs := make([]error, len(running))
+	var wg sync.WaitGroup
+	for i, rs := range running {
+		wg.Add(1)
+		go func(i int, rs *runningServer) {
+			defer wg.Done()
+			errs[i] = drainServer(rs, shutdownStart)
+		}(i, rs)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	return errors.Join(errs...)
+}
+
+// listenServer はサーバーのリスナーを作成し、処理中リクエスト数を数えるハンドラーを設定する
+func listenServer(s namedServer) (*runningServer, error) {
+	lns, err := listen(s.server.Addr, cfg().DualStack)
+	if err != nil {
+		return nil, err
+	}
+	rs := &runningServer{namedServer: s, lns: lns}
+	for i, ln := range lns {
+		logger.Info(eventServerListening,
+			"listener", s.listener,
+			"addr", ln.Addr().String(),
+			"tls", s.server.TLSConfig != nil)
+		ln = newRetryListener(ln, cfg().AcceptMaxRetries)
+		if max := cfg().MaxConnections; max > 0 {
+			ln = newLimitListener(ln, max)
+		}
+		if s.server.TLSConfig != nil {
+			ln = tls.NewListener(ln, s.server.TLSConfig)
+		}
+		lns[i] = ln
+	}
+
+	handler := s.server.Handler
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+	s.server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rs.inflight.Add(1)
+		defer rs.inflight.Add(-1)
+		handler.ServeHTTP(w, r)
+	})
+	return rs, nil
+}
+
+// drainServer は処理中のリクエストを ShutdownTimeout まで待ってからサーバーを停止する
+func drainServer(rs *runningServer, shutdownStart time.Time) error {
+	timeout := cfg().ShutdownTimeout
+	drainStart := serverClock.now()
+	logger.Info(eventServerDraining,
+		"listener", rs.listener,
+		"timeout", timeout.String(),
+		"since_not_ready", drainStart.Sub(shutdownStart).String())
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// ドレイン完了（または ShutdownTimeout）まで処理中リクエスト数を定期的に出力
+	stopProgress := make(chan struct{})
+	progressDone := make(chan struct{})
+	go func() {
+		defer close(progressDone)
+		ticker := time.NewTicker(drainProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopProgress:
+				return
+			case <-ticker.C:
+				logger.Info(eventServerDrainProgress,
+					"listener", rs.listener,
+					"in_flight", rs.inflight.Load(),
+					"elapsed", serverClock.now().Sub(drainStart).String())
+			}
+		}
+	}()
+
+	err := rs.server.Shutdown(shutdownCtx)
+	close(stopProgress)
+	<-progressDone
+	if err != nil {
+		logger.Error(eventServerStopped,
+			"listener", rs.listener,
+			"drain_duration", serverClock.now().Sub(drainStart).String(),
+			"error", err.Error())
+		return fmt.Errorf("%s listener: %w", rs.listener, err)
+	}
+
+	logger.Info(eventServerStopped,
+		"listener", rs.listener,
+		"drain_duration", serverClock.now().Sub(drainStart).String())
+	return nil
+}
+
+// acceptRetryMaxBackoff は accept 再試行間隔の上限
+const acceptRetryMaxBackoff = time.Second
+
+// retryListener は一時的な accept エラーを有限回再試行するリスナー
+// ファイルディスクリプタ枯渇などの一時的な障害では再試行し、
+// 回復しない場合は非一時的なエラーを返してサーバーを停止させる
+type retryListener struct {
+	net.Listener
+	maxRetries int                 // 連続して再試行する最大回数
+	backoff    time.Duration       // 初回の再試行間隔（以降は倍々に増加）
+	sleep      func(time.Duration) // 差し替え可能な待機関数（テスト用）
+}
+
+// newRetryListener は ln を一時的エラー再試行付きのリスナーでラップする
+func newRetryListener(ln net.Listener, maxRetries int) *retryListener {
+	return &retryListener{
+		Listener:   ln,
+		maxRetries: maxRetries,
+		backoff:    5 * time.Millisecond,
+		sleep:      time.Sleep,
+	}
+}
+
+// Accept は一時的なエラーの場合のみ指数バックオフで再試行する
+func (l *retryListener) Accept() (net.Conn, error) {
+	delay := l.backoff
+	for attempt := 1; ; attempt++ {
+		conn, err := l.Listener.Accept()
+		if err == nil || !isTransientAcceptError(err) {
+			return conn, err
+		}
+		if attempt > l.maxRetries {
+			// http.Server は net.Error の一時的エラーを無期限に再試行するため、
+			// 上限到達時はラップして非一時的なエラーとして返す
+			return nil, fmt.Errorf("accept failed after %d retries: %w", l.maxRetries, err)
+		}
+
+		logger.Warn("server.accept_retry",
+			"attempt", attempt,
+			"max_retries", l.maxRetries,
+			"backoff", delay.String(),
+			"error", err.Error())
+		l.sleep(delay)
+		if delay *= 2; delay > acceptRetryMaxBackoff {
+			delay = acceptRetryMaxBackoff
+		}
+	}
+}
+
+// isTransientAcceptError は accept エラーが一時的（再試行で回復し得る）かを判定する
+func isTransientAcceptError(err error) bool {
+	// リソース枯渇・接続中断は時間経過で回復し得る
+	for _, errno := range []syscall.Errno{
+		syscall.EMFILE, syscall.ENFILE, syscall.ENOBUFS, syscall.ENOMEM, syscall.ECONNABORTED,
+	} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
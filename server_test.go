@@ -0,0 +1,686 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// syncBuffer は並行書き込みに安全なログ取得用バッファ
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// entries は出力された構造化ログを1行ずつデコードして返す
+func (b *syncBuffer) entries(t *testing.T) []map[string]any {
+	t.Helper()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var out []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var e map[string]any
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("Log line is not valid JSON: %q", line)
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+// captureLogs はテスト中の構造化ログをバッファに差し替える
+func captureLogs(t *testing.T) *syncBuffer {
+	t.Helper()
+	buf := &syncBuffer{}
+	orig := logger
+	logger = slog.New(slog.NewJSONHandler(buf, nil))
+	t.Cleanup(func() { logger = orig })
+	return buf
+}
+
+// TestServerLifecycleEvents はサーバー起動〜停止のライフサイクルログのテスト
+// ログ解析で起動・停止を追跡できるよう、決まった順序でイベントが出力されることを保証
+func TestServerLifecycleEvents(t *testing.T) {
+	logs := captureLogs(t)
+	t.Cleanup(func() { setReady(true) })
+
+	server := &http.Server{Addr: "127.0.0.1:0", Handler: http.NotFoundHandler()}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error, 1)
+	go func() { done <- runServer(ctx, server) }()
+
+	// listening イベントが出力されるまで待ってから停止を要求
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		entries := logs.entries(t)
+		if len(entries) >= 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Server did not start listening in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("runServer returned error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server did not stop in time")
+	}
+
+	want := []string{eventServerStarting, eventServerListening, eventServerNotReady, eventServerDraining, eventServerStopped}
+	entries := logs.entries(t)
+	if len(entries) != len(want) {
+		t.Fatalf("Expected %d lifecycle events, got %d: %v", len(want), len(entries), entries)
+	}
+	for i, e := range entries {
+		if e["msg"] != want[i] {
+			t.Errorf("Event %d: got %v want %s", i, e["msg"], want[i])
+		}
+		// すべてのイベントにタイムスタンプが付与されていること
+		if _, ok := e["time"]; !ok {
+			t.Errorf("Event %s has no timestamp", want[i])
+		}
+	}
+
+	// listening イベントには実際の待ち受けアドレスが含まれること
+	if addr, _ := entries[1]["addr"].(string); !strings.HasPrefix(addr, "127.0.0.1:") || addr == "127.0.0.1:0" {
+		t.Errorf("Expected resolved listen address, got %q", addr)
+	}
+}
+
+// TestRunServersSharedLifecycle は公開・管理用リスナーのライフサイクル共有のテスト
+// ウォームアップ・レディネスの変更は一度だけ行われ、各イベントに listener が付き、
+// 両方のサーバーのドレインが完了するまで返らないことを保証
+func TestRunServersSharedLifecycle(t *testing.T) {
+	logs := captureLogs(t)
+	t.Cleanup(func() { setReady(true) })
+	withConfig(t, func(c *Config) {
+		c.EnableWarmup = true
+		c.ShutdownDelay = 0
+	})
+
+	started, release := make(chan struct{}), make(chan struct{})
+	public := &http.Server{Addr: "127.0.0.1:0", Handler: http.NotFoundHandler()}
+	admin := &http.Server{Addr: "127.0.0.1:0", Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- runServers(ctx,
+			namedServer{listener: listenerPublic, server: public},
+			namedServer{listener: listenerAdmin, server: admin})
+	}()
+
+	var adminAddr string
+	deadline := time.Now().Add(2 * time.Second)
+	for adminAddr == "" {
+		for _, e := range logs.entries(t) {
+			if e["msg"] == eventServerListening && e["listener"] == listenerAdmin {
+				adminAddr = e["addr"].(string)
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Admin server did not start listening in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	go http.Get("http://" + adminAddr + "/")
+	<-started
+	cancel()
+
+	// 管理用リスナーの処理中リクエストが終わるまでは返らない
+	select {
+	case err := <-done:
+		t.Fatalf("runServers returned before the admin server drained: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("runServers returned error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Servers did not stop in time")
+	}
+
+	counts := make(map[string]int)
+	for _, e := range logs.entries(t) {
+		msg := e["msg"].(string)
+		counts[msg]++
+		switch msg {
+		case eventServerStarting, eventServerListening, eventServerDraining, eventServerStopped:
+			if l := e["listener"]; l != listenerPublic && l != listenerAdmin {
+				t.Errorf("Event %s has no listener field: %v", msg, e)
+			}
+		}
+	}
+	for msg, want := range map[string]int{
+		eventServerWarmup:    1,
+		eventServerNotReady:  1,
+		eventServerStarting:  2,
+		eventServerListening: 2,
+		eventServerDraining:  2,
+		eventServerStopped:   2,
+	} {
+		if counts[msg] != want {
+			t.Errorf("Expected %d %s events, got %d", want, msg, counts[msg])
+		}
+	}
+}
+
+// flakyListener は指定回数だけ一時的エラーを返した後に接続を返すテスト用リスナー
+type flakyListener struct {
+	net.Listener
+	failures int
+	err      error
+	accepts  int
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	l.accepts++
+	if l.accepts <= l.failures {
+		return nil, l.err
+	}
+	server, client := net.Pipe()
+	client.Close()
+	return server, nil
+}
+
+func (l *flakyListener) Close() error   { return nil }
+func (l *flakyListener) Addr() net.Addr { return &net.TCPAddr{} }
+
+// TestRetryListenerTransientError は一時的な accept エラーの再試行テスト
+// 一時的エラーは再試行され、上限を超えると非一時的エラーとして返ることを保証
+func TestRetryListenerTransientError(t *testing.T) {
+	captureLogs(t)
+	transient := &net.OpError{Op: "accept", Net: "tcp", Err: os.NewSyscallError("accept", syscall.EMFILE)}
+
+	// 上限内の一時的エラーは再試行して接続を受け付ける
+	fl := &flakyListener{failures: 2, err: transient}
+	var sleeps []time.Duration
+	ln := newRetryListener(fl, 3)
+	ln.sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("Expected accept to succeed after retries, got %v", err)
+	}
+	conn.Close()
+	if fl.accepts != 3 {
+		t.Errorf("Expected 3 accept attempts, got %d", fl.accepts)
+	}
+	if len(sleeps) != 2 || sleeps[1] != 2*sleeps[0] {
+		t.Errorf("Expected exponential backoff between 2 retries, got %v", sleeps)
+	}
+
+	// 上限を超えた場合は http.Server が再試行しない非一時的エラーを返す
+	fl = &flakyListener{failures: 10, err: transient}
+	ln = newRetryListener(fl, 3)
+	ln.sleep = func(time.Duration) {}
+
+	_, err = ln.Accept()
+	if err == nil {
+		t.Fatal("Expected error after exhausting retries")
+	}
+	if fl.accepts != 4 {
+		t.Errorf("Expected 4 accept attempts (1 + 3 retries), got %d", fl.accepts)
+	}
+	if _, ok := err.(net.Error); ok {
+		t.Errorf("Exhausted error should not be a net.Error: %v", err)
+	}
+
+	// 非一時的エラーは再試行しない
+	fl = &flakyListener{failures: 1, err: net.ErrClosed}
+	ln = newRetryListener(fl, 3)
+	if _, err := ln.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Expected ErrClosed without retry, got %v", err)
+	}
+	if fl.accepts != 1 {
+		t.Errorf("Non-transient error should not be retried, got %d attempts", fl.accepts)
+	}
+}
+
+// TestShutdownReadinessDelay はシャットダウン時のフェーズ順序と待機時間のテスト
+// レディネス停止 → SHUTDOWN_DELAY 待機 → ドレイン → 停止 の順に進み、
+// 待機中はレディネスプローブが 503 を返すことを差し替えた時計で保証
+func TestShutdownReadinessDelay(t *testing.T) {
+	logs := captureLogs(t)
+	withConfig(t, func(c *Config) { c.ShutdownDelay = 7 * time.Second })
+	t.Cleanup(func() { setReady(true) })
+
+	// 待機すると時計が進む偽の時計
+	now := time.Unix(1700000000, 0)
+	var clockMu sync.Mutex
+	var slept []time.Duration
+	var readyDuringDelay int
+	orig := serverClock
+	serverClock.now = func() time.Time {
+		clockMu.Lock()
+		defer clockMu.Unlock()
+		return now
+	}
+	serverClock.sleep = func(d time.Duration) {
+		rr := httptest.NewRecorder()
+		readyHandler(rr, httptest.NewRequest("GET", "/ready", nil))
+		clockMu.Lock()
+		defer clockMu.Unlock()
+		readyDuringDelay = rr.Code
+		slept = append(slept, d)
+		now = now.Add(d)
+	}
+	t.Cleanup(func() { serverClock = orig })
+
+	server := &http.Server{Addr: "127.0.0.1:0", Handler: http.NotFoundHandler()}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- runServer(ctx, server) }()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(logs.entries(t)) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("Server did not start listening in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("runServer returned error: %v", err)
+	}
+
+	var msgs []string
+	var draining map[string]any
+	for _, e := range logs.entries(t) {
+		msgs = append(msgs, e["msg"].(string))
+		if e["msg"] == eventServerDraining {
+			draining = e
+		}
+	}
+	want := []string{eventServerStarting, eventServerListening, eventServerNotReady, eventServerDraining, eventServerStopped}
+	if strings.Join(msgs, ",") != strings.Join(want, ",") {
+		t.Fatalf("Unexpected phase order: got %v want %v", msgs, want)
+	}
+
+	if len(slept) != 1 || slept[0] != 7*time.Second {
+		t.Errorf("Expected a single 7s readiness delay, got %v", slept)
+	}
+	if readyDuringDelay != http.StatusServiceUnavailable {
+		t.Errorf("Readiness should fail during delay, got %d", readyDuringDelay)
+	}
+	if got := draining["since_not_ready"]; got != "7s" {
+		t.Errorf("Drain should start 7s after readiness off, got %v", got)
+	}
+}
+
+// TestShutdownDelayValidation は SHUTDOWN_DELAY の検証テスト
+func TestShutdownDelayValidation(t *testing.T) {
+	for _, v := range []string{"abc", "-1s"} {
+		t.Setenv("SHUTDOWN_DELAY", v)
+		if _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), "SHUTDOWN_DELAY") {
+			t.Errorf("SHUTDOWN_DELAY=%q: expected validation error, got %v", v, err)
+		}
+	}
+
+	t.Setenv("SHUTDOWN_DELAY", "15s")
+	if c := mustLoadConfig(t); c.ShutdownDelay != 15*time.Second {
+		t.Errorf("Expected 15s delay, got %v", c.ShutdownDelay)
+	}
+}
+
+// TestDrainProgressLogs はドレイン中の進捗ログのテスト
+// 低速な処理中リクエストがある間は処理中件数が定期的に出力され、完了後にドレインが終わることを保証
+func TestDrainProgressLogs(t *testing.T) {
+	logs := captureLogs(t)
+	t.Cleanup(func() { setReady(true) })
+	orig := drainProgressInterval
+	drainProgressInterval = 10 * time.Millisecond
+	t.Cleanup(func() { drainProgressInterval = orig })
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	})
+
+	server := &http.Server{Addr: "127.0.0.1:0", Handler: handler}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- runServer(ctx, server) }()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(logs.entries(t)) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("Server did not start listening in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	addr := logs.entries(t)[1]["addr"].(string)
+
+	// 低速リクエストを処理中にしてからシャットダウンを開始
+	respErr := make(chan error, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr + "/")
+		if err == nil {
+			resp.Body.Close()
+		}
+		respErr <- err
+	}()
+	<-started
+	cancel()
+
+	// 処理中1件の進捗ログが複数回出力されるまで待つ
+	progress := func() (n int) {
+		for _, e := range logs.entries(t) {
+			if e["msg"] == eventServerDrainProgress && e["in_flight"] == float64(1) {
+				n++
+			}
+		}
+		return n
+	}
+	deadline = time.Now().Add(2 * time.Second)
+	for progress() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected periodic drain progress logs while request is in flight")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// 処理中リクエストが完了するとドレインが終わる
+	close(release)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("runServer returned error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Drain did not complete after in-flight request finished")
+	}
+	if err := <-respErr; err != nil {
+		t.Errorf("In-flight request should complete during drain: %v", err)
+	}
+
+	entries := logs.entries(t)
+	if last := entries[len(entries)-1]; last["msg"] != eventServerStopped {
+		t.Errorf("Expected %s as final event, got %v", eventServerStopped, last["msg"])
+	}
+}
+
+// TestReadHeaderTimeout は slowloris 対策のヘッダー読み取りタイムアウトのテスト
+// ヘッダーを少しずつ送り続けるコネクションが READ_HEADER_TIMEOUT で切断されることを保証
+func TestReadHeaderTimeout(t *testing.T) {
+	withConfig(t, func(c *Config) { c.ReadHeaderTimeout = 100 * time.Millisecond })
+
+	srv := httptest.NewUnstartedServer(nil)
+	srv.Config = newHTTPServer(cfg(), "", http.NotFoundHandler())
+	srv.Start()
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	// ヘッダーを完了させずに少しずつ送る
+	start := time.Now()
+	closed := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(io.Discard, conn)
+		closed <- err
+	}()
+	fmt.Fprint(conn, "GET / HTTP/1.1\r\nHost: test\r\n")
+	for i := 0; i < 20; i++ {
+		select {
+		case <-closed:
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("Connection closed too late: %v", elapsed)
+			}
+			return
+		case <-time.After(50 * time.Millisecond):
+			fmt.Fprintf(conn, "X-Slow-%d: x\r\n", i)
+		}
+	}
+	t.Fatal("Connection trickling headers was not dropped")
+}
+
+// TestListenerIdleTimeout はリスナーごとのアイドル接続タイムアウトのテスト
+// 公開リスナーは IDLE_TIMEOUT、管理用リスナーは ADMIN_IDLE_TIMEOUT を使用することを保証
+func TestListenerIdleTimeout(t *testing.T) {
+	t.Setenv("IDLE_TIMEOUT", "30s")
+	t.Setenv("ADMIN_PORT", "9090")
+	t.Setenv("ADMIN_IDLE_TIMEOUT", "1h")
+	c := mustLoadConfig(t)
+
+	if s := newHTTPServer(&c, ":8080", http.NotFoundHandler()); s.IdleTimeout != 30*time.Second {
+		t.Errorf("Public listener: expected 30s idle timeout, got %v", s.IdleTimeout)
+	}
+	admin := newAdminHTTPServer(&c, ":"+c.AdminPort, http.NotFoundHandler())
+	if admin.IdleTimeout != time.Hour {
+		t.Errorf("Admin listener: expected 1h idle timeout, got %v", admin.IdleTimeout)
+	}
+	if admin.ReadHeaderTimeout != c.ReadHeaderTimeout {
+		t.Errorf("Admin listener should share other timeouts, got ReadHeaderTimeout %v", admin.ReadHeaderTimeout)
+	}
+
+	t.Setenv("ADMIN_PORT", "admin")
+	if _, err := loadConfig(); err == nil {
+		t.Error("Expected error for non-numeric ADMIN_PORT")
+	}
+}
+
+// TestAdminRouter は管理用リスナーのルーターのテスト
+// メトリクス・デバッグ用エンドポイントのみを提供し、ルートページは提供しないことを保証
+func TestAdminRouter(t *testing.T) {
+	withConfig(t, func(c *Config) {
+		c.AdminToken = "secret"
+		c.EnableSynthetic = true
+	})
+	router := newAdminRouter()
+	for path, want := range map[string]int{
+		"/metrics":         http.StatusOK,
+		"/debug/buildinfo": http.StatusOK,
+		"/":                http.StatusNotFound,
+		"/synthetic/500":   http.StatusNotFound,
+		"/health":          http.StatusNotFound,
+	} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != want {
+			t.Errorf("%s: got %d want %d", path, rr.Code, want)
+		}
+	}
+}
+
+// TestHealthShuttingDown はシャットダウン開始後のヘルス・レディネスの状態のテスト
+// ドレイン中は /health が 200 のまま shutting_down を返し、/ready は 503 になることを保証
+func TestHealthShuttingDown(t *testing.T) {
+	logs := captureLogs(t)
+	withConfig(t, func(c *Config) { c.ShutdownDelay = time.Second })
+	t.Cleanup(func() { setReady(true) })
+
+	probe := func(h http.HandlerFunc, path string) (int, string) {
+		rr := httptest.NewRecorder()
+		h(rr, httptest.NewRequest("GET", path, nil))
+		var resp HealthResponse
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr.Code, resp.Status
+	}
+	if code, status := probe(healthHandler, "/health"); code != http.StatusOK || status != healthStatusHealthy {
+		t.Fatalf("Before shutdown: got %d %s", code, status)
+	}
+
+	// SHUTDOWN_DELAY の待機中（レディネスを落とした後）に状態を確認する
+	var healthCode, readyCode int
+	var healthStatus, readyStatus string
+	orig := serverClock
+	serverClock.sleep = func(time.Duration) {
+		healthCode, healthStatus = probe(healthHandler, "/health")
+		readyCode, readyStatus = probe(readyHandler, "/ready")
+	}
+	t.Cleanup(func() { serverClock = orig })
+
+	server := &http.Server{Addr: "127.0.0.1:0", Handler: http.NotFoundHandler()}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- runServer(ctx, server) }()
+	deadline := time.Now().Add(2 * time.Second)
+	for len(logs.entries(t)) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("Server did not start listening in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("runServer returned error: %v", err)
+	}
+
+	if healthCode != http.StatusOK || healthStatus != healthStatusShuttingDown {
+		t.Errorf("Liveness during drain: got %d %s, want 200 %s", healthCode, healthStatus, healthStatusShuttingDown)
+	}
+	if readyCode != http.StatusServiceUnavailable || readyStatus != healthStatusShuttingDown {
+		t.Errorf("Readiness during drain: got %d %s, want 503 %s", readyCode, readyStatus, healthStatusShuttingDown)
+	}
+}
+
+// TestDualStackListeners は DUAL_STACK のテスト
+// IPv4・IPv6 のループバックの両方から /health に到達でき、停止時は両方のリスナーが閉じられることを保証
+func TestDualStackListeners(t *testing.T) {
+	if ln, err := net.Listen("tcp6", "[::1]:0"); err != nil {
+		t.Skipf("IPv6 loopback not available: %v", err)
+	} else {
+		ln.Close()
+	}
+	logs := captureLogs(t)
+	t.Cleanup(func() { setReady(true) })
+	withConfig(t, func(c *Config) { c.DualStack = true })
+
+	server := &http.Server{Addr: ":0", Handler: newRouter()}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- runServer(ctx, server) }()
+
+	var addrs []string
+	deadline := time.Now().Add(2 * time.Second)
+	for len(addrs) < 2 {
+		addrs = nil
+		for _, e := range logs.entries(t) {
+			if e["msg"] == eventServerListening {
+				addrs = append(addrs, e["addr"].(string))
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected two listeners, got %v", addrs)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	_, port, _ := net.SplitHostPort(addrs[0])
+	for _, host := range []string{"127.0.0.1", "::1"} {
+		url := "http://" + net.JoinHostPort(host, port) + "/health"
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Errorf("GET %s: %v", url, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("GET %s: expected 200, got %d", url, resp.StatusCode)
+		}
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("runServer returned error: %v", err)
+	}
+	for _, host := range []string{"127.0.0.1", "::1"} {
+		if conn, err := net.Dial("tcp", net.JoinHostPort(host, port)); err == nil {
+			conn.Close()
+			t.Errorf("%s: listener should be closed after shutdown", host)
+		}
+	}
+}
+
+// TestRunServersDualStackServeGoroutines は DUAL_STACK で複数サーバーを起動した場合のテスト
+// サーバーごとに2つあるリスナーのすべての Serve ゴルーチンが停止時に終了し、runServers が返ることを保証
+func TestRunServersDualStackServeGoroutines(t *testing.T) {
+	if ln, err := net.Listen("tcp6", "[::1]:0"); err != nil {
+		t.Skipf("IPv6 loopback not available: %v", err)
+	} else {
+		ln.Close()
+	}
+	logs := captureLogs(t)
+	t.Cleanup(func() { setReady(true) })
+	withConfig(t, func(c *Config) { c.DualStack = true })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- runServers(ctx,
+			namedServer{listener: listenerPublic, server: &http.Server{Addr: ":0", Handler: http.NotFoundHandler()}},
+			namedServer{listener: listenerAdmin, server: &http.Server{Addr: ":0", Handler: http.NotFoundHandler()}})
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		n := 0
+		for _, e := range logs.entries(t) {
+			if e["msg"] == eventServerListening {
+				n++
+			}
+		}
+		if n == 4 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected 4 listeners, got %d", n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+
+	// runServers はすべての Serve ゴルーチンの終了を待つため、送信がブロックすると返らない
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("runServers returned error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("runServers did not return; a Serve goroutine is blocked")
+	}
+}
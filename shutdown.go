@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// シャットダウンの原因（context.Cause で取得する）
+var (
+	errShutdownSignal   = errors.New("received shutdown signal")
+	errShutdownWatchdog = errors.New("dependency checks failed repeatedly")
+)
+
+// シャットダウンの原因ごとのプロセスの終了コード
+// オーケストレーターやログ基盤で、通常の停止と異常による停止を区別できるようにする
+const (
+	exitCodeClean    = 0 // SIGTERM / SIGINT による通常の停止
+	exitCodeError    = 1 // サーバーの異常停止・ドレインの失敗
+	exitCodeWatchdog = 3 // ウォッチドッグ（WATCHDOG_FAILURES）による停止
+)
+
+// eventProcessExit はプロセス終了時のログのイベント名
+const eventProcessExit = "process.exit"
+
+// exitFunc はプロセスを終了する関数（テストで差し替え可能）
+var exitFunc = os.Exit
+
+// shutdownExitCode はシャットダウンの原因に対応する終了コードを返す
+func shutdownExitCode(cause error) int {
+	switch {
+	case cause == nil, errors.Is(cause, errShutdownSignal):
+		return exitCodeClean
+	case errors.Is(cause, errShutdownWatchdog):
+		return exitCodeWatchdog
+	default:
+		return exitCodeError
+	}
+}
+
+// exitAfterShutdown はシャットダウンの原因に応じた終了コードでプロセスを終了する
+// サーバーのエラー（serveErr）はシグナルによる停止より優先するが、ウォッチドッグによる停止は
+// ドレインに失敗した場合もウォッチドッグの終了コードとする
+// exitFunc（os.Exit）は defer や他のゴルーチンの完了を待たないため、全リスナーのドレイン（runServers）と
+// バックグラウンド処理の終了を待ってから呼ぶこと
+func exitAfterShutdown(ctx context.Context, serveErr error) {
+	cause := context.Cause(ctx)
+	if serveErr != nil && !errors.Is(cause, errShutdownWatchdog) {
+		cause = serveErr
+	}
+	code := shutdownExitCode(cause)
+	attrs := []any{"code", code}
+	if cause != nil {
+		attrs = append(attrs, "cause", cause.Error())
+	}
+	logger.Info(eventProcessExit, attrs...)
+	exitFunc(code)
+}
+
+// notifyShutdownSignals は SIGTERM（Cloud Run のインスタンス停止通知）/ SIGINT を受信したら
+// errShutdownSignal を原因として shutdown を呼ぶ。2回目のシグナルは既定の動作（即時終了）に戻す
+// 返り値の関数でシグナルの監視を停止する
+func notifyShutdownSignals(shutdown context.CancelCauseFunc) (stop func()) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ch:
+			signal.Stop(ch)
+			shutdown(errShutdownSignal)
+		case <-done:
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+	}
+}
+
+// watchdog は依存先チェックが連続して失敗した場合にプロセスを停止させる
+// 再起動で回復し得る致命的な状態（接続プールの破損など）から、オーケストレーターの再起動で自動復旧させる
+type watchdog struct {
+	max      int                     // 停止させる連続失敗回数（0 以下なら無効）
+	trip     context.CancelCauseFunc // 停止を要求する関数
+	failures int                     // 現在の連続失敗回数（バックグラウンドチェックのゴルーチンのみが更新する）
+}
+
+// observe はバックグラウンドチェック1回分の結果を記録し、連続失敗回数が上限に達したら停止を要求する
+func (w *watchdog) observe(healthy bool) {
+	if w == nil || w.max <= 0 {
+		return
+	}
+	if healthy {
+		w.failures = 0
+		return
+	}
+	if w.failures++; w.failures == w.max {
+		w.trip(errShutdownWatchdog)
+	}
+}
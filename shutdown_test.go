@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestShutdownExitCode はシャットダウンの原因ごとの終了コードのテスト
+// シグナル・ウォッチドッグ・エラーによる停止がそれぞれ異なる終了コードになることを保証
+func TestShutdownExitCode(t *testing.T) {
+	captureLogs(t)
+	var code int
+	orig := exitFunc
+	exitFunc = func(c int) { code = c }
+	t.Cleanup(func() { exitFunc = orig })
+
+	serveErr := errors.New("accept failed")
+	tests := []struct {
+		name     string
+		cause    error
+		serveErr error
+		want     int
+	}{
+		{"signal", errShutdownSignal, nil, exitCodeClean},
+		{"watchdog", errShutdownWatchdog, nil, exitCodeWatchdog},
+		{"watchdog with drain failure", errShutdownWatchdog, context.DeadlineExceeded, exitCodeWatchdog},
+		{"server error", nil, serveErr, exitCodeError},
+		{"drain failure after signal", errShutdownSignal, context.DeadlineExceeded, exitCodeError},
+		{"admin server error", errors.Join(errors.New("admin server failed"), serveErr), nil, exitCodeError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancelCause(context.Background())
+			defer cancel(nil)
+			if tt.cause != nil {
+				cancel(tt.cause)
+			}
+			code = -1
+			exitAfterShutdown(ctx, tt.serveErr)
+			if code != tt.want {
+				t.Errorf("Expected exit code %d, got %d", tt.want, code)
+			}
+		})
+	}
+}
+
+// TestShutdownSignal は SIGTERM 受信時にシグナルを原因としてシャットダウンすることのテスト
+func TestShutdownSignal(t *testing.T) {
+	ctx, shutdown := context.WithCancelCause(context.Background())
+	defer shutdown(nil)
+	stop := notifyShutdownSignals(shutdown)
+	defer stop()
+
+	proc, _ := os.FindProcess(os.Getpid())
+	if err := proc.Signal(syscall.SIGTERM); err != nil {
+		t.Skipf("Cannot send SIGTERM on this platform: %v", err)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected shutdown on SIGTERM")
+	}
+	if cause := context.Cause(ctx); shutdownExitCode(cause) != exitCodeClean {
+		t.Errorf("Signal shutdown should exit cleanly, cause: %v", cause)
+	}
+}
+
+// TestWatchdog はウォッチドッグのテスト
+// unhealthy が WATCHDOG_FAILURES 回連続した場合のみ停止を要求することを保証
+func TestWatchdog(t *testing.T) {
+	ctx, trip := context.WithCancelCause(context.Background())
+	defer trip(nil)
+	wd := &watchdog{max: 3, trip: trip}
+
+	// 途中で回復すると連続失敗回数はリセットされる
+	for _, healthy := range []bool{false, false, true, false, false} {
+		wd.observe(healthy)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("Watchdog should not trip without consecutive failures")
+	}
+	wd.observe(false)
+	if cause := context.Cause(ctx); !errors.Is(cause, errShutdownWatchdog) {
+		t.Errorf("Expected watchdog shutdown, got %v", cause)
+	}
+
+	// nil・無効なウォッチドッグは何もしない
+	var none *watchdog
+	none.observe(false)
+	(&watchdog{}).observe(false)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// eventServerStartupComplete は起動処理の完了（/startupz が 200 になった）を記録するログのイベント名
+const eventServerStartupComplete = "server.startup_complete"
+
+// startupComplete は起動処理が完了したか
+// liveness（/health）とは独立しており、一度完了した後は 503 に戻らない
+var startupComplete atomic.Bool
+
+// runStartup は起動処理（初回の依存先チェック）を実行し、完了したら /startupz を 200 にする
+// 初回のチェックは CHECK_CACHE_TTLS のキャッシュを埋め、失敗したものをログ出力する
+// （依存先の失敗で起動を止めることはしない。依存先の状態は /ready?deep=true で判定する）
+// 設定の読み込み・ウォームアップ（ENABLE_WARMUP）は待ち受け開始前に完了している
+func runStartup(ctx context.Context) {
+	results, _ := healthChecks.Run(ctx)
+	if ctx.Err() != nil {
+		return
+	}
+	for _, r := range results {
+		if r.Status != checkStatusPass {
+			logger.Warn(eventHealthCheckFailed,
+				"check", r.Name,
+				"status", r.Status,
+				"error", r.Error,
+				"optional", r.Optional)
+		}
+	}
+	startupComplete.Store(true)
+	logger.Info(eventServerStartupComplete, "duration", time.Since(startTime).String())
+}
+
+// startupzHandler は Kubernetes のスタートアッププローブ用エンドポイント
+// 起動処理が完了するまでは 503 を返し、起動に時間がかかるコンテナが liveness で再起動されることを防ぐ
+func startupzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	setCacheControl(w)
+	if !startupComplete.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, "starting")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "ok")
+}
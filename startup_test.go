@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestStartupz はスタートアッププローブのテスト
+// 初回の依存先チェックが完了するまでは 503、完了後は 200 を返すことを保証
+func TestStartupz(t *testing.T) {
+	captureLogs(t)
+	orig := startupComplete.Load()
+	startupComplete.Store(false)
+	t.Cleanup(func() { startupComplete.Store(orig) })
+
+	// 初回の依存先チェックが完了しない間は起動中
+	slow := &blockingChecker{name: "database", delay: 100 * time.Millisecond}
+	db := &fakeChecker{name: "cache"}
+	withCheckers(t, slow, db)
+
+	router := newRouter()
+	probe := func() int {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", "/startupz", nil))
+		return rr.Code
+	}
+
+	done := make(chan struct{})
+	go func() {
+		runStartup(context.Background())
+		close(done)
+	}()
+	if code := probe(); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 during startup, got %d", code)
+	}
+
+	<-done
+	if code := probe(); code != http.StatusOK {
+		t.Errorf("Expected 200 after startup, got %d", code)
+	}
+	if atomic.LoadInt64(&db.calls) != 1 {
+		t.Errorf("Expected initial dependency checks to run once, got %d", db.calls)
+	}
+
+	// 起動完了後は liveness・readiness の状態に影響されない
+	setReady(false)
+	t.Cleanup(func() { setReady(true) })
+	if code := probe(); code != http.StatusOK {
+		t.Errorf("Startup probe should stay 200 after startup, got %d", code)
+	}
+}
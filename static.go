@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+// noListingFS はディレクトリ一覧の表示を無効にした http.FileSystem
+// index.html を持たないディレクトリは存在しないものとして扱い、http.FileServer に 404 を返させる
+// （設置したファイル以外の構成を外部に公開しないため）
+type noListingFS struct {
+	fs http.FileSystem
+}
+
+// Open はファイルを開く（index.html のないディレクトリは fs.ErrNotExist）
+func (n noListingFS) Open(name string) (http.File, error) {
+	f, err := n.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		index, err := n.fs.Open(strings.TrimSuffix(name, "/") + "/index.html")
+		if err != nil {
+			f.Close()
+			return nil, fs.ErrNotExist
+		}
+		index.Close()
+	}
+	return f, nil
+}
+
+// staticHandler は STATIC_DIR のファイルを prefix 配下で配信するハンドラーを返す
+func staticHandler(dir, prefix string) http.HandlerFunc {
+	h := http.StripPrefix(strings.TrimSuffix(prefix, "/"), http.FileServer(noListingFS{http.Dir(dir)}))
+	return h.ServeHTTP
+}
+
+// normalizeStaticPrefix は STATIC_PREFIX を "/" で始まり "/" で終わる形に正規化する
+// 既存のルートと重複する場合はエラーとする
+func normalizeStaticPrefix(prefix string) (string, error) {
+	prefix = "/" + strings.Trim(prefix, "/") + "/"
+	if prefix == "//" {
+		return "", fmt.Errorf("must not be the root path")
+	}
+	for _, rt := range routes() {
+		if rt.pattern+"/" == prefix || strings.HasPrefix(rt.pattern, prefix) {
+			return "", fmt.Errorf("conflicts with route %q", rt.pattern)
+		}
+	}
+	return prefix, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestStaticFiles は静的ファイル配信のテスト
+// 設置したファイルは配信し、ディレクトリ一覧は 404 になることを保証
+func TestStaticFiles(t *testing.T) {
+	captureLogs(t)
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "status.html"), []byte("<p>all systems go</p>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "assets"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	withConfig(t, func(c *Config) {
+		c.StaticDir = dir
+		c.StaticPrefix = "/dashboard/"
+	})
+	router := newRouter()
+	get := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		return rr
+	}
+
+	if rr := get("/dashboard/status.html"); rr.Code != http.StatusOK || rr.Body.String() != "<p>all systems go</p>" {
+		t.Errorf("Expected file content, got %d %q", rr.Code, rr.Body.String())
+	}
+	for _, path := range []string{"/dashboard/", "/dashboard/assets/", "/dashboard/missing.html"} {
+		if rr := get(path); rr.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", path, rr.Code)
+		}
+	}
+}
+
+// TestStaticPrefixValidation は STATIC_PREFIX の正規化と既存ルートとの重複検出のテスト
+func TestStaticPrefixValidation(t *testing.T) {
+	if p, err := normalizeStaticPrefix("assets"); err != nil || p != "/assets/" {
+		t.Errorf("Expected /assets/, got %q (%v)", p, err)
+	}
+	for _, bad := range []string{"/", "/debug", "/health/"} {
+		if _, err := normalizeStaticPrefix(bad); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// syntheticMaxDelay は /synthetic/slow で指定できる遅延の上限
+const syntheticMaxDelay = 60 * time.Second
+
+// syntheticRand は /synthetic/flaky の失敗判定に使う乱数（テストで差し替え可能）
+var syntheticRand = rand.Float64
+
+// syntheticOnly は SLO 訓練用の合成エンドポイントを保護するミドルウェア
+// ENABLE_SYNTHETIC が有効な環境以外では 404 を返す
+func syntheticOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !cfg().EnableSynthetic {
+			writeNotFound(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// synthetic500Handler は常に 500 を返す合成エンドポイント
+// エラー率アラートの発火確認に使用
+func synthetic500Handler(w http.ResponseWriter, r *http.Request) {
+	collector.RecordRequest()
+	writeError(w, r, "Synthetic Internal Server Error", http.StatusInternalServerError)
+}
+
+// syntheticSlowHandler は指定ミリ秒だけ遅延してから応答する合成エンドポイント
+// レイテンシ SLO のバーンレートアラート確認に使用（/synthetic/slow?ms=N）
+func syntheticSlowHandler(w http.ResponseWriter, r *http.Request) {
+	collector.RecordRequest()
+
+	ms, err := strconv.Atoi(r.URL.Query().Get("ms"))
+	if err != nil || ms < 0 {
+		writeError(w, r, "ms must be a non-negative integer", http.StatusBadRequest)
+		return
+	}
+	delay := time.Duration(ms) * time.Millisecond
+	if delay > syntheticMaxDelay {
+		delay = syntheticMaxDelay
+	}
+
+	// クライアント切断やハンドラータイムアウト時は待機を打ち切る
+	select {
+	case <-time.After(delay):
+	case <-r.Context().Done():
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "slept %dms\n", delay.Milliseconds())
+}
+
+// syntheticFlakyHandler は指定割合のリクエストを失敗させる合成エンドポイント
+// エラーバジェット消費の訓練に使用（/synthetic/flaky?rate=0.3）
+func syntheticFlakyHandler(w http.ResponseWriter, r *http.Request) {
+	collector.RecordRequest()
+
+	rate, err := strconv.ParseFloat(r.URL.Query().Get("rate"), 64)
+	if err != nil || rate < 0 || rate > 1 {
+		writeError(w, r, "rate must be a number between 0 and 1", http.StatusBadRequest)
+		return
+	}
+
+	if syntheticRand() < rate {
+		writeError(w, r, "Synthetic Flaky Failure", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestSyntheticDisabled は合成エンドポイントがデフォルトで無効であることのテスト
+func TestSyntheticDisabled(t *testing.T) {
+	rr := httptest.NewRecorder()
+	syntheticOnly(synthetic500Handler)(rr, httptest.NewRequest("GET", "/synthetic/500", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 when synthetic disabled, got %d", rr.Code)
+	}
+}
+
+// TestSynthetic500 は常にエラーを返す合成エンドポイントのテスト
+func TestSynthetic500(t *testing.T) {
+	withConfig(t, func(c *Config) { c.EnableSynthetic = true })
+
+	rr := httptest.NewRecorder()
+	syntheticOnly(synthetic500Handler)(rr, httptest.NewRequest("GET", "/synthetic/500", nil))
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("Expected 500, got %d", rr.Code)
+	}
+}
+
+// TestSyntheticSlow は遅延を制御できる合成エンドポイントのテスト
+func TestSyntheticSlow(t *testing.T) {
+	withConfig(t, func(c *Config) { c.EnableSynthetic = true })
+
+	start := time.Now()
+	rr := httptest.NewRecorder()
+	syntheticOnly(syntheticSlowHandler)(rr, httptest.NewRequest("GET", "/synthetic/slow?ms=50", nil))
+	elapsed := time.Since(start)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected 200, got %d", rr.Code)
+	}
+	if elapsed < 50*time.Millisecond {
+		t.Errorf("Expected delay of at least 50ms, got %v", elapsed)
+	}
+
+	// 不正なパラメーターは 400
+	rr = httptest.NewRecorder()
+	syntheticOnly(syntheticSlowHandler)(rr, httptest.NewRequest("GET", "/synthetic/slow?ms=abc", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid ms, got %d", rr.Code)
+	}
+}
+
+// TestSyntheticFlaky は失敗割合を制御できる合成エンドポイントのテスト
+func TestSyntheticFlaky(t *testing.T) {
+	withConfig(t, func(c *Config) { c.EnableSynthetic = true })
+
+	// 乱数を固定シーケンスに差し替えて失敗割合を検証
+	seq := []float64{0.1, 0.5, 0.25, 0.9, 0.29, 0.31, 0.7, 0.0, 0.95, 0.6}
+	i := 0
+	orig := syntheticRand
+	syntheticRand = func() float64 { v := seq[i%len(seq)]; i++; return v }
+	t.Cleanup(func() { syntheticRand = orig })
+
+	failures := 0
+	for range seq {
+		rr := httptest.NewRecorder()
+		syntheticOnly(syntheticFlakyHandler)(rr, httptest.NewRequest("GET", "/synthetic/flaky?rate=0.3", nil))
+		if rr.Code == http.StatusInternalServerError {
+			failures++
+		}
+	}
+	// 0.3 未満の値（0.1, 0.25, 0.29, 0.0）の4件が失敗する
+	if failures != 4 {
+		t.Errorf("Expected 4 failures with rate=0.3, got %d", failures)
+	}
+
+	// 範囲外の rate は 400
+	rr := httptest.NewRecorder()
+	syntheticOnly(syntheticFlakyHandler)(rr, httptest.NewRequest("GET", "/synthetic/flaky?rate=1.5", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for out-of-range rate, got %d", rr.Code)
+	}
+}
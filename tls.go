@@ -0,0 +1,235 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// newTLSConfig は設定から TLS 設定を構築する
+// TLS_CERT_FILE / TLS_KEY_FILE が未設定の場合は平文 HTTP として nil を返す
+// TLS_SNI_CERTS 設定時は SNI で証明書を選択し、一致しない場合は TLS_CERT_FILE をデフォルトとして使用する
+// TLS_CLIENT_CA 設定時はクライアント証明書を必須とする相互 TLS（mTLS）を有効化する
+func newTLSConfig(c *Config) (*tls.Config, error) {
+	if c.TLSCertFile == "" && c.TLSKeyFile == "" {
+		if c.TLSClientCA != "" {
+			return nil, errors.New("TLS_CLIENT_CA requires TLS_CERT_FILE and TLS_KEY_FILE")
+		}
+		if c.TLSSNICerts != "" {
+			return nil, errors.New("TLS_SNI_CERTS requires TLS_CERT_FILE and TLS_KEY_FILE as the default certificate")
+		}
+		return nil, nil
+	}
+
+	// 証明書のローテーション（cert-manager など）に再起動なしで追従するため、
+	// 固定の Certificates ではなく GetCertificate で都度最新の証明書を返す
+	reloader, err := newCertReloader(c.TLSCertFile, c.TLSKeyFile, c.TLSReloadInterval)
+	if err != nil {
+		return nil, fmt.Errorf("loading TLS certificate: %w", err)
+	}
+
+	tc := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return reloader.Certificate(), nil
+		},
+		// コンプライアンス要件（PCI DSS など）で許可された暗号スイートのみに制限する（nil なら Go の既定値）
+		CipherSuites: c.TLSCipherSuites,
+	}
+
+	// 複数ドメインで直接 TLS を終端する場合は SNI で証明書を選択する
+	if c.TLSSNICerts != "" {
+		sni, err := loadSNICertificates(c.TLSSNICerts)
+		if err != nil {
+			return nil, err
+		}
+		tc.GetCertificate = sni.getCertificate(reloader.Certificate)
+	}
+
+	// ゼロトラストな内部通信向けに、信頼する CA が発行したクライアント証明書のみ受け付ける
+	if c.TLSClientCA != "" {
+		pem, err := os.ReadFile(c.TLSClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("reading TLS_CLIENT_CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("TLS_CLIENT_CA %q contains no valid certificates", c.TLSClientCA)
+		}
+		tc.ClientCAs = pool
+		tc.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tc, nil
+}
+
+// parseCipherSuites は暗号スイート名（"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256" など）のカンマ区切り一覧を ID に変換する
+// 未知の名前・安全でないスイート（tls.InsecureCipherSuites）はエラーとする
+// TLS 1.3 のスイートは Go では設定できない（常に有効）ため、指定された場合もエラーとして誤解を防ぐ
+func parseCipherSuites(list string) ([]uint16, error) {
+	known := make(map[string]*tls.CipherSuite)
+	for _, s := range tls.CipherSuites() {
+		known[s.Name] = s
+	}
+	var ids []uint16
+	for _, name := range splitList(list) {
+		s, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		if len(s.SupportedVersions) == 1 && s.SupportedVersions[0] == tls.VersionTLS13 {
+			return nil, fmt.Errorf("cipher suite %q is TLS 1.3 only and cannot be configured", name)
+		}
+		ids = append(ids, s.ID)
+	}
+	return ids, nil
+}
+
+// sniCertificate は SNI で選択する証明書と、ホスト名照合用に解析した証明書
+type sniCertificate struct {
+	cert *tls.Certificate
+	leaf *x509.Certificate
+}
+
+// sniCertificates は SNI で選択する証明書の一覧
+type sniCertificates []sniCertificate
+
+// loadSNICertificates は "cert.pem:key.pem" 形式のカンマ区切りリストから証明書を読み込む
+func loadSNICertificates(list string) (sniCertificates, error) {
+	var certs sniCertificates
+	for _, pair := range splitList(list) {
+		certFile, keyFile, ok := strings.Cut(pair, ":")
+		if !ok || certFile == "" || keyFile == "" {
+			return nil, fmt.Errorf("invalid TLS_SNI_CERTS entry %q: must be cert.pem:key.pem", pair)
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading TLS_SNI_CERTS certificate %q: %w", certFile, err)
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return nil, fmt.Errorf("parsing TLS_SNI_CERTS certificate %q: %w", certFile, err)
+		}
+		certs = append(certs, sniCertificate{cert: &cert, leaf: leaf})
+	}
+	return certs, nil
+}
+
+// getCertificate は ClientHello の SNI に一致する証明書を返す tls.Config.GetCertificate を構築する
+// 一致する証明書がない場合（SNI なしを含む）は def が返す証明書を使用する
+func (s sniCertificates) getCertificate(def func() *tls.Certificate) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		if hello.ServerName != "" {
+			for _, c := range s {
+				// VerifyHostname は SAN のワイルドカード（*.example.com）も考慮する
+				if c.leaf.VerifyHostname(hello.ServerName) == nil {
+					return c.cert, nil
+				}
+			}
+		}
+		return def(), nil
+	}
+}
+
+// eventTLSCertReloaded は証明書の再読み込みを記録するログのイベント名
+const eventTLSCertReloaded = "tls.cert_reloaded"
+
+// certReloader は証明書・秘密鍵ファイルを定期的に stat し、更新されていれば再読み込みする
+// 確認はハンドシェイク時に TLS_RELOAD_INTERVAL 間隔で行うため、監視用のゴルーチンは不要
+// 再読み込みに失敗した場合（書き換え途中など）は直前の証明書を使い続け、次回の確認で再試行する
+type certReloader struct {
+	certFile string
+	keyFile  string
+	interval time.Duration // 更新確認の最小間隔（0 以下なら再読み込みしない）
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	certMod   time.Time // 読み込み時点の証明書ファイルの更新時刻
+	keyMod    time.Time // 読み込み時点の秘密鍵ファイルの更新時刻
+	lastCheck time.Time
+}
+
+// newCertReloader は証明書を読み込み、再読み込み可能な certReloader を作成する
+func newCertReloader(certFile, keyFile string, interval time.Duration) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile, interval: interval}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	r.lastCheck = time.Now()
+	return r, nil
+}
+
+// Certificate は現在の証明書を返す（確認間隔を過ぎていればファイルの更新を確認する）
+func (r *certReloader) Certificate() *tls.Certificate {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.interval > 0 && time.Since(r.lastCheck) >= r.interval {
+		r.lastCheck = time.Now()
+		r.reloadIfChanged()
+	}
+	return r.cert
+}
+
+// reloadIfChanged はファイルの更新時刻が変わっていれば証明書を再読み込みする（mu を保持して呼ぶ）
+func (r *certReloader) reloadIfChanged() {
+	certMod, keyMod, err := r.modTimes()
+	if err != nil {
+		logger.Warn(eventTLSCertReloaded, "cert_file", r.certFile, "error", err.Error())
+		return
+	}
+	if certMod.Equal(r.certMod) && keyMod.Equal(r.keyMod) {
+		return
+	}
+	if err := r.load(); err != nil {
+		logger.Warn(eventTLSCertReloaded, "cert_file", r.certFile, "error", err.Error())
+		return
+	}
+	logger.Info(eventTLSCertReloaded, "cert_file", r.certFile, "not_after", r.cert.Leaf.NotAfter.Format(time.RFC3339))
+}
+
+// load は証明書と秘密鍵を読み込み、読み込み時点の更新時刻とともに保持する
+func (r *certReloader) load() error {
+	// 読み込み中の書き換えで更新を見逃さないよう、更新時刻は読み込み前に取得する
+	certMod, keyMod, err := r.modTimes()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return err
+		}
+	}
+	r.cert, r.certMod, r.keyMod = &cert, certMod, keyMod
+	return nil
+}
+
+// modTimes は証明書・秘密鍵ファイルの更新時刻を返す
+// Kubernetes の Secret マウントのようなシンボリックリンクの差し替えにも追従するため、リンク先を stat する
+func (r *certReloader) modTimes() (certMod, keyMod time.Time, err error) {
+	ci, err := os.Stat(r.certFile)
+	if err != nil {
+		return certMod, keyMod, err
+	}
+	ki, err := os.Stat(r.keyFile)
+	if err != nil {
+		return certMod, keyMod, err
+	}
+	return ci.ModTime(), ki.ModTime(), nil
+}
+
+// clientCommonName は mTLS で検証済みのクライアント証明書の CN を返す（なければ空文字）
+func clientCommonName(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return ""
+	}
+	return r.TLS.PeerCertificates[0].Subject.CommonName
+}
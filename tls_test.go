@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCert はテスト用に発行した証明書と秘密鍵
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	tlsCert tls.Certificate
+}
+
+// writePEM は証明書と秘密鍵を PEM ファイルとして書き出し、そのパスを返す
+func (c *testCert) writePEM(t *testing.T, dir, name string) (certFile, keyFile string) {
+	t.Helper()
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatalf("Could not marshal key: %v", err)
+	}
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatalf("Could not write cert: %v", err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatalf("Could not write key: %v", err)
+	}
+	return certFile, keyFile
+}
+
+// issueTestCert は証明書を発行する（parent が nil なら自己署名 CA）
+func issueTestCert(t *testing.T, cn string, parent *testCert, dnsNames ...string) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Could not generate key: %v", err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     dnsNames,
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	signerCert, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signerCert, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signerCert, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("Could not create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Could not parse certificate: %v", err)
+	}
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		tlsCert: tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert},
+	}
+}
+
+// startTLSServer は tc をそのまま使う TLS テストサーバーを起動する
+// httptest の StartTLS は Certificates が空だとテスト用証明書を補うため（GetCertificate より優先される）、
+// リスナーを直接 TLS でラップする
+func startTLSServer(t *testing.T, handler http.Handler, tc *tls.Config) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(handler)
+	srv.Listener = tls.NewListener(srv.Listener, tc)
+	srv.Start()
+	srv.URL = "https://" + srv.Listener.Addr().String()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// TestMutualTLS は相互 TLS（mTLS）のテスト
+// 信頼する CA のクライアント証明書は受け付け、証明書なしは拒否し、CN がログに出力されることを保証
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := issueTestCert(t, "test-ca", nil)
+	serverCert := issueTestCert(t, "server", ca, "localhost")
+	clientCert := issueTestCert(t, "billing-service", ca)
+
+	certFile, keyFile := serverCert.writePEM(t, dir, "server")
+	caFile, _ := ca.writePEM(t, dir, "ca")
+
+	tc, err := newTLSConfig(&Config{TLSCertFile: certFile, TLSKeyFile: keyFile, TLSClientCA: caFile})
+	if err != nil {
+		t.Fatalf("newTLSConfig failed: %v", err)
+	}
+
+	// アクセスログを取得
+	logs := captureLogs(t)
+
+	srv := startTLSServer(t, logMiddleware(healthHandler), tc)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	// 有効なクライアント証明書あり：受け付ける
+	withCert := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		RootCAs:      roots,
+		Certificates: []tls.Certificate{clientCert.tlsCert},
+	}}}
+	resp, err := withCert.Get(srv.URL + "/health")
+	if err != nil {
+		t.Fatalf("Request with client cert failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200 with client cert, got %d", resp.StatusCode)
+	}
+
+	var cn any
+	for _, e := range logs.entries(t) {
+		if e["msg"] == eventHTTPAccess {
+			cn = e["client_cn"]
+		}
+	}
+	if cn != "billing-service" {
+		t.Errorf("Expected client CN in access log, got %v", cn)
+	}
+
+	// クライアント証明書なし：ハンドシェイクで拒否される
+	withoutCert := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	if resp, err := withoutCert.Get(srv.URL + "/health"); err == nil {
+		resp.Body.Close()
+		t.Error("Expected request without client cert to be rejected")
+	}
+}
+
+// TestTLSConfigValidation は TLS 設定の検証テスト
+func TestTLSConfigValidation(t *testing.T) {
+	// TLS 未設定なら平文 HTTP
+	if tc, err := newTLSConfig(&Config{}); tc != nil || err != nil {
+		t.Errorf("Expected nil config without TLS settings, got %v, %v", tc, err)
+	}
+
+	// サーバー証明書なしの TLS_CLIENT_CA はエラー
+	if _, err := newTLSConfig(&Config{TLSClientCA: "/tmp/ca.pem"}); err == nil {
+		t.Error("Expected error for TLS_CLIENT_CA without server certificate")
+	}
+
+	// 証明書を含まない CA ファイルはエラー
+	dir := t.TempDir()
+	certFile, keyFile := issueTestCert(t, "server", nil).writePEM(t, dir, "server")
+	badCA := filepath.Join(dir, "bad-ca.pem")
+	os.WriteFile(badCA, bytes.Repeat([]byte("x"), 10), 0o600)
+	if _, err := newTLSConfig(&Config{TLSCertFile: certFile, TLSKeyFile: keyFile, TLSClientCA: badCA}); err == nil {
+		t.Error("Expected error for CA file without certificates")
+	}
+}
+
+// TestSNICertificates は SNI による証明書選択のテスト
+// SNI のホスト名ごとに対応する証明書が返され、一致しない場合はデフォルト証明書になることを保証
+func TestSNICertificates(t *testing.T) {
+	dir := t.TempDir()
+	def := issueTestCert(t, "default", nil, "default.example.com")
+	api := issueTestCert(t, "api", nil, "api.example.com")
+	web := issueTestCert(t, "web", nil, "*.web.example.com")
+
+	defCert, defKey := def.writePEM(t, dir, "default")
+	apiCert, apiKey := api.writePEM(t, dir, "api")
+	webCert, webKey := web.writePEM(t, dir, "web")
+
+	tc, err := newTLSConfig(&Config{
+		TLSCertFile: defCert,
+		TLSKeyFile:  defKey,
+		TLSSNICerts: apiCert + ":" + apiKey + ", " + webCert + ":" + webKey,
+	})
+	if err != nil {
+		t.Fatalf("newTLSConfig failed: %v", err)
+	}
+
+	srv := startTLSServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), tc)
+
+	// served は指定した SNI で接続し、サーバーが提示した証明書の CN を返す
+	served := func(serverName string) string {
+		conn, err := tls.Dial("tcp", srv.Listener.Addr().String(), &tls.Config{
+			ServerName:         serverName,
+			InsecureSkipVerify: true,
+		})
+		if err != nil {
+			t.Fatalf("TLS dial with SNI %q failed: %v", serverName, err)
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+	}
+
+	tests := []struct {
+		sni  string
+		want string
+	}{
+		{"api.example.com", "api"},
+		{"shop.web.example.com", "web"},
+		{"unknown.example.com", "default"},
+		{"", "default"},
+	}
+	for _, tt := range tests {
+		if got := served(tt.sni); got != tt.want {
+			t.Errorf("SNI %q: served %q, want %q", tt.sni, got, tt.want)
+		}
+	}
+
+	// デフォルト証明書なしの SNI 証明書・不正な形式はエラー
+	if _, err := newTLSConfig(&Config{TLSSNICerts: apiCert + ":" + apiKey}); err == nil {
+		t.Error("Expected error for TLS_SNI_CERTS without default certificate")
+	}
+	if _, err := newTLSConfig(&Config{TLSCertFile: defCert, TLSKeyFile: defKey, TLSSNICerts: apiCert}); err == nil {
+		t.Error("Expected error for TLS_SNI_CERTS entry without key file")
+	}
+}
+
+// TestTLSCertReload は証明書ファイル更新時の再読み込みテスト
+// ディスク上の証明書を置き換えると、再起動なしで次の接続から新しい証明書が提示されることを保証
+func TestTLSCertReload(t *testing.T) {
+	logs := captureLogs(t)
+	dir := t.TempDir()
+	certFile, keyFile := issueTestCert(t, "old", nil).writePEM(t, dir, "server")
+
+	tc, err := newTLSConfig(&Config{TLSCertFile: certFile, TLSKeyFile: keyFile, TLSReloadInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("newTLSConfig failed: %v", err)
+	}
+	srv := startTLSServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), tc)
+
+	served := func() string {
+		conn, err := tls.Dial("tcp", srv.Listener.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+		if err != nil {
+			t.Fatalf("TLS dial failed: %v", err)
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+	}
+
+	if got := served(); got != "old" {
+		t.Fatalf("Expected initial certificate 'old', got %q", got)
+	}
+
+	// 同じパスに新しい証明書を書き込む
+	issueTestCert(t, "new", nil).writePEM(t, dir, "server")
+	time.Sleep(20 * time.Millisecond)
+	if got := served(); got != "new" {
+		t.Errorf("Expected reloaded certificate 'new', got %q", got)
+	}
+
+	var reloaded bool
+	for _, e := range logs.entries(t) {
+		if e["msg"] == eventTLSCertReloaded && e["level"] == "INFO" && e["cert_file"] == certFile {
+			reloaded = true
+		}
+	}
+	if !reloaded {
+		t.Error("Expected tls.cert_reloaded log entry")
+	}
+
+	// 不正な内容に書き換えられても直前の証明書を使い続ける
+	if err := os.WriteFile(certFile, []byte("garbage"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if got := served(); got != "new" {
+		t.Errorf("Expected previous certificate to be kept on reload failure, got %q", got)
+	}
+}
+
+// TestTLSCipherSuites は TLS_CIPHER_SUITES のテスト
+// 指定した暗号スイートのみが tls.Config に設定され、未知・安全でない名前は起動エラーになることを保証
+func TestTLSCipherSuites(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := issueTestCert(t, "server", nil).writePEM(t, dir, "server")
+	t.Setenv("TLS_CERT_FILE", certFile)
+	t.Setenv("TLS_KEY_FILE", keyFile)
+
+	// 未設定なら Go の既定値
+	c := mustLoadConfig(t)
+	tc, err := newTLSConfig(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tc.CipherSuites != nil {
+		t.Errorf("Expected Go defaults without TLS_CIPHER_SUITES, got %v", tc.CipherSuites)
+	}
+
+	t.Setenv("TLS_CIPHER_SUITES", "TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384, TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256")
+	c = mustLoadConfig(t)
+	if tc, err = newTLSConfig(&c); err != nil {
+		t.Fatal(err)
+	}
+	want := []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384, tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256}
+	if len(tc.CipherSuites) != len(want) || tc.CipherSuites[0] != want[0] || tc.CipherSuites[1] != want[1] {
+		t.Errorf("Expected cipher suites %v, got %v", want, tc.CipherSuites)
+	}
+
+	// 許可したスイートでハンドシェイクできる
+	srv := startTLSServer(t, http.NotFoundHandler(), tc)
+	conn, err := tls.Dial("tcp", srv.Listener.Addr().String(), &tls.Config{InsecureSkipVerify: true, MaxVersion: tls.VersionTLS12})
+	if err != nil {
+		t.Fatalf("Handshake failed: %v", err)
+	}
+	if got := conn.ConnectionState().CipherSuite; got != want[0] && got != want[1] {
+		t.Errorf("Negotiated unexpected cipher suite %s", tls.CipherSuiteName(got))
+	}
+	conn.Close()
+
+	for _, bad := range []string{"TLS_FAKE_CIPHER", "TLS_RSA_WITH_RC4_128_SHA", "TLS_AES_128_GCM_SHA256"} {
+		t.Setenv("TLS_CIPHER_SUITES", bad)
+		if _, err := loadConfig(); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// tokenBucket はトークンバケット
+// 容量 max までバーストを許容しつつ、平均レートを refillRate（1秒あたり）に制限する
+// リクエストのレート制限（RATE_LIMIT_ALGORITHM=token_bucket）と依存先チェックの再試行予算で使用する
+type tokenBucket struct {
+	mu         sync.Mutex
+	tokens     float64          // 現在の残りトークン
+	max        float64          // バケット容量
+	refillRate float64          // 1秒あたりの補充トークン数
+	last       time.Time        // 最後に補充計算した時刻
+	now        func() time.Time // 差し替え可能な時計（テスト用）
+}
+
+// newTokenBucket は満杯のトークンバケットを作成する
+func newTokenBucket(max int, refillPerSec float64) *tokenBucket {
+	return &tokenBucket{
+		tokens:     float64(max),
+		max:        float64(max),
+		refillRate: refillPerSec,
+		last:       time.Now(),
+		now:        time.Now,
+	}
+}
+
+// allow は経過時間分のトークンを補充し、1個消費できれば true を返す
+func (b *tokenBucket) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	b.tokens += now.Sub(b.last).Seconds() * b.refillRate
+	if b.tokens > b.max {
+		b.tokens = b.max
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestTokenBucket はトークンバケットのテスト
+// 容量分のバーストを受け付けた後は拒否し、経過時間に応じて容量を上限に補充されることを保証
+func TestTokenBucket(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	b := newTokenBucket(2, 4)
+	b.now = func() time.Time { return now }
+	b.last = now
+
+	if !b.allow() || !b.allow() {
+		t.Fatal("Expected a burst up to the bucket capacity")
+	}
+	if b.allow() {
+		t.Error("Expected an empty bucket to reject")
+	}
+
+	// 0.25秒で1個補充される
+	now = now.Add(250 * time.Millisecond)
+	if !b.allow() || b.allow() {
+		t.Error("Expected exactly one token after 250ms")
+	}
+
+	// 長時間経過しても容量を超えて補充されない
+	now = now.Add(time.Hour)
+	for i := 0; i < 2; i++ {
+		if !b.allow() {
+			t.Fatalf("Expected token %d after refill", i+1)
+		}
+	}
+	if b.allow() {
+		t.Error("Refill should be capped at the bucket capacity")
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Cloud Logging がトレースとログを関連付けるための構造化ログのフィールド名
+const (
+	logFieldTrace        = "logging.googleapis.com/trace"
+	logFieldSpanID       = "logging.googleapis.com/spanId"
+	logFieldTraceSampled = "logging.googleapis.com/trace_sampled"
+)
+
+// spanContext はリクエストヘッダーで伝播されたトレースの情報
+type spanContext struct {
+	traceID string // 32桁の16進数
+	spanID  string // 16桁の16進数（省略時は空）
+	sampled bool   // トレースの記録対象か
+}
+
+// parseCloudTraceContext は X-Cloud-Trace-Context ヘッダー（"TRACE_ID/SPAN_ID;o=OPTIONS"）を解析する
+// スパン ID の10進数は Cloud Logging が期待する16桁の16進数に変換する
+// トレース ID が不正な場合は ok=false を返す（スパン ID・オプションは省略可）
+func parseCloudTraceContext(h string) (tc spanContext, ok bool) {
+	h, opts, _ := strings.Cut(h, ";")
+	traceID, span, _ := strings.Cut(h, "/")
+	if !isHex(traceID, 32) {
+		return spanContext{}, false
+	}
+	tc.traceID = strings.ToLower(traceID)
+	if n, err := strconv.ParseUint(span, 10, 64); err == nil && n != 0 {
+		tc.spanID = fmt.Sprintf("%016x", n)
+	}
+	tc.sampled = strings.TrimSpace(opts) == "o=1"
+	return tc, true
+}
+
+// parseTraceparent は W3C Trace Context の traceparent ヘッダー（"00-TRACE_ID-SPAN_ID-FLAGS"）を解析する
+// 不正な値（すべてゼロの ID・未定義のバージョン ff を含む）の場合は ok=false を返す
+func parseTraceparent(h string) (tc spanContext, ok bool) {
+	parts := strings.Split(strings.TrimSpace(h), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || !isHex(parts[1], 32) || !isHex(parts[2], 16) {
+		return spanContext{}, false
+	}
+	// バージョン 00 はフィールドが4つのみ（将来のバージョンは末尾にフィールドが追加されうる）
+	if parts[0] == "00" && len(parts) != 4 {
+		return spanContext{}, false
+	}
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil || len(parts[3]) != 2 {
+		return spanContext{}, false
+	}
+	return spanContext{
+		traceID: strings.ToLower(parts[1]),
+		spanID:  strings.ToLower(parts[2]),
+		sampled: flags&0x01 != 0,
+	}, true
+}
+
+// isHex は s が n 桁の16進数（すべてゼロを除く）かを判定する
+func isHex(s string, n int) bool {
+	if len(s) != n || strings.Trim(s, "0") == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// cloudTraceAttrs は CLOUD_TRACE 有効時に X-Cloud-Trace-Context からアクセスログのトレースフィールドを返す
+// Cloud Run はリクエストごとにこのヘッダーを付与するため、W3C traceparent ではなくこちらを使用する
+func cloudTraceAttrs(r *http.Request, c *Config) []any {
+	if !c.CloudTrace {
+		return nil
+	}
+	tc, ok := parseCloudTraceContext(r.Header.Get("X-Cloud-Trace-Context"))
+	if !ok {
+		return nil
+	}
+	attrs := []any{logFieldTrace, fmt.Sprintf("projects/%s/traces/%s", c.CloudTraceProject, tc.traceID)}
+	if tc.spanID != "" {
+		attrs = append(attrs, logFieldSpanID, tc.spanID)
+	}
+	return append(attrs, logFieldTraceSampled, tc.sampled)
+}
+
+// traceparentAttrs は TRACE_CONTEXT 有効時に traceparent からアクセスログのトレースフィールドを返す
+// ログの trace_id からトレースバックエンドの該当トレースを参照できるようにする
+func traceparentAttrs(r *http.Request, c *Config) []any {
+	if !c.TraceContext {
+		return nil
+	}
+	tc, ok := parseTraceparent(r.Header.Get("traceparent"))
+	if !ok {
+		return nil
+	}
+	return []any{"trace_id", tc.traceID, "span_id", tc.spanID, "sampled", tc.sampled}
+}
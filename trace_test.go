@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestCloudTraceLogFields は CLOUD_TRACE 有効時のアクセスログのテスト
+// X-Cloud-Trace-Context のトレース ID が Cloud Logging の形式（projects/PROJECT/traces/TRACE）で出力されることを保証
+func TestCloudTraceLogFields(t *testing.T) {
+	withConfig(t, func(c *Config) {
+		c.CloudTrace = true
+		c.CloudTraceProject = "my-project"
+	})
+	logs := captureLogs(t)
+
+	handler := logMiddleware(func(w http.ResponseWriter, r *http.Request) {})
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Cloud-Trace-Context", "105445aa7843bc8bf206b12000100000/1;o=1")
+	handler(httptest.NewRecorder(), req)
+
+	entries := logs.entries(t)
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 access log entry, got %d", len(entries))
+	}
+	e := entries[0]
+	if got := e[logFieldTrace]; got != "projects/my-project/traces/105445aa7843bc8bf206b12000100000" {
+		t.Errorf("Unexpected trace field: %v", got)
+	}
+	if got := e[logFieldSpanID]; got != "0000000000000001" {
+		t.Errorf("Unexpected span ID: %v", got)
+	}
+	if got := e[logFieldTraceSampled]; got != true {
+		t.Errorf("Expected trace_sampled=true, got %v", got)
+	}
+
+	// 不正なヘッダーはトレースフィールドを出力しない
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Cloud-Trace-Context", "not-a-trace/1")
+	handler(httptest.NewRecorder(), req)
+	if e := logs.entries(t)[1]; e[logFieldTrace] != nil {
+		t.Errorf("Expected no trace field for invalid header, got %v", e[logFieldTrace])
+	}
+}
+
+// TestCloudTraceRequiresProject は CLOUD_TRACE にプロジェクト ID が必須であることのテスト
+func TestCloudTraceRequiresProject(t *testing.T) {
+	t.Setenv("CLOUD_TRACE", "true")
+	t.Setenv("GOOGLE_CLOUD_PROJECT", "")
+	if _, err := loadConfig(); err == nil {
+		t.Error("Expected error when GOOGLE_CLOUD_PROJECT is missing")
+	}
+	t.Setenv("GOOGLE_CLOUD_PROJECT", "my-project")
+	if c := mustLoadConfig(t); !c.CloudTrace || c.CloudTraceProject != "my-project" {
+		t.Errorf("Unexpected config: %v %q", c.CloudTrace, c.CloudTraceProject)
+	}
+}
+
+// TestTraceparentLogFields は TRACE_CONTEXT 有効時のアクセスログのテスト
+// サンプリングされた traceparent のトレース ID・スパン ID がアクセスログに出力されることを保証
+func TestTraceparentLogFields(t *testing.T) {
+	withConfig(t, func(c *Config) { c.TraceContext = true })
+	logs := captureLogs(t)
+
+	handler := logMiddleware(func(w http.ResponseWriter, r *http.Request) {})
+	for _, h := range []string{
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", // サンプリング対象外
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01", // 不正なトレース ID
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("traceparent", h)
+		handler(httptest.NewRecorder(), req)
+	}
+
+	entries := logs.entries(t)
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 access log entries, got %d", len(entries))
+	}
+	e := entries[0]
+	if e["trace_id"] != "4bf92f3577b34da6a3ce929d0e0e4736" || e["span_id"] != "00f067aa0ba902b7" || e["sampled"] != true {
+		t.Errorf("Unexpected trace fields: trace_id=%v span_id=%v sampled=%v", e["trace_id"], e["span_id"], e["sampled"])
+	}
+	if e := entries[1]; e["sampled"] != false {
+		t.Errorf("Expected sampled=false, got %v", e["sampled"])
+	}
+	if e := entries[2]; e["trace_id"] != nil {
+		t.Errorf("Expected no trace fields for invalid traceparent, got %v", e["trace_id"])
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// eventServerWarmup は起動時ウォームアップ完了のイベント名
+const eventServerWarmup = "server.warmup"
+
+// warmupTask は起動時に一度だけ実行するウォームアップ処理
+type warmupTask struct {
+	name string
+	run  func() error
+}
+
+// warmupTasks は ENABLE_WARMUP 有効時に実行するウォームアップ処理の一覧（テストで差し替え可能）
+var warmupTasks = []warmupTask{
+	// html/template は初回実行時にエスケープ解析を行うため、事前に一度描画しておく
+	{name: "root_template", run: warmRootTemplate},
+	// /metrics の初回スクレイプで ReadMemStats を待たないようキャッシュを埋めておく
+	{name: "memstats", run: func() error { memStats.Get(); return nil }},
+}
+
+// runWarmup はウォームアップ処理を順に実行する
+// 初回リクエストのレイテンシを抑えるための最適化であり、失敗しても起動は継続する
+func runWarmup() {
+	start := time.Now()
+	for _, task := range warmupTasks {
+		if err := task.run(); err != nil {
+			logger.Warn("server.warmup_failed", "task", task.name, "error", err.Error())
+		}
+	}
+	logger.Info(eventServerWarmup,
+		"tasks", len(warmupTasks),
+		"duration", time.Since(start).String())
+}
+
+// warmRootTemplate はランディングページのテンプレートを破棄先に描画する
+func warmRootTemplate() error {
+	return rootTemplate.Execute(io.Discard, struct{ BasePath string }{BasePath: cfg().BasePath})
+}
+
+// ウォームアップ期間の開始・終了のイベント名
+const (
+	eventServerWarmupPhase     = "server.warmup_phase"
+	eventServerWarmupPhaseDone = "server.warmup_phase_done"
+)
+
+// warmupDeadline はウォームアップ期間の終了時刻（UnixNano、0 ならウォームアップ期間外）
+var warmupDeadline atomic.Int64
+
+// startWarmupPhase は now から d の間をウォームアップ期間とし、終了時にログを出力する
+// カナリアの立ち上げ直後に合成のウォームアップリクエストだけを流し、実トラフィックは 503 で他のインスタンスへ回す
+// 返り値の stop は期間を打ち切り、終了ログのタイマーを止める（シャットダウン時に使用）
+func startWarmupPhase(now time.Time, d time.Duration) (stop func()) {
+	warmupDeadline.Store(now.Add(d).UnixNano())
+	logger.Info(eventServerWarmupPhase, "duration", d.String(), "header", cfg().WarmupHeader)
+	timer := time.AfterFunc(d, func() { logger.Info(eventServerWarmupPhaseDone) })
+	return func() {
+		timer.Stop()
+		warmupDeadline.Store(0)
+	}
+}
+
+// warmupRemaining はウォームアップ期間の残り時間を返す（期間外なら 0）
+func warmupRemaining(now time.Time) time.Duration {
+	deadline := warmupDeadline.Load()
+	if deadline == 0 {
+		return 0
+	}
+	if d := time.Unix(0, deadline).Sub(now); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// warmupFilterMiddleware はウォームアップ期間中、WARMUP_HEADER: true を持つリクエストのみ通すミドルウェア
+// それ以外は 503 と残り時間の Retry-After を返す（プローブ用エンドポイントには適用しない）
+func warmupFilterMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		remaining := warmupRemaining(time.Now())
+		if remaining > 0 && r.Header.Get(cfg().WarmupHeader) != "true" {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(remaining.Seconds()))))
+			writeError(w, r, "Service Unavailable: warming up", http.StatusServiceUnavailable)
+			return
+		}
+		next(w, r)
+	}
+}
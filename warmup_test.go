@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestWarmupBeforeListening は起動時ウォームアップのテスト
+// ENABLE_WARMUP 有効時はテンプレートが待ち受け開始前に描画され、無効時は実行されないことを保証
+func TestWarmupBeforeListening(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		logs := captureLogs(t)
+		withConfig(t, func(c *Config) { c.EnableWarmup = enabled })
+		t.Cleanup(func() { setReady(true) })
+
+		// テンプレート描画時点で出力済みのイベント数を記録する
+		rendered := -1
+		orig := warmupTasks
+		warmupTasks = []warmupTask{{name: "root_template", run: func() error {
+			rendered = len(logs.entries(t))
+			return warmRootTemplate()
+		}}}
+		t.Cleanup(func() { warmupTasks = orig })
+
+		server := &http.Server{Addr: "127.0.0.1:0", Handler: http.NotFoundHandler()}
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() { done <- runServer(ctx, server) }()
+
+		deadline := time.Now().Add(2 * time.Second)
+		var listeningAt int
+		for listeningAt == 0 {
+			for i, e := range logs.entries(t) {
+				if e["msg"] == eventServerListening {
+					listeningAt = i
+				}
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("Server did not start listening in time")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		cancel()
+		if err := <-done; err != nil {
+			t.Fatalf("runServer returned error: %v", err)
+		}
+
+		if !enabled {
+			if rendered != -1 {
+				t.Error("Warmup should not run when disabled")
+			}
+			continue
+		}
+		if rendered < 0 {
+			t.Fatal("Root template should be rendered during startup")
+		}
+		// starting の後、listening より前に描画されていること
+		if rendered != 1 || listeningAt != 2 {
+			t.Errorf("Template should be rendered before listening: rendered after %d events, listening at %d",
+				rendered, listeningAt)
+		}
+		if e := logs.entries(t)[1]; e["msg"] != eventServerWarmup {
+			t.Errorf("Expected %s before listening, got %v", eventServerWarmup, e["msg"])
+		}
+	}
+}
+
+// TestWarmupFilter はウォームアップ期間中のリクエストフィルターのテスト
+// 期間中はウォームアップ用ヘッダー付きのリクエストのみ処理され、通常のリクエストは 503 になることを保証
+func TestWarmupFilter(t *testing.T) {
+	captureLogs(t)
+	stop := startWarmupPhase(time.Now(), time.Minute)
+	t.Cleanup(stop)
+
+	root := route{pattern: "/", handler: rootHandler}.build()
+	request := func(h http.HandlerFunc, path string, warmup bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if warmup {
+			req.Header.Set("X-Warmup", "true")
+		}
+		rr := httptest.NewRecorder()
+		h(rr, req)
+		return rr
+	}
+
+	if rr := request(root, "/", true); rr.Code != http.StatusOK {
+		t.Errorf("Warmup request: expected 200, got %d", rr.Code)
+	}
+	rr := request(root, "/", false)
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Normal request during warmup: expected 503, got %d", rr.Code)
+	}
+	if ra := rr.Header().Get("Retry-After"); ra != "60" {
+		t.Errorf("Expected Retry-After of remaining warmup, got %q", ra)
+	}
+
+	// プローブは期間中も応答する
+	health := route{pattern: "/health", handler: healthHandler, probe: true}.build()
+	if rr := request(health, "/health", false); rr.Code != http.StatusOK {
+		t.Errorf("Probe during warmup: expected 200, got %d", rr.Code)
+	}
+
+	// 期間終了後は通常のリクエストも処理される
+	stop()
+	if rr := request(root, "/", false); rr.Code != http.StatusOK {
+		t.Errorf("Normal request after warmup: expected 200, got %d", rr.Code)
+	}
+}